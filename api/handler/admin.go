@@ -0,0 +1,443 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"user-api/api/problem"
+	"user-api/api/validate"
+	"user-api/audit"
+	"user-api/export"
+	"user-api/store"
+	"user-api/util"
+)
+
+// Default and maximum page sizes of the admin list endpoints.
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// adminUserResponse is the representation of a user returned by the admin endpoints.
+// Unlike userResponse it includes access and account state, but never the password hash.
+type adminUserResponse struct {
+	ID                    int               `json:"id"`
+	Username              string            `json:"username"`
+	Email                 string            `json:"email"`
+	DisplayName           string            `json:"display_name"`
+	Avatar                map[string]string `json:"avatar"`
+	Roles                 []string          `json:"roles"`
+	Permissions           []string          `json:"permissions"`
+	Disabled              bool              `json:"disabled"`
+	PasswordResetRequired bool              `json:"password_reset_required"`
+	CreatedAt             time.Time         `json:"created_at"`
+	UpdatedAt             time.Time         `json:"updated_at"`
+	LastLoginAt           *time.Time        `json:"last_login_at"`
+	DeletedAt             *time.Time        `json:"deleted_at"` // Set while the user is pending deletion
+	PurgeAt               *time.Time        `json:"purge_at"`   // When a user pending deletion will be erased
+
+	UsernameHistory []store.UsernameChange `json:"username_history"`
+}
+
+type adminUserListResponse struct {
+	Users  []adminUserResponse `json:"users"`
+	Total  int                 `json:"total"`
+	Offset int                 `json:"offset"`
+	Limit  int                 `json:"limit"`
+}
+
+type adminCreateUserRequest struct {
+	Username    string   `json:"username"`
+	Email       string   `json:"email"`
+	Password    string   `json:"password"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+// Validate checks the user details; roles and permissions are checked by the store.
+func (req adminCreateUserRequest) Validate() error {
+	v := validate.New()
+	v.Username("username", req.Username)
+	v.Email("email", req.Email)
+	v.Password("password", req.Password)
+	return v.Err()
+}
+
+type adminUpdateEmailRequest struct {
+	Email string `json:"email"`
+}
+
+// Validate checks the new email.
+func (req adminUpdateEmailRequest) Validate() error {
+	v := validate.New()
+	v.Email("email", req.Email)
+	return v.Err()
+}
+
+type adminSetRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+type adminSetPermissionsRequest struct {
+	Permissions []string `json:"permissions"`
+}
+
+// AdminListUsersHandler returns a page of users. Supported query parameters are
+// offset, limit (default 20, max 100), q (username or email substring), role and disabled.
+// This handler has JWT and admin role middleware; no need to check token manually
+func AdminListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	offset, err := intParam(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid offset")
+		return
+	}
+	limit, err := intParam(query.Get("limit"), defaultPageSize)
+	if err != nil || limit < 1 || limit > maxPageSize {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid limit")
+		return
+	}
+
+	filter := store.UserFilter{
+		Query: query.Get("q"),
+		Role:  query.Get("role"),
+	}
+	if value := query.Get("disabled"); value != "" {
+		disabled, err := strconv.ParseBool(value)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid disabled filter")
+			return
+		}
+		filter.Disabled = &disabled
+	}
+
+	users, total := store.ListUsers(r.Context(), filter, offset, limit)
+
+	response := adminUserListResponse{
+		Users:  make([]adminUserResponse, 0, len(users)),
+		Total:  total,
+		Offset: offset,
+		Limit:  limit,
+	}
+	for _, user := range users {
+		response.Users = append(response.Users, newAdminUserResponse(user))
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// AdminGetUserHandler returns the user identified by the id path parameter with its ETag,
+// or 304 Not Modified if it matches If-None-Match.
+// This handler has JWT and admin role middleware; no need to check token manually
+func AdminGetUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	writeUser(w, r, user, newAdminUserResponse(user))
+}
+
+// AdminCreateUserHandler creates a user with the given roles and permissions.
+// This handler has JWT and admin role middleware; no need to check token manually
+func AdminCreateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var req adminCreateUserRequest
+	err := decodeRequest(w, r, &req)
+	if err != nil {
+		writeRequestError(w, r, err)
+		return
+	}
+
+	user := store.User{
+		Username:    req.Username,
+		Email:       req.Email,
+		Password:    req.Password,
+		Roles:       req.Roles,
+		Permissions: req.Permissions,
+	}
+	err = store.CreateUser(r.Context(), &user)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	recordAudit(r, audit.TypeAdminCreate, user.ID, map[string]string{"roles": strings.Join(user.Roles, ",")})
+
+	writeJSON(w, http.StatusCreated, newAdminUserResponse(user))
+}
+
+// AdminUpdateEmailHandler changes the email of the user identified by the id path parameter.
+// If the request has an If-Match header, the email is only changed if it matches the current ETag.
+// This handler has JWT and admin role middleware; no need to check token manually
+func AdminUpdateEmailHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req adminUpdateEmailRequest
+	err := decodeRequest(w, r, &req)
+	if err != nil {
+		writeRequestError(w, r, err)
+		return
+	}
+
+	version, ok := checkIfMatch(w, r, user)
+	if !ok {
+		return
+	}
+
+	err = store.UpdateUser(r.Context(), user.ID, store.UserPatch{Email: &req.Email, Version: version})
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	recordAudit(r, audit.TypeAdminEmail, user.ID, nil)
+
+	writeMessage(w, "User email updated successfully")
+}
+
+// AdminResetPasswordHandler replaces the password of the user identified by the id query
+// parameter with a random temporary password, which is returned once in the response.
+// The user must choose a new password when logging in with it, and existing tokens are revoked.
+// This handler has JWT and admin role middleware; no need to check token manually
+func AdminResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	temporaryPassword, err := util.RandomString(12)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	err = store.ForcePasswordReset(r.Context(), user.ID, temporaryPassword)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	recordAudit(r, audit.TypeAdminReset, user.ID, nil)
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"temporary_password": temporaryPassword,
+		"message":            "Password reset required on next login",
+	})
+}
+
+// AdminDisableUserHandler disables the user identified by the id path parameter and revokes their tokens.
+// This handler has JWT and admin role middleware; no need to check token manually
+func AdminDisableUserHandler(w http.ResponseWriter, r *http.Request) {
+	setUserDisabled(w, r, true)
+}
+
+// AdminEnableUserHandler re-enables the user identified by the id path parameter.
+// This handler has JWT and admin role middleware; no need to check token manually
+func AdminEnableUserHandler(w http.ResponseWriter, r *http.Request) {
+	setUserDisabled(w, r, false)
+}
+
+// AdminDeleteUserHandler schedules the deletion of the user identified by the id path parameter.
+// Admins can't delete themselves through this endpoint. If the request has an If-Match header, the user is only deleted if it matches the current ETag.
+// This handler has JWT and admin role middleware; no need to check token manually
+func AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromRequest(w, r)
+	if !ok || !notOwnAccount(w, r, user) {
+		return
+	}
+	version, ok := checkIfMatch(w, r, user)
+	if !ok {
+		return
+	}
+
+	err := store.DeleteUserByID(r.Context(), user.ID, version)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	recordAudit(r, audit.TypeAdminDelete, user.ID, nil)
+	export.DiscardUser(user.ID)
+
+	writeDeletion(w, r, user.ID)
+}
+
+// AdminRestoreUserHandler cancels the pending deletion of the user identified by the id path parameter.
+// Tokens revoked by the deletion stay revoked.
+// This handler has JWT and admin role middleware; no need to check token manually
+func AdminRestoreUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := store.RestoreUser(r.Context(), user.ID)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	recordAudit(r, audit.TypeAdminRestore, user.ID, nil)
+
+	writeMessage(w, "User restored successfully")
+}
+
+// AdminRevokeTokensHandler revokes every token issued so far to the user identified by the id path parameter.
+// This handler has JWT and admin role middleware; no need to check token manually
+func AdminRevokeTokensHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := store.RevokeUserTokens(r.Context(), user.ID)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	recordAudit(r, audit.TypeAdminTokens, user.ID, nil)
+
+	writeMessage(w, "User tokens revoked successfully")
+}
+
+// AdminSetRolesHandler replaces the roles of the user identified by the id path parameter
+// and revokes their tokens. The roles are checked by the store.
+// This handler has JWT and admin role middleware; no need to check token manually
+func AdminSetRolesHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromRequest(w, r)
+	if !ok || !notOwnAccount(w, r, user) {
+		return
+	}
+
+	var req adminSetRolesRequest
+	err := decodeRequest(w, r, &req)
+	if err != nil {
+		writeRequestError(w, r, err)
+		return
+	}
+
+	err = store.SetUserRoles(r.Context(), user.ID, req.Roles)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	recordAudit(r, audit.TypeAdminRoles, user.ID, map[string]string{"roles": strings.Join(req.Roles, ",")})
+
+	writeMessage(w, "User roles updated successfully")
+}
+
+// AdminSetPermissionsHandler replaces the permissions granted directly to the user identified
+// by the id path parameter and revokes their tokens. The permissions are checked by the store.
+// This handler has JWT and admin role middleware; no need to check token manually
+func AdminSetPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromRequest(w, r)
+	if !ok || !notOwnAccount(w, r, user) {
+		return
+	}
+
+	var req adminSetPermissionsRequest
+	err := decodeRequest(w, r, &req)
+	if err != nil {
+		writeRequestError(w, r, err)
+		return
+	}
+
+	err = store.SetUserPermissions(r.Context(), user.ID, req.Permissions)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	recordAudit(r, audit.TypeAdminPerms, user.ID, map[string]string{"permissions": strings.Join(req.Permissions, ",")})
+
+	writeMessage(w, "User permissions updated successfully")
+}
+
+// setUserDisabled sets the disabled state of the user identified by the id path parameter.
+// Admins can't disable themselves.
+func setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	user, ok := userFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if disabled && !notOwnAccount(w, r, user) {
+		return
+	}
+
+	err := store.SetUserDisabled(r.Context(), user.ID, disabled)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	if disabled {
+		recordAudit(r, audit.TypeAdminDisable, user.ID, nil)
+		writeMessage(w, "User disabled successfully")
+	} else {
+		recordAudit(r, audit.TypeAdminEnable, user.ID, nil)
+		writeMessage(w, "User enabled successfully")
+	}
+}
+
+// userFromRequest looks up the user identified by the id path parameter. If the parameter
+// is invalid or the user doesn't exist, an error response is written and ok is false.
+func userFromRequest(w http.ResponseWriter, r *http.Request) (user store.User, ok bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid user id")
+		return store.User{}, false
+	}
+
+	user, err = store.GetUserByID(r.Context(), id)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return store.User{}, false
+	}
+	return user, true
+}
+
+// notOwnAccount writes a 409 Conflict response and returns false if user is the authenticated
+// admin, who could otherwise lock themselves out by disabling, deleting or demoting their account.
+func notOwnAccount(w http.ResponseWriter, r *http.Request, user store.User) bool {
+	if actorID(r) == user.ID {
+		problem.Write(w, r, http.StatusConflict, problem.CodeOwnAccount, "Admins can't apply this action to their own account")
+		return false
+	}
+	return true
+}
+
+// intParam parses an optional integer query parameter, returning defaultValue if it is empty.
+func intParam(value string, defaultValue int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// newAdminUserResponse converts a store user into its admin representation.
+func newAdminUserResponse(user store.User) adminUserResponse {
+	roles := user.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+	history := user.UsernameHistory
+	if history == nil {
+		history = []store.UsernameChange{}
+	}
+	return adminUserResponse{
+		ID:                    user.ID,
+		Username:              user.Username,
+		Email:                 user.Email,
+		DisplayName:           user.DisplayName,
+		Avatar:                avatarURLs(user),
+		Roles:                 roles,
+		Permissions:           user.EffectivePermissions(),
+		Disabled:              user.Disabled,
+		PasswordResetRequired: user.PasswordResetRequired,
+		CreatedAt:             user.CreatedAt,
+		UpdatedAt:             user.UpdatedAt,
+		LastLoginAt:           optionalTime(user.LastLoginAt),
+		DeletedAt:             optionalTime(user.DeletedAt),
+		PurgeAt:               optionalTime(user.PurgeAt()),
+		UsernameHistory:       history,
+	}
+}
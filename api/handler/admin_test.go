@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"user-api/api/problem"
+	"user-api/middleware"
+	"user-api/store"
+	"user-api/util"
+)
+
+// adminMux serves the admin routes under test with the permission, role and If-Match
+// checks of cmd/server, but takes the claims from the test instead of a token.
+func adminMux(claims *util.Claims) http.Handler {
+	authenticated := func(next http.HandlerFunc, permission string, conditional bool) http.HandlerFunc {
+		next = middleware.RequireRole(util.RoleAdmin)(next)
+		if conditional {
+			next = middleware.RequireIfMatch(next)
+		}
+		next = middleware.RequirePermission(permission)(next)
+		return func(w http.ResponseWriter, r *http.Request) {
+			next(w, r.WithContext(context.WithValue(r.Context(), "claims", claims)))
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/admin/users", authenticated(AdminListUsersHandler, util.PermUsersRead, false))
+	mux.HandleFunc("DELETE /v1/admin/users/{id}", authenticated(AdminDeleteUserHandler, util.PermUsersDelete, true))
+	mux.HandleFunc("PUT /v1/admin/users/{id}/email", authenticated(AdminUpdateEmailHandler, util.PermUsersWrite, true))
+	mux.HandleFunc("PUT /v1/admin/users/{id}/roles", authenticated(AdminSetRolesHandler, util.PermUsersWrite, false))
+	mux.HandleFunc("POST /v1/admin/users/{id}/disable", authenticated(AdminDisableUserHandler, util.PermUsersWrite, false))
+	return mux
+}
+
+// claimsFor returns the claims of a token issued to the user with the given ID and roles.
+func claimsFor(id int, roles ...string) *util.Claims {
+	return &util.Claims{
+		Roles:            roles,
+		Permissions:      util.EffectivePermissions(roles, nil),
+		RegisteredClaims: jwt.RegisteredClaims{Subject: strconv.Itoa(id)},
+	}
+}
+
+// serve sends a request to mux and returns the recorded response.
+func serve(mux http.Handler, method, target, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+// createUsers creates a user for each username, failing the test on error.
+func createUsers(t *testing.T, usernames ...string) []store.User {
+	t.Helper()
+	users := make([]store.User, len(usernames))
+	for i, username := range usernames {
+		users[i] = store.User{Username: username, Email: username + "@example.com", Password: "password123"}
+		if err := store.CreateUser(context.Background(), &users[i]); err != nil {
+			t.Fatalf("Failed to create user %s: %v", username, err)
+		}
+	}
+	return users
+}
+
+// TestAdminListUsers tests paging and filtering of the user list.
+func TestAdminListUsers(t *testing.T) {
+	users := createUsers(t, "listeda", "listedb", "listedc")
+	if err := store.SetUserRoles(context.Background(), users[1].ID, []string{util.RoleSupport}); err != nil {
+		t.Fatalf("Failed to set roles: %v", err)
+	}
+	if err := store.SetUserDisabled(context.Background(), users[2].ID, true); err != nil {
+		t.Fatalf("Failed to disable user: %v", err)
+	}
+	mux := adminMux(claimsFor(1, util.RoleAdmin))
+
+	tests := []struct {
+		query      string
+		statusCode int
+		usernames  []string
+		total      int
+	}{
+		{"q=listed", http.StatusOK, []string{"listeda", "listedb", "listedc"}, 3},
+		{"q=listed&limit=2", http.StatusOK, []string{"listeda", "listedb"}, 3},
+		{"q=listed&offset=2&limit=2", http.StatusOK, []string{"listedc"}, 3},
+		{"q=listed&offset=5", http.StatusOK, []string{}, 3},
+		{"q=listed&role=support", http.StatusOK, []string{"listedb"}, 1},
+		{"q=listed&disabled=true", http.StatusOK, []string{"listedc"}, 1},
+		{"q=LISTEDA@EXAMPLE", http.StatusOK, []string{"listeda"}, 1},
+		{"limit=0", http.StatusBadRequest, nil, 0},
+		{"limit=101", http.StatusBadRequest, nil, 0},
+		{"offset=-1", http.StatusBadRequest, nil, 0},
+		{"disabled=maybe", http.StatusBadRequest, nil, 0},
+	}
+
+	for _, test := range tests {
+		rr := serve(mux, "GET", "/v1/admin/users?"+test.query, "", nil)
+		if rr.Code != test.statusCode {
+			t.Errorf("Expected status code %v for %q, but got %v", test.statusCode, test.query, rr.Code)
+			continue
+		}
+		if test.statusCode != http.StatusOK {
+			continue
+		}
+
+		var response adminUserListResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("Could not decode response: %v", err)
+		}
+		usernames := []string{}
+		for _, user := range response.Users {
+			usernames = append(usernames, user.Username)
+		}
+		if strings.Join(usernames, ",") != strings.Join(test.usernames, ",") || response.Total != test.total {
+			t.Errorf("Expected %v of %d for %q, but got %v of %d", test.usernames, test.total, test.query, usernames, response.Total)
+		}
+	}
+}
+
+// TestAdminForbidden tests that users without the admin role or a required permission are rejected.
+func TestAdminForbidden(t *testing.T) {
+	users := createUsers(t, "forbiddentarget")
+	target := "/v1/admin/users/" + strconv.Itoa(users[0].ID)
+
+	tests := []struct {
+		claims *util.Claims
+		method string
+		target string
+	}{
+		{claimsFor(1, util.RoleUser), "GET", "/v1/admin/users"},
+		{claimsFor(1, util.RoleSupport), "GET", "/v1/admin/users"},
+		{claimsFor(1, util.RoleSupport), "POST", target + "/disable"},
+		{claimsFor(1, util.RoleUser), "DELETE", target},
+	}
+
+	for _, test := range tests {
+		rr := serve(adminMux(test.claims), test.method, test.target, "", http.Header{"If-Match": {"*"}})
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("Expected status code %v for %s %s with roles %v, but got %v", http.StatusForbidden, test.method, test.target, test.claims.Roles, rr.Code)
+		}
+	}
+
+	user, _ := store.GetUserByID(context.Background(), users[0].ID)
+	if user.Disabled || !user.DeletedAt.IsZero() {
+		t.Error("Expected a forbidden request not to change the user")
+	}
+}
+
+// TestAdminIfMatch tests that conditional admin routes require a current ETag.
+func TestAdminIfMatch(t *testing.T) {
+	users := createUsers(t, "conditional")
+	target := "/v1/admin/users/" + strconv.Itoa(users[0].ID)
+	mux := adminMux(claimsFor(1, util.RoleAdmin))
+	current := userETag(users[0])
+	stale := `"` + strconv.Itoa(users[0].Version-1) + `"`
+
+	tests := []struct {
+		method     string
+		target     string
+		body       string
+		ifMatch    string
+		statusCode int
+	}{
+		{"PUT", target + "/email", `{"email":"changed@example.com"}`, "", http.StatusPreconditionRequired},
+		{"PUT", target + "/email", `{"email":"changed@example.com"}`, stale, http.StatusPreconditionFailed},
+		{"DELETE", target, "", "", http.StatusPreconditionRequired},
+		{"DELETE", target, "", stale, http.StatusPreconditionFailed},
+		{"PUT", target + "/email", `{"email":"changed@example.com"}`, current, http.StatusOK},
+		// The email change made the ETag stale
+		{"DELETE", target, "", current, http.StatusPreconditionFailed},
+	}
+
+	for _, test := range tests {
+		header := http.Header{}
+		if test.ifMatch != "" {
+			header.Set("If-Match", test.ifMatch)
+		}
+		rr := serve(mux, test.method, test.target, test.body, header)
+		if rr.Code != test.statusCode {
+			t.Errorf("Expected status code %v for %s %s with If-Match %q, but got %v", test.statusCode, test.method, test.target, test.ifMatch, rr.Code)
+		}
+		if rr.Code == http.StatusPreconditionFailed && rr.Header().Get("ETag") == "" {
+			t.Errorf("Expected the current ETag with a 412 response to %s %s", test.method, test.target)
+		}
+	}
+
+	user, _ := store.GetUserByID(context.Background(), users[0].ID)
+	if user.Email != "changed@example.com" || !user.DeletedAt.IsZero() {
+		t.Errorf("Expected only the email change to succeed, but got %q and deleted at %v", user.Email, user.DeletedAt)
+	}
+}
+
+// TestAdminOwnAccount tests that admins can't disable, delete or change the roles of their own account.
+func TestAdminOwnAccount(t *testing.T) {
+	admin := store.User{Username: "selfadmin", Password: "password123", Roles: []string{util.RoleAdmin}}
+	if err := store.CreateUser(context.Background(), &admin); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	target := "/v1/admin/users/" + strconv.Itoa(admin.ID)
+	mux := adminMux(claimsFor(admin.ID, util.RoleAdmin))
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+	}{
+		{"POST", target + "/disable", ""},
+		{"DELETE", target, ""},
+		{"PUT", target + "/roles", `{"roles":["user"]}`},
+	}
+
+	for _, test := range tests {
+		rr := serve(mux, test.method, test.target, test.body, http.Header{"If-Match": {"*"}})
+		var response problem.Problem
+		_ = json.NewDecoder(rr.Body).Decode(&response)
+		if rr.Code != http.StatusConflict || response.Code != problem.CodeOwnAccount {
+			t.Errorf("Expected status code %v and code %s for %s %s, but got %v and %s", http.StatusConflict, problem.CodeOwnAccount, test.method, test.target, rr.Code, response.Code)
+		}
+	}
+
+	user, _ := store.GetUserByID(context.Background(), admin.ID)
+	if user.Disabled || !user.DeletedAt.IsZero() || len(user.Roles) != 1 || user.Roles[0] != util.RoleAdmin {
+		t.Errorf("Expected the admin account to be unchanged, but got %+v", user)
+	}
+
+	// The last administrator can't be disabled by anyone else either
+	rr := serve(adminMux(claimsFor(admin.ID+1000, util.RoleAdmin)), "POST", target+"/disable", "", nil)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status code %v disabling the last administrator, but got %v", http.StatusConflict, rr.Code)
+	}
+}
@@ -1,79 +1,134 @@
 package handler
 
 import (
-	"encoding/json"
 	"net/http"
+	"time"
+	"user-api/api/problem"
+	"user-api/audit"
 	"user-api/store"
 	"user-api/util"
 )
 
-type LoginRequest struct {
-	Username string `json:"username,omitempty"`
-	Password string `json:"password,omitempty"`
-}
-
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	var req LoginRequest
 
-	// Decode JSON
-	err := json.NewDecoder(r.Body).Decode(&req)
+	// Decode and validate JSON
+	err := decodeRequest(w, r, &req)
 	if err != nil {
-		http.Error(w, "Invalid payload request", http.StatusBadRequest)
+		writeRequestError(w, r, err)
 		return
 	}
 
-	// Get user
-	user, err := store.GetUserByUsername(req.Username)
+	// Get user by username, falling back to email
+	user, err := store.GetUserByUsername(r.Context(), req.Username)
+	if err != nil {
+		user, err = store.GetUserByEmail(r.Context(), req.Username)
+	}
 	if err != nil {
-		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		rejectLogin(w, r, 0, http.StatusUnauthorized, problem.CodeInvalidCredentials, "Invalid username or password")
 		return
 	}
 
 	// Check password
-	if !util.CheckHashedPassword(req.Password, user.Password) {
-		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+	if !util.CheckHashedPassword(r.Context(), req.Password, user.Password) {
+		rejectLogin(w, r, user.ID, http.StatusUnauthorized, problem.CodeInvalidCredentials, "Invalid username or password")
+		return
+	}
+
+	// Check account state; only revealed once the password is known to be correct
+	if user.Disabled {
+		rejectLogin(w, r, user.ID, http.StatusForbidden, problem.CodeAccountDisabled, "Account is disabled")
 		return
 	}
 
+	// Logging in during the deletion grace period cancels the deletion; afterwards the account is gone
+	restored := false
+	if !user.DeletedAt.IsZero() {
+		if err := store.RestoreUser(r.Context(), user.ID); err != nil {
+			rejectLogin(w, r, user.ID, http.StatusUnauthorized, problem.CodeInvalidCredentials, "Invalid username or password")
+			return
+		}
+		audit.Record(r, audit.Event{Type: audit.TypeRestore, ActorID: user.ID, TargetID: user.ID})
+		restored = true
+	}
+
+	// Complete a forced password reset before issuing a token
+	if user.PasswordResetRequired {
+		if req.NewPassword == "" || req.NewPassword == req.Password {
+			rejectLogin(w, r, user.ID, http.StatusForbidden, problem.CodePasswordResetRequired, "Password reset required; provide a new_password")
+			return
+		}
+		err = store.UpdateUser(r.Context(), user.ID, store.UserPatch{Password: &req.NewPassword})
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+		audit.Record(r, audit.Event{Type: audit.TypePasswordChange, ActorID: user.ID, TargetID: user.ID})
+		req.Password = req.NewPassword
+		user, _ = store.GetUserByID(r.Context(), user.ID)
+	}
+
+	// Upgrade the stored hash if it was produced with an outdated algorithm or parameters.
+	// Failing to do so is not fatal; the old hash still verifies and will be retried next login.
+	// The upgrade is skipped if the password was changed or reset since it was checked.
+	if util.NeedsRehash(user.Password) {
+		if hash, err := util.HashPassword(r.Context(), req.Password); err == nil {
+			_ = store.UpdatePasswordHash(r.Context(), user.ID, user.Password, hash)
+		}
+	}
+
+	// Record the login; failing to do so doesn't prevent it
+	_ = store.RecordLogin(r.Context(), user.ID, time.Now())
+
 	// Generate JWT
-	token, err := util.GenerateToken(req.Username)
+	token, err := issueToken(user)
 	if err != nil {
-		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		problem.WriteError(w, r, err)
 		return
 	}
+	audit.Record(r, audit.Event{Type: audit.TypeLogin, ActorID: user.ID, TargetID: user.ID})
+	recordLoginAttempt(r, user, true, "")
+	loginAttempts.Inc("success", "")
 
 	// Respond to request
-	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(map[string]string{
+	response := map[string]string{
 		"token": token,
-	})
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
 	}
+	if restored {
+		response["message"] = "Account restored; its deletion was cancelled"
+	}
+	writeJSON(w, http.StatusOK, response)
 }
 
 // LogoutHandler This handler has JWT Middleware; no need to check token manually
 func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	value := r.Context().Value("token")
 	if value == nil {
-		http.Error(w, "Token not found in context", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeTokenMissing, "Token not found in context")
 		return
 	}
 
 	tokenStr, ok := value.(string)
 	if !ok {
-		http.Error(w, "Token is not of type string", http.StatusInternalServerError)
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "An internal error occurred")
 		return
 	}
 
-	// Blacklist the token
-	store.AddTokenToBlacklist(tokenStr)
+	// Blacklist the token until it expires
+	claims := r.Context().Value("claims").(*util.Claims)
+	var expiresAt time.Time
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	store.AddTokenToBlacklist(r.Context(), tokenStr, claims.UserID(), expiresAt)
+	recordAudit(r, audit.TypeLogout, claims.UserID(), nil)
 
 	// Return success response
 	w.WriteHeader(http.StatusOK)
-	_, err := w.Write([]byte("Logged out successfully"))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	}
+	_, _ = w.Write([]byte("Logged out successfully"))
+}
+
+// issueToken generates a JWT for the user carrying their roles and effective permissions.
+func issueToken(user store.User) (string, error) {
+	return util.GenerateToken(user.ID, user.Username, user.Roles, user.EffectivePermissions(), user.TokensRevokedAt)
 }
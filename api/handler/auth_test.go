@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"user-api/config"
+	"user-api/store"
+	"user-api/util"
+)
+
+// login sends a login request for username and password to LoginHandler.
+func login(username, password string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(`{"username":"`+username+`","password":"`+password+`"}`))
+	rr := httptest.NewRecorder()
+	LoginHandler(rr, req)
+	return rr
+}
+
+// TestLoginRehash tests that logging in upgrades a hash made with outdated settings, and
+// that the upgrade never undoes a password reset made while the login was checking the
+// old password.
+func TestLoginRehash(t *testing.T) {
+	defer func(c config.Config) { config.C = c }(config.C)
+	config.C.JWTSecret = "test-secret"
+	outdated := func() { config.C.PasswordHashAlgorithm, config.C.BcryptCost = util.AlgorithmBcrypt, 4 }
+	current := func() {
+		config.C.PasswordHashAlgorithm = util.AlgorithmArgon2id
+		config.C.Argon2Time, config.C.Argon2Memory, config.C.Argon2Threads = 1, 8*1024, 1
+	}
+
+	outdated()
+	user := createUsers(t, "rehashed")[0]
+	current()
+	if rr := login("rehashed", "password123"); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %v, but got %v", http.StatusOK, rr.Code)
+	}
+	user, _ = store.GetUserByID(context.Background(), user.ID)
+	if util.NeedsRehash(user.Password) || !util.CheckHashedPassword(context.Background(), "password123", user.Password) {
+		t.Fatalf("Expected the login to upgrade the hash, but got %s", user.Password)
+	}
+
+	// Race logins against resets; the reset must always win
+	for i := 0; i < 20; i++ {
+		outdated()
+		raced := createUsers(t, "raced"+strings.Repeat("x", i))[0]
+		current()
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			login(raced.Username, "password123")
+		}()
+		go func() {
+			defer wg.Done()
+			if err := store.ForcePasswordReset(context.Background(), raced.ID, "temporary123"); err != nil {
+				t.Errorf("Failed to force password reset: %v", err)
+			}
+		}()
+		wg.Wait()
+
+		raced, _ = store.GetUserByID(context.Background(), raced.ID)
+		if !raced.PasswordResetRequired || !util.CheckHashedPassword(context.Background(), "temporary123", raced.Password) {
+			t.Fatalf("Expected the reset to survive a concurrent login, but the password is no longer the temporary one")
+		}
+	}
+}
+
+// TestLoginRestores tests that logging in to an account pending deletion restores it, and
+// that the token issued right after the deletion revoked the old ones is accepted.
+func TestLoginRestores(t *testing.T) {
+	defer func(c config.Config) { config.C = c }(config.C)
+	config.C.JWTSecret = "test-secret"
+
+	user := createUsers(t, "restored")[0]
+	if err := store.DeleteUserByID(context.Background(), user.ID, 0); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+
+	rr := login("restored", "password123")
+	var response map[string]string
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %v, but got %v and %v", http.StatusOK, rr.Code, err)
+	}
+	if response["message"] == "" {
+		t.Error("Expected a message telling the account was restored")
+	}
+
+	user, _ = store.GetUserByID(context.Background(), user.ID)
+	if !user.DeletedAt.IsZero() {
+		t.Error("Expected the login to cancel the deletion")
+	}
+	claims, err := util.ValidateToken(response["token"])
+	if err != nil {
+		t.Fatalf("Failed to validate token: %v", err)
+	}
+	if store.IsTokenRevoked(context.Background(), user.ID, claims.IssuedAt.Time) {
+		t.Error("Expected the token issued after the deletion to be accepted")
+	}
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"user-api/api/problem"
+	"user-api/audit"
+	"user-api/avatar"
+	"user-api/blob"
+	"user-api/config"
+	"user-api/logging"
+	"user-api/store"
+	"user-api/util"
+)
+
+// BlobStore stores uploaded files such as avatars. It is set by main before requests are served.
+var BlobStore blob.Store
+
+// UploadAvatarHandler replaces the authenticated user's avatar with the PNG, JPEG or GIF
+// image sent as the request body, and returns the updated profile. The image is resized
+// into the variants listed in avatar.Sizes, which are stored in BlobStore.
+// This handler has JWT Middleware; no need to check token manually
+func UploadAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*util.Claims)
+
+	maxBytes := config.C.AvatarMaxBytes
+	if maxBytes <= 0 {
+		maxBytes = 5 << 20
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			problem.Write(w, r, http.StatusRequestEntityTooLarge, problem.CodePayloadTooLarge, fmt.Sprintf("Avatar must be at most %d bytes", maxBytes))
+		} else {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidPayload, "Could not read the request body")
+		}
+		return
+	}
+
+	variants, err := avatar.Process(data)
+	switch {
+	case errors.Is(err, avatar.ErrUnsupportedType):
+		problem.Write(w, r, http.StatusUnsupportedMediaType, problem.CodeUnsupportedMediaType, "Avatar must be a PNG, JPEG or GIF image")
+		return
+	case errors.Is(err, avatar.ErrInvalidImage):
+		problem.Write(w, r, http.StatusUnprocessableEntity, problem.CodeInvalidImage, fmt.Sprintf("Avatar is not a valid image or is larger than %dx%d pixels", avatar.MaxDimension, avatar.MaxDimension))
+		return
+	case err != nil:
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	// Every upload gets new keys, so stored images can be cached forever
+	uploadID, err := util.RandomString(9)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	images := make([]store.AvatarImage, 0, len(variants))
+	for _, variant := range variants {
+		key := fmt.Sprintf("avatars/%d/%s-%s.%s", claims.UserID(), uploadID, variant.Name, variant.Extension)
+		if err := BlobStore.Put(r.Context(), key, variant.Data, variant.ContentType); err != nil {
+			deleteAvatarImages(r.Context(), images)
+			problem.WriteError(w, r, err)
+			return
+		}
+		images = append(images, store.AvatarImage{Name: variant.Name, Side: variant.Side, Key: key})
+	}
+
+	previous, err := store.SetUserAvatar(r.Context(), claims.UserID(), images)
+	if err != nil {
+		deleteAvatarImages(r.Context(), images)
+		problem.WriteError(w, r, err)
+		return
+	}
+	deleteAvatarImages(r.Context(), previous)
+	recordAudit(r, audit.TypeAvatarChange, claims.UserID(), nil)
+
+	writeProfile(w, r, claims.UserID())
+}
+
+// DeleteAvatarHandler removes the authenticated user's avatar and returns the updated profile.
+// This handler has JWT Middleware; no need to check token manually
+func DeleteAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*util.Claims)
+
+	previous, err := store.SetUserAvatar(r.Context(), claims.UserID(), nil)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	deleteAvatarImages(r.Context(), previous)
+	recordAudit(r, audit.TypeAvatarChange, claims.UserID(), map[string]string{"action": "remove"})
+
+	writeProfile(w, r, claims.UserID())
+}
+
+// writeProfile sends the current profile of the user identified by id.
+func writeProfile(w http.ResponseWriter, r *http.Request, id int) {
+	user, err := store.GetUserByID(r.Context(), id)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	writeUser(w, r, user, newUserResponse(user))
+}
+
+// deleteAvatarImages deletes images from the blob store. Failures are logged rather than
+// returned, as they only leave unreferenced files behind.
+func deleteAvatarImages(ctx context.Context, images []store.AvatarImage) {
+	for _, image := range images {
+		if err := BlobStore.Delete(ctx, image.Key); err != nil {
+			logging.FromContext(ctx).Error("failed to delete avatar image", "key", image.Key, "error", err)
+		}
+	}
+}
+
+// avatarURLs returns the URLs of the user's avatar images by variant name, or nil if they have none.
+func avatarURLs(user store.User) map[string]string {
+	if len(user.Avatar) == 0 || BlobStore == nil {
+		return nil
+	}
+	urls := make(map[string]string, len(user.Avatar))
+	for _, image := range user.Avatar {
+		urls[image.Name] = BlobStore.URL(image.Key)
+	}
+	return urls
+}
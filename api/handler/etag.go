@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"user-api/api/problem"
+	"user-api/store"
+)
+
+// userETag returns the entity tag of a user's representations, derived from its version.
+func userETag(user store.User) string {
+	return `"` + strconv.Itoa(user.Version) + `"`
+}
+
+// notModified reports whether the If-None-Match header of the request matches etag,
+// using the weak comparison of RFC 9110, in which case a GET can be answered with
+// 304 Not Modified.
+func notModified(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch checks the If-Match header of the request against the current user,
+// using the strong comparison of RFC 9110. It returns the version a conditional store
+// update must expect, or 0 if the request has no If-Match header. If the header does
+// not match, a 412 Precondition Failed response is written and ok is false.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, user store.User) (version int, ok bool) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return 0, true
+	}
+
+	etag := userETag(user)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == etag {
+			return user.Version, true
+		}
+	}
+
+	w.Header().Set("ETag", etag)
+	problem.Write(w, r, http.StatusPreconditionFailed, problem.CodePreconditionFailed, "The user was modified; fetch it again and retry with its current ETag")
+	return 0, false
+}
+
+// writeUser sends a user representation tagged with the user's ETag, or 304 Not
+// Modified if the client already has the current version.
+func writeUser(w http.ResponseWriter, r *http.Request, user store.User, v any) {
+	etag := userETag(user)
+	w.Header().Set("ETag", etag)
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		if notModified(r, etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, v)
+}
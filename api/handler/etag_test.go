@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-api/store"
+)
+
+// TestNotModified tests weak If-None-Match comparison.
+func TestNotModified(t *testing.T) {
+	tests := []struct {
+		ifNoneMatch string
+		expected    bool
+	}{
+		{"", false},
+		{`"3"`, true},
+		{`W/"3"`, true},
+		{`"1", "3"`, true},
+		{`"2"`, false},
+		{"*", true},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/v1/users/me", nil)
+		req.Header.Set("If-None-Match", test.ifNoneMatch)
+		if got := notModified(req, `"3"`); got != test.expected {
+			t.Errorf("Expected %v for If-None-Match %q, but got %v", test.expected, test.ifNoneMatch, got)
+		}
+	}
+}
+
+// TestCheckIfMatch tests strong If-Match comparison and the version used for conditional updates.
+func TestCheckIfMatch(t *testing.T) {
+	user := store.User{ID: 1, Version: 3}
+
+	tests := []struct {
+		ifMatch string
+		version int
+		ok      bool
+	}{
+		{"", 0, true},
+		{`"3"`, 3, true},
+		{`"2", "3"`, 3, true},
+		{"*", 3, true},
+		{`"2"`, 0, false},
+		{`W/"3"`, 0, false},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("PATCH", "/v1/users/me", nil)
+		req.Header.Set("If-Match", test.ifMatch)
+		rr := httptest.NewRecorder()
+
+		version, ok := checkIfMatch(rr, req, user)
+		if version != test.version || ok != test.ok {
+			t.Errorf("Expected (%d, %v) for If-Match %q, but got (%d, %v)", test.version, test.ok, test.ifMatch, version, ok)
+		}
+		if !ok && rr.Code != http.StatusPreconditionFailed {
+			t.Errorf("Expected status code %v for If-Match %q, but got %v", http.StatusPreconditionFailed, test.ifMatch, rr.Code)
+		}
+	}
+}
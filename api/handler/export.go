@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"user-api/api/problem"
+	"user-api/audit"
+	"user-api/export"
+	"user-api/util"
+)
+
+type exportResponse struct {
+	ID          string        `json:"id"`
+	Status      export.Status `json:"status"`
+	CreatedAt   time.Time     `json:"created_at"`
+	CompletedAt *time.Time    `json:"completed_at"`
+	ExpiresAt   time.Time     `json:"expires_at"` // When the archive is discarded
+
+	// Only set once the archive is ready. A new link is signed on every request.
+	DownloadURL       string     `json:"download_url,omitempty"`
+	DownloadExpiresAt *time.Time `json:"download_expires_at,omitempty"`
+}
+
+// CreateExportHandler starts assembling an archive of the authenticated user's data and
+// returns the export job, whose status can be polled at the URL in the Location header.
+// This handler has JWT Middleware; no need to check token manually
+func CreateExportHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*util.Claims)
+
+	job, err := export.Start(r.Context(), claims.UserID())
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	recordAudit(r, audit.TypeExport, claims.UserID(), map[string]string{"export_id": job.ID})
+
+	w.Header().Set("Location", "/v1/users/me/exports/"+url.PathEscape(job.ID))
+	writeJSON(w, http.StatusAccepted, newExportResponse(job))
+}
+
+// ExportStatusHandler returns the export job identified by the id path parameter, with a
+// short-lived download link once its archive is ready.
+// This handler has JWT Middleware; no need to check token manually
+func ExportStatusHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*util.Claims)
+
+	job, err := export.Get(r.PathValue("id"), claims.UserID())
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, newExportResponse(job))
+}
+
+// DownloadExportHandler sends the archive of the export job identified by the id path parameter.
+// It needs no token, as the link is authorized by its expires and signature query parameters.
+func DownloadExportHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	query := r.URL.Query()
+	if !export.VerifyLink(id, query.Get("expires"), query.Get("signature"), time.Now()) {
+		problem.Write(w, r, http.StatusForbidden, problem.CodeForbidden, "Download link is invalid or has expired")
+		return
+	}
+
+	job, archive, err := export.Archive(id)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="user-%d-export.zip"`, job.UserID))
+	w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(archive)
+}
+
+func newExportResponse(job export.Job) exportResponse {
+	response := exportResponse{
+		ID:          job.ID,
+		Status:      job.Status,
+		CreatedAt:   job.CreatedAt,
+		CompletedAt: optionalTime(job.CompletedAt),
+		ExpiresAt:   job.ExpiresAt,
+	}
+	if job.Status == export.StatusReady {
+		signature, expiresAt := export.SignLink(job, time.Now())
+		query := url.Values{"expires": {strconv.FormatInt(expiresAt.Unix(), 10)}, "signature": {signature}}
+		response.DownloadURL = "/v1/exports/" + url.PathEscape(job.ID) + "/archive?" + query.Encode()
+		response.DownloadExpiresAt = &expiresAt
+	}
+	return response
+}
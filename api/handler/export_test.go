@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"user-api/export"
+	"user-api/util"
+)
+
+// exportMux serves the export routes, authenticating requests as the user with the given claims.
+func exportMux(claims *util.Claims) http.Handler {
+	authenticated := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			next(w, r.WithContext(context.WithValue(r.Context(), "claims", claims)))
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/users/me/exports", authenticated(CreateExportHandler))
+	mux.HandleFunc("GET /v1/users/me/exports/{id}", authenticated(ExportStatusHandler))
+	mux.HandleFunc("GET /v1/exports/{id}/archive", DownloadExportHandler)
+	return mux
+}
+
+// TestDownloadExport tests that archives are only served through valid, unexpired links,
+// that only their owner sees their status, and that discarded archives are gone.
+func TestDownloadExport(t *testing.T) {
+	users := createUsers(t, "exporter", "snooper")
+	owner := exportMux(claimsFor(users[0].ID, util.RoleUser))
+
+	rr := serve(owner, "POST", "/v1/users/me/exports", "", nil)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected status code %v, but got %v", http.StatusAccepted, rr.Code)
+	}
+	location := rr.Header().Get("Location")
+
+	var job exportResponse
+	for deadline := time.Now().Add(5 * time.Second); job.Status != export.StatusReady && time.Now().Before(deadline); {
+		rr = serve(owner, "GET", location, "", nil)
+		if err := json.NewDecoder(rr.Body).Decode(&job); err != nil {
+			t.Fatalf("Could not decode export: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if job.DownloadURL == "" {
+		t.Fatalf("Expected a download link once the export is ready, but got %+v", job)
+	}
+
+	// Other users can't see the job
+	if rr := serve(exportMux(claimsFor(users[1].ID, util.RoleUser)), "GET", location, "", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %v for another user's export, but got %v", http.StatusNotFound, rr.Code)
+	}
+
+	link, _ := url.Parse(job.DownloadURL)
+	query := link.Query()
+	tampered := func(name, value string) string {
+		q := url.Values{"expires": {query.Get("expires")}, "signature": {query.Get("signature")}}
+		q.Set(name, value)
+		return link.Path + "?" + q.Encode()
+	}
+	expires, _ := strconv.ParseInt(query.Get("expires"), 10, 64)
+	stored, _ := export.Get(job.ID, users[0].ID)
+	expiredSignature, expiredAt := export.SignLink(stored, time.Now().Add(-48*time.Hour))
+
+	tests := []struct {
+		target     string
+		statusCode int
+	}{
+		{job.DownloadURL, http.StatusOK},
+		{link.Path, http.StatusForbidden},
+		{tampered("signature", strings.Repeat("A", len(query.Get("signature")))), http.StatusForbidden},
+		{tampered("expires", strconv.FormatInt(expires+3600, 10)), http.StatusForbidden},
+		{tampered("expires", "soon"), http.StatusForbidden},
+		{link.Path + "?expires=" + strconv.FormatInt(expiredAt.Unix(), 10) + "&signature=" + url.QueryEscape(expiredSignature), http.StatusForbidden},
+		{strings.Replace(job.DownloadURL, job.ID, "other", 1), http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		rr := serve(owner, "GET", test.target, "", nil)
+		if rr.Code != test.statusCode {
+			t.Errorf("Expected status code %v for %s, but got %v", test.statusCode, test.target, rr.Code)
+			continue
+		}
+		if rr.Code == http.StatusOK && (rr.Header().Get("Content-Type") != "application/zip" || !strings.HasPrefix(rr.Body.String(), "PK")) {
+			t.Errorf("Expected a ZIP archive, but got %q", rr.Header().Get("Content-Type"))
+		}
+	}
+
+	// Links to discarded archives, e.g. of deleted accounts, no longer work
+	export.DiscardUser(users[0].ID)
+	if rr := serve(owner, "GET", job.DownloadURL, "", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %v for a discarded archive, but got %v", http.StatusNotFound, rr.Code)
+	}
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+	"user-api/api/problem"
+	"user-api/audit"
+	"user-api/logging"
+	"user-api/notify"
+	"user-api/store"
+	"user-api/util"
+)
+
+// Default and maximum number of login attempts returned by LoginHistoryHandler.
+const (
+	defaultLoginHistory = 20
+	maxLoginHistory     = 50
+)
+
+// Notifier delivers notifications such as new device alerts. It is set by main before requests are served.
+var Notifier notify.Notifier
+
+// background tracks notifications being delivered after their request completed.
+var background sync.WaitGroup
+
+// WaitBackground waits until notifications being delivered in the background are sent,
+// or ctx is done. It is called on shutdown, so alerts aren't lost.
+func WaitBackground(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LoginHistoryHandler returns the authenticated user's recent login attempts, most recent first.
+// Supports a limit query parameter.
+// This handler has JWT Middleware; no need to check token manually
+func LoginHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*util.Claims)
+
+	limit, err := intParam(r.URL.Query().Get("limit"), defaultLoginHistory)
+	if err != nil || limit < 1 || limit > maxLoginHistory {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid limit")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string][]store.LoginAttempt{
+		"logins": store.LoginHistory(r.Context(), claims.UserID(), limit),
+	})
+}
+
+// rejectLogin records a failed login as the user identified by userID, or as an anonymous
+// one if userID is 0, and writes the error response. The username of anonymous failures is
+// not recorded: it is often a password typed into the wrong field.
+func rejectLogin(w http.ResponseWriter, r *http.Request, userID int, status int, code, detail string) {
+	if userID == 0 {
+		recordAuditFailure(r, audit.TypeLogin, 0, code, nil)
+	} else {
+		recordAuditFailure(r, audit.TypeLogin, userID, code, nil)
+		recordLoginAttempt(r, store.User{ID: userID}, false, code)
+	}
+	loginAttempts.Inc("failure", code)
+	problem.Write(w, r, status, code, detail)
+}
+
+// recordLoginAttempt adds a login attempt to the user's login history and, for successful
+// logins from an unfamiliar device, alerts the user unless they turned security alerts off.
+// Failures are logged, as they must not prevent the login.
+func recordLoginAttempt(r *http.Request, user store.User, success bool, reason string) {
+	attempt, err := store.AddLoginAttempt(r.Context(), user.ID, store.LoginAttempt{
+		Time:      time.Now().UTC(),
+		IP:        util.ClientIP(r),
+		UserAgent: util.ParseUserAgent(r.UserAgent()),
+		Success:   success,
+		Reason:    reason,
+	})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to record login attempt", "user_id", user.ID, "error", err)
+		return
+	}
+
+	if attempt.NewDevice && user.Settings.Notifications.SecurityAlerts && Notifier != nil {
+		message := newDeviceMessage(user, attempt)
+		logger := logging.FromContext(r.Context())
+		// Deliver in the background, so a slow mail server doesn't delay the login,
+		// but as part of the login's trace
+		parent := context.WithoutCancel(r.Context())
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			ctx, cancel := context.WithTimeout(parent, 30*time.Second)
+			defer cancel()
+			if err := Notifier.Notify(ctx, message); err != nil {
+				logger.Error("failed to send new device alert", "user_id", message.UserID, "error", err)
+			}
+		}()
+	}
+}
+
+// newDeviceMessage returns the alert sent when the user logs in from an unfamiliar device.
+func newDeviceMessage(user store.User, attempt store.LoginAttempt) notify.Message {
+	return notify.Message{
+		Type:    notify.TypeNewDeviceLogin,
+		UserID:  user.ID,
+		To:      user.Email,
+		Subject: "New sign-in to your account",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Your account was just signed in to from a new device:\n\n"+
+			"  Device: %s (%s)\n  IP address: %s\n  Time: %s\n\n"+
+			"If this was you, you can ignore this message. If not, change your password now.\n",
+			user.Username, attempt.UserAgent, attempt.UserAgent.Device, attempt.IP, attempt.Time.Format(time.RFC1123)),
+	}
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"user-api/config"
+	"user-api/notify"
+	"user-api/store"
+)
+
+// recordingNotifier records the messages it is asked to deliver.
+type recordingNotifier struct {
+	mutex    sync.Mutex
+	messages []notify.Message
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, m notify.Message) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.messages = append(n.messages, m)
+	return nil
+}
+
+// TestLoginHistoryAndAlerts tests that logins are recorded in the login history, and that
+// only successful logins from a new device or network alert the user.
+func TestLoginHistoryAndAlerts(t *testing.T) {
+	defer func(c config.Config) { config.C = c }(config.C)
+	config.C.JWTSecret = "test-secret"
+	notifier := &recordingNotifier{}
+	defer func(n notify.Notifier) { Notifier = n }(Notifier)
+	Notifier = notifier
+
+	user := createUsers(t, "alerted")[0]
+	const laptop = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36"
+	const phone = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36"
+
+	tests := []struct {
+		password   string
+		userAgent  string
+		remoteAddr string
+		statusCode int
+		alerted    bool
+	}{
+		{"password123", laptop, "203.0.113.7:40000", http.StatusOK, false}, // First device
+		{"password123", laptop, "203.0.113.80:40000", http.StatusOK, false},
+		{"wrong-password", phone, "198.51.100.7:40000", http.StatusUnauthorized, false},
+		{"password123", laptop, "198.51.100.7:40000", http.StatusOK, true}, // Same kind of device, other network
+		{"password123", phone, "203.0.113.7:40000", http.StatusOK, true},
+		{"password123", phone, "203.0.113.7:40000", http.StatusOK, false},
+	}
+
+	for i, test := range tests {
+		req := httptest.NewRequest("POST", "/v1/sessions", strings.NewReader(`{"username":"alerted","password":"`+test.password+`"}`))
+		req.Header.Set("User-Agent", test.userAgent)
+		req.RemoteAddr = test.remoteAddr
+		rr := httptest.NewRecorder()
+		LoginHandler(rr, req)
+		if rr.Code != test.statusCode {
+			t.Fatalf("Expected status code %v for login %d, but got %v", test.statusCode, i, rr.Code)
+		}
+
+		if err := WaitBackground(context.Background()); err != nil {
+			t.Fatalf("Failed to wait for notifications: %v", err)
+		}
+		notifier.mutex.Lock()
+		alerted := len(notifier.messages) > 0
+		notifier.messages = nil
+		notifier.mutex.Unlock()
+		if alerted != test.alerted {
+			t.Errorf("Expected alert %v for login %d, but got %v", test.alerted, i, alerted)
+		}
+	}
+
+	history := store.LoginHistory(context.Background(), user.ID, 0)
+	if len(history) != len(tests) {
+		t.Fatalf("Expected %d login attempts, but got %d", len(tests), len(history))
+	}
+	for i, attempt := range history {
+		test := tests[len(tests)-1-i]
+		if attempt.Success != (test.statusCode == http.StatusOK) || attempt.NewDevice != test.alerted ||
+			!strings.HasPrefix(test.remoteAddr, attempt.IP+":") {
+			t.Errorf("Unexpected attempt %+v for login %d", attempt, len(tests)-1-i)
+		}
+	}
+	if failed := history[len(history)-3]; failed.Reason != "invalid_credentials" || failed.UserAgent.Device != "Mobile" {
+		t.Errorf("Expected the failed attempt from a phone, but got %+v", failed)
+	}
+}
+
+// TestNewDeviceMessage tests that new device alerts go to the user's email and describe the device.
+func TestNewDeviceMessage(t *testing.T) {
+	user := store.User{ID: 7, Username: "alice", Email: "alice@example.com"}
+	attempt := store.LoginAttempt{IP: "198.51.100.7"}
+	attempt.UserAgent.Browser, attempt.UserAgent.OS, attempt.UserAgent.Device = "Firefox", "Linux", "Desktop"
+
+	message := newDeviceMessage(user, attempt)
+	if message.Type != notify.TypeNewDeviceLogin || message.UserID != 7 || message.To != "alice@example.com" {
+		t.Errorf("Unexpected message %+v", message)
+	}
+	if !strings.Contains(message.Body, "Firefox on Linux (Desktop)") || !strings.Contains(message.Body, "198.51.100.7") {
+		t.Errorf("Expected the device and address in the body, but got %q", message.Body)
+	}
+}
@@ -0,0 +1,10 @@
+package handler
+
+import "user-api/metrics"
+
+var (
+	loginAttempts = metrics.NewCounterVec("auth_login_attempts_total",
+		"Login attempts, by outcome and, for failures, error code.", "outcome", "reason")
+	registrations = metrics.NewCounterVec("auth_registrations_total",
+		"Users who registered themselves.")
+)
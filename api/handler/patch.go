@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"user-api/api/problem"
+)
+
+// mergePatchContentType is the media type of JSON Merge Patch documents (RFC 7396).
+const mergePatchContentType = "application/merge-patch+json"
+
+// Optional is a member of a merge patch document. It tells an absent member, which
+// leaves the field unchanged, apart from a null one, which removes the field.
+type Optional[T any] struct {
+	Set   bool // The member is present
+	Null  bool // The member is present and null
+	Value T
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It is only called for members that are present.
+// Like decodeRequest, it rejects unknown fields in nested objects.
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if string(data) == "null" {
+		o.Null = true
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(&o.Value)
+}
+
+// Ptr returns nil if the member is absent or null, and a pointer to its value otherwise.
+func (o Optional[T]) Ptr() *T {
+	if !o.Set || o.Null {
+		return nil
+	}
+	return &o.Value
+}
+
+// requireMergePatch checks that a PATCH request carries a merge patch document.
+// If it doesn't, a 415 Unsupported Media Type response advertising the accepted
+// type is written and false is returned.
+func requireMergePatch(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPatch {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != mergePatchContentType {
+		w.Header().Set("Accept-Patch", mergePatchContentType)
+		problem.Write(w, r, http.StatusUnsupportedMediaType, problem.CodeUnsupportedMediaType, "PATCH requests must be sent as "+mergePatchContentType)
+		return false
+	}
+	return true
+}
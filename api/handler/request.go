@@ -0,0 +1,245 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"user-api/api/problem"
+	"user-api/api/validate"
+	"user-api/store"
+)
+
+// maxRequestBodyBytes caps the size of JSON request bodies.
+const maxRequestBodyBytes = 64 << 10
+
+// RegisterRequest is the body of a registration request.
+type RegisterRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// Validate checks the registration request and returns all field errors.
+func (req RegisterRequest) Validate() error {
+	v := validate.New()
+	v.Username("username", req.Username)
+	v.Email("email", req.Email)
+	v.Password("password", req.Password)
+	return v.Err()
+}
+
+// LoginRequest is the body of a login request.
+type LoginRequest struct {
+	Username    string `json:"username,omitempty"` // Username or email of the user
+	Password    string `json:"password,omitempty"`
+	NewPassword string `json:"new_password,omitempty"` // Required when an operator forced a password reset
+}
+
+// Validate checks the login request and returns all field errors. Passwords are
+// only checked for presence, so accounts created under older rules can still log in.
+func (req LoginRequest) Validate() error {
+	v := validate.New()
+	v.Required("username", req.Username)
+	v.Required("password", req.Password)
+	if req.NewPassword != "" {
+		v.Password("new_password", req.NewPassword)
+	}
+	return v.Err()
+}
+
+// UpdateUserRequest is a merge patch of the authenticated user's profile. Only the
+// fields below may be patched; absent fields are left unchanged and null ones are
+// cleared or reset to their default. Changing the email or password also requires
+// the current password, which is not part of the profile.
+type UpdateUserRequest struct {
+	Email           Optional[string]          `json:"email"`
+	Password        Optional[string]          `json:"password"`
+	DisplayName     Optional[string]          `json:"display_name"`
+	Locale          Optional[string]          `json:"locale"`
+	Timezone        Optional[string]          `json:"timezone"`
+	Settings        Optional[SettingsRequest] `json:"settings"`
+	CurrentPassword string                    `json:"current_password,omitempty"`
+}
+
+// SettingsRequest is a merge patch of the user's settings.
+type SettingsRequest struct {
+	Theme         Optional[string]                      `json:"theme"`
+	Notifications Optional[NotificationSettingsRequest] `json:"notifications"`
+}
+
+// NotificationSettingsRequest is a merge patch of the user's notification settings.
+type NotificationSettingsRequest struct {
+	Email          Optional[bool] `json:"email"`
+	SecurityAlerts Optional[bool] `json:"security_alerts"`
+	Newsletter     Optional[bool] `json:"newsletter"`
+}
+
+// Validate checks the fields present in the patch and returns all field errors.
+func (req UpdateUserRequest) Validate() error {
+	v := validate.New()
+	if req.Email.Null {
+		v.Add("email", validate.CodeRequired, "cannot be removed")
+	} else if req.Email.Set {
+		v.Email("email", req.Email.Value)
+	}
+	if req.Password.Null {
+		v.Add("password", validate.CodeRequired, "cannot be removed")
+	} else if req.Password.Set {
+		v.Password("password", req.Password.Value)
+	}
+	if req.DisplayName.Set {
+		v.DisplayName("display_name", req.DisplayName.Value)
+	}
+	if req.Locale.Set && !req.Locale.Null {
+		v.Locale("locale", req.Locale.Value)
+	}
+	if req.Timezone.Set && !req.Timezone.Null {
+		v.Timezone("timezone", req.Timezone.Value)
+	}
+	if req.Settings.Value.Theme.Set && !req.Settings.Value.Theme.Null {
+		v.OneOf("settings.theme", req.Settings.Value.Theme.Value, store.Themes)
+	}
+	if req.ChangesCredentials() {
+		v.Required("current_password", req.CurrentPassword)
+	}
+	return v.Err()
+}
+
+// ChangesCredentials reports whether the patch changes the email or password.
+func (req UpdateUserRequest) ChangesCredentials() bool {
+	return req.Email.Set || req.Password.Set
+}
+
+// Patch returns the store patch applying the request.
+func (req UpdateUserRequest) Patch() store.UserPatch {
+	patch := store.UserPatch{
+		Email:       req.Email.Ptr(),
+		Password:    req.Password.Ptr(),
+		DisplayName: clearable(req.DisplayName),
+		Locale:      clearable(req.Locale),
+		Timezone:    clearable(req.Timezone),
+	}
+	if req.Settings.Set {
+		patch.Settings = req.Settings.Value.patch(req.Settings.Null)
+	}
+	return patch
+}
+
+// patch returns the store patch applying the request to the settings, or
+// restoring the defaults if the settings are null.
+func (req SettingsRequest) patch(reset bool) *store.SettingsPatch {
+	defaults := store.DefaultSettings()
+	notifications := req.Notifications.Value
+	resetNotifications := req.Notifications.Null
+
+	return &store.SettingsPatch{
+		Reset:                reset,
+		Theme:                orDefault(req.Theme, defaults.Theme, false),
+		NotifyEmail:          orDefault(notifications.Email, defaults.Notifications.Email, resetNotifications),
+		NotifySecurityAlerts: orDefault(notifications.SecurityAlerts, defaults.Notifications.SecurityAlerts, resetNotifications),
+		NotifyNewsletter:     orDefault(notifications.Newsletter, defaults.Notifications.Newsletter, resetNotifications),
+	}
+}
+
+// clearable returns the store patch value of an optional field that is cleared by null.
+func clearable(o Optional[string]) *string {
+	if o.Null {
+		empty := ""
+		return &empty
+	}
+	return o.Ptr()
+}
+
+// orDefault returns the store patch value of an optional field that is reset to
+// defaultValue by null, or when its parent object is null.
+func orDefault[T any](o Optional[T], defaultValue T, parentNull bool) *T {
+	if o.Null || parentNull {
+		return &defaultValue
+	}
+	return o.Ptr()
+}
+
+// RenameRequest is the body of a username change request.
+type RenameRequest struct {
+	Username string `json:"username"`
+}
+
+// Validate checks the rename request and returns all field errors.
+func (req RenameRequest) Validate() error {
+	v := validate.New()
+	v.Username("username", req.Username)
+	return v.Err()
+}
+
+// validator is implemented by request bodies that can check their own fields.
+type validator interface {
+	Validate() error
+}
+
+// requestError is a problem with a request body that is not tied to a single field.
+type requestError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+// decodeRequest decodes a JSON request body into dst and validates it if dst implements
+// Validate. Bodies larger than maxRequestBodyBytes, unknown fields, fields of the wrong
+// type and trailing data are rejected. The returned error can be passed to writeRequestError.
+func decodeRequest(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(dst)
+	if err == nil && decoder.More() {
+		err = errors.New("unexpected data after JSON object")
+	}
+	if err != nil {
+		return decodeError(err)
+	}
+
+	if v, ok := dst.(validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+// decodeError converts a JSON decoding error into field errors where the problem can
+// be attributed to a field, and into a requestError otherwise.
+func decodeError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return &requestError{http.StatusRequestEntityTooLarge, problem.CodePayloadTooLarge, "Request body too large"}
+	case errors.As(err, &typeErr):
+		return validate.Errors{{Field: typeErr.Field, Code: validate.CodeInvalidType, Message: "must be a " + typeErr.Type.String()}}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return validate.Errors{{Field: field, Code: validate.CodeUnknownField, Message: "is not allowed"}}
+	case errors.Is(err, io.EOF):
+		return &requestError{http.StatusBadRequest, problem.CodeInvalidPayload, "Request body is empty"}
+	default:
+		return &requestError{http.StatusBadRequest, problem.CodeInvalidPayload, "Invalid payload request"}
+	}
+}
+
+// writeRequestError sends the problem details response for an error returned by decodeRequest.
+// Field errors are listed in a 422 Unprocessable Entity problem.
+func writeRequestError(w http.ResponseWriter, r *http.Request, err error) {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		problem.Write(w, r, reqErr.status, reqErr.code, reqErr.message)
+		return
+	}
+	problem.WriteError(w, r, err)
+}
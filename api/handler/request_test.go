@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"user-api/api/problem"
+	"user-api/api/validate"
+	"user-api/store"
+)
+
+// TestDecodeRequest tests decoding and validating request bodies into DTOs.
+func TestDecodeRequest(t *testing.T) {
+	tests := []struct {
+		body       string
+		statusCode int
+		fields     []string
+	}{
+		{`{"username":"alice","email":"alice@example.com","password":"password123"}`, http.StatusOK, nil},
+		{`{"username":"","email":"nope","password":"pw"}`, http.StatusUnprocessableEntity, []string{"username", "email", "password"}},
+		{`{"username":"alice","email":"alice@example.com","password":"password123","roles":["admin"]}`, http.StatusUnprocessableEntity, []string{"roles"}},
+		{`{"username":42}`, http.StatusUnprocessableEntity, []string{"username"}},
+		{`{"username":"alice"} {"username":"bob"}`, http.StatusBadRequest, nil},
+		{`{"username":`, http.StatusBadRequest, nil},
+		{``, http.StatusBadRequest, nil},
+		{`{"username":"` + strings.Repeat("a", maxRequestBodyBytes) + `"}`, http.StatusRequestEntityTooLarge, nil},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/register", strings.NewReader(test.body))
+		rr := httptest.NewRecorder()
+
+		var dst RegisterRequest
+		err := decodeRequest(rr, req, &dst)
+		if err == nil {
+			rr.WriteHeader(http.StatusOK)
+		} else {
+			writeRequestError(rr, req, err)
+		}
+
+		if rr.Code != test.statusCode {
+			t.Errorf("Expected status code %v, but got %v for body %.60s", test.statusCode, rr.Code, test.body)
+			continue
+		}
+
+		if test.statusCode != http.StatusOK && rr.Header().Get("Content-Type") != problem.ContentType {
+			t.Errorf("Expected problem details content type, but got %q", rr.Header().Get("Content-Type"))
+		}
+
+		if test.fields != nil {
+			var response problem.Problem
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Could not decode validation errors: %v", err)
+			}
+			if len(response.Errors) != len(test.fields) {
+				t.Errorf("Expected errors for %v, but got %+v", test.fields, response.Errors)
+				continue
+			}
+			for i, field := range test.fields {
+				if response.Errors[i].Field != field {
+					t.Errorf("Expected error for field %s, but got %+v", field, response.Errors[i])
+				}
+			}
+		}
+	}
+}
+
+// TestUpdateUserRequest tests that merge patches tell absent, null and set members apart.
+func TestUpdateUserRequest(t *testing.T) {
+	tests := []struct {
+		body   string
+		email  *string
+		fields []string
+	}{
+		{`{}`, nil, nil},
+		{`{"email":"new@example.com","current_password":"password123"}`, ptr("new@example.com"), nil},
+		{`{"email":"new@example.com"}`, nil, []string{"current_password"}},
+		{`{"email":null,"current_password":"password123"}`, nil, []string{"email"}},
+		{`{"password":"short","current_password":"password123"}`, nil, []string{"password"}},
+		{`{"username":"bob"}`, nil, []string{"username"}},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("PATCH", "/v1/users/me", strings.NewReader(test.body))
+		rr := httptest.NewRecorder()
+
+		var dst UpdateUserRequest
+		err := decodeRequest(rr, req, &dst)
+		if test.fields == nil {
+			if err != nil {
+				t.Errorf("Expected %s to be valid, but got %v", test.body, err)
+				continue
+			}
+			patch := dst.Patch()
+			if (patch.Email == nil) != (test.email == nil) || (patch.Email != nil && *patch.Email != *test.email) {
+				t.Errorf("Unexpected email patch for %s: %v", test.body, patch.Email)
+			}
+			if patch.Password != nil {
+				t.Errorf("Expected password to be unchanged for %s", test.body)
+			}
+			continue
+		}
+
+		var fieldErrs validate.Errors
+		if !errors.As(err, &fieldErrs) || len(fieldErrs) != len(test.fields) {
+			t.Errorf("Expected errors for %v, but got %v for %s", test.fields, err, test.body)
+			continue
+		}
+		for i, field := range test.fields {
+			if fieldErrs[i].Field != field {
+				t.Errorf("Expected error for field %s, but got %+v", field, fieldErrs[i])
+			}
+		}
+	}
+}
+
+// TestRequireMergePatch tests that PATCH requests must be merge patch documents.
+func TestRequireMergePatch(t *testing.T) {
+	tests := []struct {
+		method      string
+		contentType string
+		ok          bool
+	}{
+		{"PATCH", "application/merge-patch+json", true},
+		{"PATCH", "application/merge-patch+json; charset=utf-8", true},
+		{"PATCH", "application/json", false},
+		{"PATCH", "", false},
+		{"POST", "application/json", true},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, "/v1/users/me", nil)
+		req.Header.Set("Content-Type", test.contentType)
+		rr := httptest.NewRecorder()
+
+		if ok := requireMergePatch(rr, req); ok != test.ok {
+			t.Errorf("Expected %v for %s %q, but got %v", test.ok, test.method, test.contentType, ok)
+			continue
+		}
+		if !test.ok && (rr.Code != http.StatusUnsupportedMediaType || rr.Header().Get("Accept-Patch") != mergePatchContentType) {
+			t.Errorf("Expected 415 with Accept-Patch for %q, but got %v", test.contentType, rr.Code)
+		}
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
+
+// TestSettingsPatch tests that settings patches only change the members present,
+// and that null members are reset to their defaults.
+func TestSettingsPatch(t *testing.T) {
+	defaults := store.DefaultSettings()
+
+	tests := []struct {
+		body     string
+		expected store.Settings
+	}{
+		{`{"settings":{"theme":"dark"}}`, store.Settings{Theme: "dark", Notifications: store.NotificationSettings{Email: false, SecurityAlerts: true, Newsletter: true}}},
+		{`{"settings":{"notifications":{"newsletter":false}}}`, store.Settings{Theme: "light", Notifications: store.NotificationSettings{Email: false, SecurityAlerts: true, Newsletter: false}}},
+		{`{"settings":{"notifications":null}}`, store.Settings{Theme: "light", Notifications: defaults.Notifications}},
+		{`{"settings":null}`, defaults},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("PATCH", "/v1/users/me", strings.NewReader(test.body))
+		var dst UpdateUserRequest
+		if err := decodeRequest(httptest.NewRecorder(), req, &dst); err != nil {
+			t.Fatalf("Failed to decode %s: %v", test.body, err)
+		}
+
+		settings := store.Settings{Theme: "light", Notifications: store.NotificationSettings{Email: false, SecurityAlerts: true, Newsletter: true}}
+		patch := dst.Patch().Settings
+		if patch == nil {
+			t.Fatalf("Expected a settings patch for %s", test.body)
+		}
+		patch.Apply(&settings)
+		if settings != test.expected {
+			t.Errorf("Expected %+v for %s, but got %+v", test.expected, test.body, settings)
+		}
+	}
+
+	// Unknown settings and invalid themes are rejected
+	for _, body := range []string{`{"settings":{"colour":"red"}}`, `{"settings":{"theme":"neon"}}`} {
+		req := httptest.NewRequest("PATCH", "/v1/users/me", strings.NewReader(body))
+		var dst UpdateUserRequest
+		var fieldErrs validate.Errors
+		if err := decodeRequest(httptest.NewRecorder(), req, &dst); !errors.As(err, &fieldErrs) {
+			t.Errorf("Expected field errors for %s, but got %v", body, err)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// writeJSON sends v as a JSON response with the given status. Encoding errors
+// are ignored, as the status has already been sent and can't be changed.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeMessage sends a 200 OK response with a JSON message body.
+func writeMessage(w http.ResponseWriter, message string) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"message": message,
+	})
+}
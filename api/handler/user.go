@@ -1,121 +1,262 @@
 package handler
 
 import (
-	"encoding/json"
 	"net/http"
+	"time"
+	"user-api/api/problem"
+	"user-api/api/validate"
+	"user-api/audit"
+	"user-api/export"
 	"user-api/store"
 	"user-api/util"
 )
 
 type userResponse struct {
-	ID       int    `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
+	ID          int               `json:"id"`
+	Username    string            `json:"username"`
+	Email       string            `json:"email"`
+	DisplayName string            `json:"display_name"`
+	Locale      string            `json:"locale"`
+	Timezone    string            `json:"timezone"`
+	Settings    store.Settings    `json:"settings"`
+	Avatar      map[string]string `json:"avatar"` // URLs of the avatar images by size name; null without an avatar
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	LastLoginAt *time.Time        `json:"last_login_at"` // Null if the user never logged in
 }
 
 func RegisterUserHandler(w http.ResponseWriter, r *http.Request) {
-	var user store.User
+	var req RegisterRequest
 
-	// Decode request
-	err := json.NewDecoder(r.Body).Decode(&user)
+	// Decode and validate request
+	err := decodeRequest(w, r, &req)
 	if err != nil {
-		http.Error(w, "Invalid payload request", http.StatusBadRequest)
+		writeRequestError(w, r, err)
 		return
 	}
 
+	// Reserved names, and lookalikes of them, can't be registered
+	if util.IsReservedUsername(req.Username) {
+		writeRequestError(w, r, reservedUsernameError())
+		return
+	}
+
+	// New users always get the default role
+	user := store.User{
+		Username: req.Username,
+		Email:    req.Email,
+		Password: req.Password,
+	}
+
 	// Store user in data store
-	err = store.CreateUser(&user)
+	err = store.CreateUser(r.Context(), &user)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		problem.WriteError(w, r, err)
 		return
 	}
+	audit.Record(r, audit.Event{Type: audit.TypeRegister, ActorID: user.ID, TargetID: user.ID})
+	registrations.Inc()
 
 	// Generate the token
-	token, err := util.GenerateToken(user.Username)
+	token, err := issueToken(user)
 	if err != nil {
-		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		problem.WriteError(w, r, err)
 		return
 	}
 
 	// Respond to request with the generated token
-	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(map[string]string{
+	writeJSON(w, http.StatusOK, map[string]string{
 		"token":   token,
 		"message": "User registered successfully",
 	})
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	}
 }
 
-// ProfileHandler This handler has JWT Middleware; no need to check token manually
+// ProfileHandler returns the authenticated user's profile with its ETag, or 304 Not Modified
+// if it matches If-None-Match.
+// This handler has JWT Middleware; no need to check token manually
 func ProfileHandler(w http.ResponseWriter, r *http.Request) {
 	claims := r.Context().Value("claims").(*util.Claims)
-	user, err := store.GetUserByUsername(claims.Username)
+	user, err := store.GetUserByID(r.Context(), claims.UserID())
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		problem.WriteError(w, r, err)
 		return
 	}
 
 	// Return user profile data; mask sensitive data
-	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(userResponse{
-		ID:       user.ID,
-		Username: user.Username,
-		Email:    user.Email,
-	})
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	}
+	writeUser(w, r, user, newUserResponse(user))
 }
 
-// UpdateUserHandler This handler has JWT Middleware; no need to check token manually
+// UpdateUserHandler applies a JSON Merge Patch (RFC 7396) to the authenticated user's
+// profile and returns the updated profile. PATCH requests must be sent as
+// application/merge-patch+json; the legacy POST route accepts any JSON body.
+// If the request has an If-Match header, the patch is only applied if it matches the
+// current ETag; concurrent updates then fail with 412 Precondition Failed.
+// This handler has JWT Middleware; no need to check token manually
 func UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 	claims := r.Context().Value("claims").(*util.Claims)
 
-	var updatedUser store.User
-	err := json.NewDecoder(r.Body).Decode(&updatedUser)
+	if !requireMergePatch(w, r) {
+		return
+	}
+
+	var req UpdateUserRequest
+	err := decodeRequest(w, r, &req)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeRequestError(w, r, err)
 		return
 	}
 
-	// Make sure the updated user matches the authenticated user
-	updatedUser.Username = claims.Username
+	user, err := store.GetUserByID(r.Context(), claims.UserID())
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	version, ok := checkIfMatch(w, r, user)
+	if !ok {
+		return
+	}
+
+	// A stolen token alone must not be enough to take over the account
+	if req.ChangesCredentials() && !util.CheckHashedPassword(r.Context(), req.CurrentPassword, user.Password) {
+		recordAuditFailure(r, credentialsEventType(req), user.ID, problem.CodeInvalidCredentials, nil)
+		problem.Write(w, r, http.StatusForbidden, problem.CodeInvalidCredentials, "Current password is incorrect")
+		return
+	}
 
-	// Update user in the store
-	err = store.UpdateUser(&updatedUser)
+	// Update user in the store, unless it changed since the If-Match check
+	patch := req.Patch()
+	patch.Version = version
+	err = store.UpdateUser(r.Context(), user.ID, patch)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.WriteError(w, r, err)
 		return
 	}
+	recordProfileUpdate(r, user.ID, req)
 
-	// Send success response
-	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(map[string]string{
-		"message": "User updated successfully",
-	})
+	user, err = store.GetUserByID(r.Context(), user.ID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.WriteError(w, r, err)
+		return
 	}
+
+	writeUser(w, r, user, newUserResponse(user))
 }
 
-// DeleteUserHandler This handler has JWT Middleware; no need to check token manually
+// DeleteUserHandler schedules the deletion of the authenticated user and revokes their tokens.
+// Logging in again before the grace period ends restores the account. If the request has
+// an If-Match header, the user is only deleted if it matches the current ETag.
+// This handler has JWT Middleware; no need to check token manually
 func DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	claims := r.Context().Value("claims").(*util.Claims)
 
-	err := store.DeleteUserByUsername(claims.Username)
+	user, err := store.GetUserByID(r.Context(), claims.UserID())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.WriteError(w, r, err)
 		return
 	}
+	version, ok := checkIfMatch(w, r, user)
+	if !ok {
+		return
+	}
+
+	err = store.DeleteUserByID(r.Context(), user.ID, version)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	recordAudit(r, audit.TypeDelete, user.ID, nil)
+	export.DiscardUser(user.ID)
 
 	// Send success response
-	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(map[string]string{
-		"message": "User deleted successfully",
+	writeDeletion(w, r, user.ID)
+}
+
+// RenameUserHandler changes the authenticated user's username and returns a new token
+// carrying it. Existing tokens stay valid, as they identify the user by ID.
+// The previous username stays reserved for the user for a cooldown period.
+// This handler has JWT Middleware; no need to check token manually
+func RenameUserHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*util.Claims)
+
+	var req RenameRequest
+	err := decodeRequest(w, r, &req)
+	if err != nil {
+		writeRequestError(w, r, err)
+		return
+	}
+
+	if util.IsReservedUsername(req.Username) {
+		writeRequestError(w, r, reservedUsernameError())
+		return
+	}
+
+	err = store.RenameUser(r.Context(), claims.UserID(), req.Username)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	user, err := store.GetUserByID(r.Context(), claims.UserID())
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	recordAudit(r, audit.TypeUsernameChange, user.ID, map[string]string{"username": user.Username})
+
+	// Issue a token carrying the new username
+	token, err := issueToken(user)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"token":    token,
+		"username": user.Username,
+		"message":  "Username changed successfully",
 	})
+}
+
+// reservedUsernameError returns the field error sent when a reserved username is requested.
+func reservedUsernameError() error {
+	return validate.Errors{{Field: "username", Code: validate.CodeReserved, Message: "is reserved"}}
+}
+
+// newUserResponse converts a store user into the profile returned to the user.
+func newUserResponse(user store.User) userResponse {
+	return userResponse{
+		ID:          user.ID,
+		Username:    user.Username,
+		Email:       user.Email,
+		DisplayName: user.DisplayName,
+		Locale:      user.Locale,
+		Timezone:    user.Timezone,
+		Settings:    user.Settings,
+		Avatar:      avatarURLs(user),
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+		LastLoginAt: optionalTime(user.LastLoginAt),
+	}
+}
+
+// optionalTime returns a pointer to t, or nil if t is the zero time, so unset times are sent as null.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// writeDeletion responds to the deletion of the user identified by id with the time
+// at which they will be permanently erased, unless restored before.
+func writeDeletion(w http.ResponseWriter, r *http.Request, id int) {
+	user, err := store.GetUserByID(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.WriteError(w, r, err)
+		return
 	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"message":  "User scheduled for deletion",
+		"purge_at": user.PurgeAt(),
+	})
 }
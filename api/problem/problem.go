@@ -0,0 +1,132 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"user-api/api/validate"
+	"user-api/requestid"
+	"user-api/store"
+)
+
+// ContentType is the media type of problem details responses (RFC 7807).
+const ContentType = "application/problem+json"
+
+// Stable error codes used by handlers and middlewares, in addition to the codes of store errors.
+const (
+	CodeInvalidPayload       = "invalid_payload"
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeValidationFailed     = "validation_failed"
+	CodeInvalidParameter     = "invalid_parameter"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodePreconditionRequired = "precondition_required"
+	CodePreconditionFailed   = "precondition_failed"
+	CodeInvalidImage         = "invalid_image"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeOwnAccount           = "own_account"
+	CodeInternal             = "internal_error"
+
+	CodeInvalidCredentials    = "invalid_credentials"
+	CodeAccountDisabled       = "account_disabled"
+	CodePasswordResetRequired = "password_reset_required"
+	CodeTokenMissing          = "token_missing"
+	CodeTokenInvalid          = "token_invalid"
+	CodeTokenBlacklisted      = "token_blacklisted"
+	CodeTokenRevoked          = "token_revoked"
+)
+
+// Problem is a problem details object as defined by RFC 7807, extended with a
+// stable error code, the ID of the request and, for validation problems, the
+// list of invalid fields.
+type Problem struct {
+	Type      string                `json:"type"`
+	Title     string                `json:"title"`
+	Status    int                   `json:"status"`
+	Detail    string                `json:"detail,omitempty"`
+	Instance  string                `json:"instance,omitempty"`
+	Code      string                `json:"code"`
+	RequestID string                `json:"request_id"`
+	Errors    []validate.FieldError `json:"errors,omitempty"`
+}
+
+// Write sends a problem details response with the given status, error code and detail.
+// The detail is shown to clients, so it must not contain internal information.
+func Write(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	write(w, r, &Problem{
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	})
+}
+
+// WriteError sends a problem details response describing err:
+// - validation errors are sent as 422 Unprocessable Entity with the list of invalid fields,
+// - store errors are sent with their code and a status matching their kind
+// (404 Not Found, 409 Conflict, 412 Precondition Failed or 422 Unprocessable Entity),
+// - any other error is sent as a 500 Internal Server Error without revealing its message.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	var fieldErrs validate.Errors
+	var storeErr *store.Error
+
+	switch {
+	case errors.As(err, &fieldErrs):
+		write(w, r, &Problem{
+			Status: http.StatusUnprocessableEntity,
+			Code:   CodeValidationFailed,
+			Detail: "The request contains invalid fields",
+			Errors: fieldErrs,
+		})
+	case errors.As(err, &storeErr):
+		write(w, r, &Problem{
+			Status: statusForKind(storeErr.Kind),
+			Code:   storeErr.Code,
+			Detail: storeErr.Message,
+		})
+	default:
+		Write(w, r, http.StatusInternalServerError, CodeInternal, "An internal error occurred")
+	}
+}
+
+// statusForKind maps the kind of a store error to an HTTP status code.
+func statusForKind(kind error) int {
+	switch kind {
+	case store.ErrNotFound:
+		return http.StatusNotFound
+	case store.ErrConflict:
+		return http.StatusConflict
+	case store.ErrValidation:
+		return http.StatusUnprocessableEntity
+	case store.ErrPrecondition:
+		return http.StatusPreconditionFailed
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// write fills in the common members of p and sends it.
+func write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	p.Type = "about:blank"
+	p.Title = http.StatusText(p.Status)
+	p.Instance = r.URL.Path
+	p.RequestID = requestID(w, r)
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// requestID returns the ID given to the request by the RequestID middleware. Requests
+// that didn't go through it get a new ID, which is echoed in the response so clients
+// can report it.
+func requestID(w http.ResponseWriter, r *http.Request) string {
+	id := requestid.FromContext(r.Context())
+	if id == "" {
+		id = requestid.New()
+	}
+	w.Header().Set(requestid.Header, id)
+	return id
+}
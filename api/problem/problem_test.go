@@ -0,0 +1,99 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-api/api/validate"
+	"user-api/requestid"
+	"user-api/store"
+)
+
+// TestWriteError tests the status, code and detail sent for each kind of error.
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		err        error
+		statusCode int
+		code       string
+		detail     string
+		fields     int
+	}{
+		{store.ErrUserNotFound, http.StatusNotFound, "user_not_found", "user not found", 0},
+		{store.ErrEmailTaken, http.StatusConflict, "email_taken", "email already exists", 0},
+		{store.ErrVersionMismatch, http.StatusPreconditionFailed, "version_mismatch", "user was modified concurrently", 0},
+		{store.ErrRoleRequired, http.StatusUnprocessableEntity, "role_required", "at least one role is required", 0},
+		{fmt.Errorf("renaming: %w", store.ErrUsernameTaken), http.StatusConflict, "username_taken", "username already exists", 0},
+		{&store.Error{Kind: errors.New("unknown kind"), Code: "odd", Message: "odd"}, http.StatusInternalServerError, "odd", "odd", 0},
+		{validate.Errors{{Field: "email", Code: "invalid", Message: "is invalid"}, {Field: "password", Code: "too_short", Message: "is too short"}},
+			http.StatusUnprocessableEntity, CodeValidationFailed, "The request contains invalid fields", 2},
+		// Internal errors don't leak their message
+		{errors.New("dial tcp 10.0.0.5:5432: connection refused"), http.StatusInternalServerError, CodeInternal, "An internal error occurred", 0},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/v1/users/me", nil)
+		rr := httptest.NewRecorder()
+		WriteError(rr, req, test.err)
+
+		if rr.Code != test.statusCode {
+			t.Errorf("Expected status code %v for %v, but got %v", test.statusCode, test.err, rr.Code)
+		}
+		var p Problem
+		if err := json.NewDecoder(rr.Body).Decode(&p); err != nil {
+			t.Fatalf("Could not decode problem for %v: %v", test.err, err)
+		}
+		if p.Status != test.statusCode || p.Code != test.code || p.Detail != test.detail || len(p.Errors) != test.fields {
+			t.Errorf("Unexpected problem %+v for %v", p, test.err)
+		}
+	}
+}
+
+// TestWrite tests the common members and headers of problem responses, and that the
+// request ID is taken from the context or generated.
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		requestID string
+	}{
+		{"client-id-1"},
+		{""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("DELETE", "/v1/admin/users/7", nil)
+		if test.requestID != "" {
+			req = req.WithContext(requestid.NewContext(req.Context(), test.requestID))
+		}
+		rr := httptest.NewRecorder()
+		Write(rr, req, http.StatusPreconditionRequired, CodePreconditionRequired, "If-Match required")
+
+		if rr.Header().Get("Content-Type") != ContentType || rr.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Errorf("Unexpected headers %v", rr.Header())
+		}
+		var p Problem
+		if err := json.NewDecoder(rr.Body).Decode(&p); err != nil {
+			t.Fatalf("Could not decode problem: %v", err)
+		}
+		expected := Problem{
+			Type:     "about:blank",
+			Title:    "Precondition Required",
+			Status:   http.StatusPreconditionRequired,
+			Detail:   "If-Match required",
+			Instance: "/v1/admin/users/7",
+			Code:     CodePreconditionRequired,
+		}
+		if p.Type != expected.Type || p.Title != expected.Title || p.Status != expected.Status ||
+			p.Detail != expected.Detail || p.Instance != expected.Instance || p.Code != expected.Code {
+			t.Errorf("Expected %+v, but got %+v", expected, p)
+		}
+
+		if test.requestID != "" && p.RequestID != test.requestID {
+			t.Errorf("Expected request ID %q, but got %q", test.requestID, p.RequestID)
+		}
+		if !requestid.Valid(p.RequestID) || rr.Header().Get(requestid.Header) != p.RequestID {
+			t.Errorf("Expected request ID %q in the %s header, but got %q", p.RequestID, requestid.Header, rr.Header().Get(requestid.Header))
+		}
+	}
+}
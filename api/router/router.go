@@ -0,0 +1,91 @@
+package router
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"user-api/api/problem"
+)
+
+// Router dispatches requests by path and method. Paths are http.ServeMux patterns without
+// a method, and may contain wildcards such as {id}, which handlers read with r.PathValue.
+// Requests for a known path with a method that has no handler get a 405 Method Not Allowed
+// problem with an Allow header, and requests for unknown paths get a 404 Not Found problem.
+type Router struct {
+	mux    *http.ServeMux
+	routes map[string]map[string]http.HandlerFunc // Handlers by pattern and method
+}
+
+// New returns a Router without routes.
+func New() *Router {
+	return &Router{
+		mux:    http.NewServeMux(),
+		routes: make(map[string]map[string]http.HandlerFunc),
+	}
+}
+
+// Handle registers handler for requests to pattern with the given method.
+// Routes must all be registered before the router starts serving requests.
+func (rt *Router) Handle(method, pattern string, handler http.HandlerFunc) {
+	handlers, ok := rt.routes[pattern]
+	if !ok {
+		handlers = make(map[string]http.HandlerFunc)
+		rt.routes[pattern] = handlers
+		rt.mux.HandleFunc(pattern, rt.dispatch(handlers))
+	}
+	handlers[method] = handler
+}
+
+// ServeHTTP implements http.Handler.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, pattern := rt.mux.Handler(r); pattern == "" {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "No resource at "+r.URL.Path)
+		return
+	}
+	rt.mux.ServeHTTP(w, r)
+}
+
+// Route returns the pattern matching the request's path, or an empty string if none does.
+func (rt *Router) Route(r *http.Request) string {
+	_, pattern := rt.mux.Handler(r)
+	return pattern
+}
+
+// dispatch returns the handler for a pattern, which selects the handler for the request method.
+// HEAD requests are served by the GET handler. OPTIONS requests without a handler of their own
+// are passed to the handler of the first allowed method, whose CORS middleware answers them.
+func (rt *Router) dispatch(handlers map[string]http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		method := r.Method
+		if _, ok := handlers[method]; !ok && method == http.MethodHead {
+			method = http.MethodGet
+		}
+		if handler, ok := handlers[method]; ok {
+			handler(w, r)
+			return
+		}
+
+		allowed := allowedMethods(handlers)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		if r.Method == http.MethodOptions {
+			handlers[allowed[0]](w, r)
+			return
+		}
+		problem.Write(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+	}
+}
+
+// allowedMethods returns the sorted methods with a handler, including HEAD if GET has one.
+func allowedMethods(handlers map[string]http.HandlerFunc) []string {
+	methods := make([]string, 0, len(handlers)+1)
+	for method := range handlers {
+		methods = append(methods, method)
+	}
+	if _, ok := handlers[http.MethodGet]; ok {
+		if _, ok := handlers[http.MethodHead]; !ok {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
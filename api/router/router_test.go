@@ -0,0 +1,70 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-api/api/problem"
+)
+
+func TestRouter(t *testing.T) {
+	rt := New()
+	respond := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(body + r.PathValue("id")))
+		}
+	}
+	rt.Handle(http.MethodGet, "/v1/users/me", respond("get"))
+	rt.Handle(http.MethodDelete, "/v1/users/me", respond("delete"))
+	rt.Handle(http.MethodGet, "/v1/admin/users/{id}", respond("user "))
+
+	tests := []struct {
+		method     string
+		path       string
+		statusCode int
+		body       string
+		allow      string
+	}{
+		{"GET", "/v1/users/me", http.StatusOK, "get", ""},
+		{"DELETE", "/v1/users/me", http.StatusOK, "delete", ""},
+		{"HEAD", "/v1/users/me", http.StatusOK, "", ""},
+		{"POST", "/v1/users/me", http.StatusMethodNotAllowed, "", "DELETE, GET, HEAD"},
+		{"OPTIONS", "/v1/users/me", http.StatusOK, "delete", "DELETE, GET, HEAD"},
+		{"GET", "/v1/admin/users/42", http.StatusOK, "user 42", ""},
+		{"GET", "/v1/unknown", http.StatusNotFound, "", ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		rr := httptest.NewRecorder()
+		rt.ServeHTTP(rr, req)
+
+		if rr.Code != test.statusCode {
+			t.Errorf("%s %s: expected status code %v, but got %v", test.method, test.path, test.statusCode, rr.Code)
+			continue
+		}
+		if got := rr.Header().Get("Allow"); got != test.allow {
+			t.Errorf("%s %s: expected Allow header %q, but got %q", test.method, test.path, test.allow, got)
+		}
+		if test.statusCode >= 400 {
+			if got := rr.Header().Get("Content-Type"); got != problem.ContentType {
+				t.Errorf("%s %s: expected problem details, but got content type %q", test.method, test.path, got)
+			}
+		} else if test.method != "HEAD" && rr.Body.String() != test.body {
+			t.Errorf("%s %s: expected body %q, but got %q", test.method, test.path, test.body, rr.Body.String())
+		}
+	}
+}
+
+// TestRoute tests that requests are mapped to the pattern they match.
+func TestRoute(t *testing.T) {
+	rt := New()
+	rt.Handle(http.MethodGet, "/v1/admin/users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+
+	if route := rt.Route(httptest.NewRequest("DELETE", "/v1/admin/users/42", nil)); route != "/v1/admin/users/{id}" {
+		t.Errorf("Expected route /v1/admin/users/{id}, but got %q", route)
+	}
+	if route := rt.Route(httptest.NewRequest("GET", "/v1/unknown", nil)); route != "" {
+		t.Errorf("Expected no route, but got %q", route)
+	}
+}
@@ -0,0 +1,200 @@
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+	_ "time/tzdata" // Time zones are validated the same way on hosts without a tz database
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+)
+
+// Limits enforced by the validators.
+const (
+	MinUsernameLength    = 3
+	MaxUsernameLength    = 32
+	MaxEmailLength       = 254
+	MinPasswordLength    = 8
+	MaxPasswordLength    = 128
+	MaxDisplayNameLength = 64
+)
+
+// Error codes used in FieldError.Code. Clients can rely on these staying stable.
+const (
+	CodeRequired     = "required"
+	CodeTooShort     = "too_short"
+	CodeTooLong      = "too_long"
+	CodeInvalidChars = "invalid_characters"
+	CodeInvalidEmail = "invalid_email"
+	CodeUnknownField = "unknown_field"
+	CodeInvalidType  = "invalid_type"
+	CodeInvalid      = "invalid"
+	CodeReserved     = "reserved"
+)
+
+// FieldError describes a single problem with a field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Errors is a list of field errors. It implements error so it can be returned
+// from functions that validate a request.
+type Errors []FieldError
+
+// Error implements error, joining the messages of all field errors.
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fe := range e {
+		messages[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Validator collects field errors while a request is being checked, so that all
+// problems are reported at once rather than one at a time.
+type Validator struct {
+	errors Errors
+}
+
+// New returns an empty Validator.
+func New() *Validator {
+	return &Validator{}
+}
+
+// Add records an error for field.
+func (v *Validator) Add(field, code, message string) {
+	v.errors = append(v.errors, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Err returns the collected errors, or nil if there are none.
+func (v *Validator) Err() error {
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return v.errors
+}
+
+// Required records an error if value is empty. It reports whether the value is present,
+// so callers can skip further checks on missing fields.
+func (v *Validator) Required(field, value string) bool {
+	if value == "" {
+		v.Add(field, CodeRequired, "is required")
+		return false
+	}
+	return true
+}
+
+// Username checks that value is 3 to 32 characters long and only contains letters,
+// digits, underscores, hyphens and dots, starting with a letter or digit.
+// Email-like usernames are rejected so logins by username or email stay unambiguous.
+func (v *Validator) Username(field, value string) {
+	if !v.Required(field, value) {
+		return
+	}
+
+	length := utf8.RuneCountInString(value)
+	if length < MinUsernameLength {
+		v.Add(field, CodeTooShort, fmt.Sprintf("must be at least %d characters", MinUsernameLength))
+		return
+	}
+	if length > MaxUsernameLength {
+		v.Add(field, CodeTooLong, fmt.Sprintf("must be at most %d characters", MaxUsernameLength))
+		return
+	}
+
+	for i, r := range value {
+		valid := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if i > 0 {
+			valid = valid || r == '_' || r == '-' || r == '.'
+		}
+		if !valid {
+			v.Add(field, CodeInvalidChars, "may only contain letters, digits, '_', '-' and '.', and must start with a letter or digit")
+			return
+		}
+	}
+}
+
+// Email checks that value is a single RFC 5322 address without a display name,
+// e.g. "user@example.com" but not "User <user@example.com>".
+func (v *Validator) Email(field, value string) {
+	if !v.Required(field, value) {
+		return
+	}
+	if len(value) > MaxEmailLength {
+		v.Add(field, CodeTooLong, fmt.Sprintf("must be at most %d characters", MaxEmailLength))
+		return
+	}
+
+	addr, err := mail.ParseAddress(value)
+	if err != nil || addr.Name != "" || addr.Address != value {
+		v.Add(field, CodeInvalidEmail, "must be a valid email address")
+	}
+}
+
+// Password checks that value is between 8 and 128 characters long.
+func (v *Validator) Password(field, value string) {
+	if !v.Required(field, value) {
+		return
+	}
+
+	length := utf8.RuneCountInString(value)
+	if length < MinPasswordLength {
+		v.Add(field, CodeTooShort, fmt.Sprintf("must be at least %d characters", MinPasswordLength))
+	} else if length > MaxPasswordLength {
+		v.Add(field, CodeTooLong, fmt.Sprintf("must be at most %d characters", MaxPasswordLength))
+	}
+}
+
+// DisplayName checks that value is at most 64 characters long and contains no control
+// or invisible formatting characters. Empty values are allowed; they clear the display name.
+func (v *Validator) DisplayName(field, value string) {
+	if utf8.RuneCountInString(value) > MaxDisplayNameLength {
+		v.Add(field, CodeTooLong, fmt.Sprintf("must be at most %d characters", MaxDisplayNameLength))
+		return
+	}
+	for _, r := range value {
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			v.Add(field, CodeInvalidChars, "may not contain control or formatting characters")
+			return
+		}
+	}
+}
+
+// Locale checks that value is a well-formed BCP 47 language tag, e.g. "en" or "pt-BR".
+func (v *Validator) Locale(field, value string) {
+	if !v.Required(field, value) {
+		return
+	}
+	if _, err := language.Parse(value); err != nil {
+		v.Add(field, CodeInvalid, "must be a BCP 47 language tag, e.g. en-US")
+	}
+}
+
+// Timezone checks that value is the name of an IANA time zone, e.g. "Europe/Paris" or "UTC".
+func (v *Validator) Timezone(field, value string) {
+	if !v.Required(field, value) {
+		return
+	}
+	if value == "Local" {
+		v.Add(field, CodeInvalid, "must be an IANA time zone, e.g. Europe/Paris")
+		return
+	}
+	if _, err := time.LoadLocation(value); err != nil {
+		v.Add(field, CodeInvalid, "must be an IANA time zone, e.g. Europe/Paris")
+	}
+}
+
+// OneOf checks that value is one of the allowed values.
+func (v *Validator) OneOf(field, value string, allowed []string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.Add(field, CodeInvalid, "must be one of "+strings.Join(allowed, ", "))
+}
@@ -0,0 +1,156 @@
+package validate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// codes returns the error codes collected by v, or nil if it has none.
+func codes(v *Validator) []string {
+	var errs Errors
+	if !errors.As(v.Err(), &errs) {
+		return nil
+	}
+	result := make([]string, len(errs))
+	for i, fe := range errs {
+		result[i] = fe.Code
+	}
+	return result
+}
+
+func TestUsername(t *testing.T) {
+	tests := []struct {
+		username string
+		code     string
+	}{
+		{"alice", ""},
+		{"Alice_Smith-1.0", ""},
+		{"zoë", ""},
+		{"", CodeRequired},
+		{"al", CodeTooShort},
+		{strings.Repeat("a", 33), CodeTooLong},
+		{"alice smith", CodeInvalidChars},
+		{"alice@example.com", CodeInvalidChars},
+		{"_alice", CodeInvalidChars},
+	}
+
+	for _, tt := range tests {
+		v := New()
+		v.Username("username", tt.username)
+
+		got := codes(v)
+		if tt.code == "" && got != nil {
+			t.Errorf("Expected %q to be valid, got %v", tt.username, got)
+		} else if tt.code != "" && (len(got) != 1 || got[0] != tt.code) {
+			t.Errorf("Expected %q to fail with %s, got %v", tt.username, tt.code, got)
+		}
+	}
+}
+
+func TestEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		code  string
+	}{
+		{"user@example.com", ""},
+		{"first.last+tag@sub.example.org", ""},
+		{"", CodeRequired},
+		{"not-an-email", CodeInvalidEmail},
+		{"User <user@example.com>", CodeInvalidEmail},
+		{"user@", CodeInvalidEmail},
+		{" user@example.com", CodeInvalidEmail},
+		{strings.Repeat("a", 250) + "@example.com", CodeTooLong},
+	}
+
+	for _, tt := range tests {
+		v := New()
+		v.Email("email", tt.email)
+
+		got := codes(v)
+		if tt.code == "" && got != nil {
+			t.Errorf("Expected %q to be valid, got %v", tt.email, got)
+		} else if tt.code != "" && (len(got) != 1 || got[0] != tt.code) {
+			t.Errorf("Expected %q to fail with %s, got %v", tt.email, tt.code, got)
+		}
+	}
+}
+
+func TestPassword(t *testing.T) {
+	tests := []struct {
+		password string
+		code     string
+	}{
+		{"correct horse", ""},
+		{"", CodeRequired},
+		{"short", CodeTooShort},
+		{strings.Repeat("p", 129), CodeTooLong},
+	}
+
+	for _, tt := range tests {
+		v := New()
+		v.Password("password", tt.password)
+
+		got := codes(v)
+		if tt.code == "" && got != nil {
+			t.Errorf("Expected %q to be valid, got %v", tt.password, got)
+		} else if tt.code != "" && (len(got) != 1 || got[0] != tt.code) {
+			t.Errorf("Expected %q to fail with %s, got %v", tt.password, tt.code, got)
+		}
+	}
+}
+
+// TestValidatorCollectsAllErrors tests that every invalid field is reported at once.
+func TestValidatorCollectsAllErrors(t *testing.T) {
+	v := New()
+	v.Username("username", "")
+	v.Email("email", "nope")
+	v.Password("password", "pw")
+
+	var errs Errors
+	if !errors.As(v.Err(), &errs) {
+		t.Fatal("Expected validation errors, but got none")
+	}
+	if len(errs) != 3 {
+		t.Fatalf("Expected 3 field errors, got %d: %v", len(errs), errs)
+	}
+	if errs[1].Field != "email" || errs[1].Code != CodeInvalidEmail {
+		t.Errorf("Unexpected field error: %+v", errs[1])
+	}
+
+	if New().Err() != nil {
+		t.Error("Expected no error from an empty validator")
+	}
+}
+
+func TestProfileFields(t *testing.T) {
+	tests := []struct {
+		check func(v *Validator)
+		code  string
+	}{
+		{func(v *Validator) { v.DisplayName("display_name", "Zoë Smith") }, ""},
+		{func(v *Validator) { v.DisplayName("display_name", "") }, ""},
+		{func(v *Validator) { v.DisplayName("display_name", strings.Repeat("a", 65)) }, CodeTooLong},
+		{func(v *Validator) { v.DisplayName("display_name", "Zoë\u202eSmith") }, CodeInvalidChars},
+		{func(v *Validator) { v.Locale("locale", "pt-BR") }, ""},
+		{func(v *Validator) { v.Locale("locale", "not a locale") }, CodeInvalid},
+		{func(v *Validator) { v.Timezone("timezone", "Europe/Paris") }, ""},
+		{func(v *Validator) { v.Timezone("timezone", "Mars/Olympus") }, CodeInvalid},
+		{func(v *Validator) { v.Timezone("timezone", "Local") }, CodeInvalid},
+		{func(v *Validator) { v.Timezone("timezone", "") }, CodeRequired},
+		{func(v *Validator) { v.OneOf("theme", "dark", []string{"light", "dark"}) }, ""},
+		{func(v *Validator) { v.OneOf("theme", "pink", []string{"light", "dark"}) }, CodeInvalid},
+	}
+
+	for i, tt := range tests {
+		v := New()
+		tt.check(v)
+
+		got := codes(v)
+		if tt.code == "" && got != nil {
+			t.Errorf("Case %d: expected no errors, got %v", i, got)
+		} else if tt.code != "" && (len(got) != 1 || got[0] != tt.code) {
+			t.Errorf("Case %d: expected %s, got %v", i, tt.code, got)
+		}
+	}
+}
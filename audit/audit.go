@@ -0,0 +1,227 @@
+// Package audit records security-relevant events, such as logins and account changes,
+// as an append-only stream. Every event carries the hash of the event before it, so
+// altering, reordering or removing an event in the middle of the stream breaks the chain
+// and is detected by Verify. The chain is not keyed: it doesn't detect the most recent
+// events being cut off, or the whole stream being rewritten with new hashes, so sinks
+// meant to be tamper-evident must be copied somewhere an attacker can't write to.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+	"user-api/requestid"
+	"user-api/util"
+)
+
+// Event types.
+const (
+	TypeRegister       = "account.register"
+	TypeLogin          = "auth.login"
+	TypeLogout         = "auth.logout"
+	TypeProfileUpdate  = "account.profile_update"
+	TypeEmailChange    = "account.email_change"
+	TypePasswordChange = "account.password_change"
+	TypeUsernameChange = "account.username_change"
+	TypeAvatarChange   = "account.avatar_change"
+	TypeDelete         = "account.delete"
+	TypeRestore        = "account.restore"
+	TypeExport         = "account.export"
+	TypePurge          = "account.purge"
+	TypeAdminCreate    = "admin.user_create"
+	TypeAdminEmail     = "admin.email_change"
+	TypeAdminReset     = "admin.password_reset"
+	TypeAdminDisable   = "admin.user_disable"
+	TypeAdminEnable    = "admin.user_enable"
+	TypeAdminDelete    = "admin.user_delete"
+	TypeAdminRestore   = "admin.user_restore"
+	TypeAdminTokens    = "admin.tokens_revoke"
+	TypeAdminRoles     = "admin.roles_change"
+	TypeAdminPerms     = "admin.permissions_change"
+)
+
+// Outcome tells whether the audited action succeeded.
+type Outcome string
+
+const (
+	Success Outcome = "success"
+	Failure Outcome = "failure"
+)
+
+// Event is a single entry of the audit stream.
+type Event struct {
+	Seq       uint64            `json:"seq"` // Position in the stream, starting at 1
+	Time      time.Time         `json:"time"`
+	Type      string            `json:"type"`                // One of the Type constants
+	ActorID   int               `json:"actor_id,omitempty"`  // User performing the action; 0 if unauthenticated
+	TargetID  int               `json:"target_id,omitempty"` // User the action applies to; 0 if unknown
+	IP        string            `json:"ip,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty"`
+	RequestID string            `json:"request_id,omitempty"` // ID of the request that caused the event
+	Outcome   Outcome           `json:"outcome"`
+	Reason    string            `json:"reason,omitempty"`  // Error code of failed actions
+	Details   map[string]string `json:"details,omitempty"` // Event-specific context, never secrets
+	PrevHash  string            `json:"prev_hash"`         // Hash of the previous event; empty for the first
+	Hash      string            `json:"hash"`              // Hash of this event, including PrevHash
+}
+
+// Sink receives every recorded event, in order.
+type Sink interface {
+	Write(e Event) error
+}
+
+// Resumer is implemented by sinks that persist events, so a new process continues
+// the chain after the last event they hold instead of starting a new one.
+type Resumer interface {
+	Last() (Event, bool)
+}
+
+// queueSize is how many recorded events may wait for the sinks before Record blocks.
+const queueSize = 1024
+
+var (
+	mutex    sync.Mutex
+	sinks    []Sink
+	seq      uint64
+	lastHash string
+	queue    chan Event    // Events waiting to be written to the sinks, in order; nil without sinks
+	written  chan struct{} // Closed once the writer has written every event of queue
+)
+
+// SetSinks replaces the sinks events are written to, once the events already recorded
+// were written to the previous ones. The chain continues after the last event held by
+// the first sink implementing Resumer, if any.
+func SetSinks(s ...Sink) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	drain()
+	sinks = s
+	seq, lastHash = 0, ""
+	for _, sink := range s {
+		if resumer, ok := sink.(Resumer); ok {
+			if last, ok := resumer.Last(); ok {
+				seq, lastHash = last.Seq, last.Hash
+			}
+			break
+		}
+	}
+	if len(s) > 0 {
+		queue, written = make(chan Event, queueSize), make(chan struct{})
+		go write(s, queue, written)
+	}
+}
+
+// Close waits until the events already recorded are written, then closes the sinks
+// holding resources, such as files, and stops writing events to any sink. Events
+// recorded afterwards still advance the chain but are not stored.
+func Close() error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	drain()
+	var errs []error
+	for _, sink := range sinks {
+		if closer, ok := sink.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	sinks = nil
+	return errors.Join(errs...)
+}
+
+// drain stops the writer once it has written every queued event. The mutex must be held.
+func drain() {
+	if queue == nil {
+		return
+	}
+	close(queue)
+	<-written
+	queue, written = nil, nil
+}
+
+// write writes the events of queue to the sinks in order until queue is closed, then
+// closes written. Sink failures are logged.
+func write(sinks []Sink, queue <-chan Event, written chan<- struct{}) {
+	defer close(written)
+	for e := range queue {
+		for _, sink := range sinks {
+			if err := sink.Write(e); err != nil {
+				slog.Error("failed to write audit event", "seq", e.Seq, "type", e.Type, "error", err)
+			}
+		}
+	}
+}
+
+// Record appends an event to the stream, taking the client's IP address, user agent and
+// request ID from r, which may be nil. The time, sequence number and hashes are set by Record, and
+// the outcome defaults to Success. The event is written to the sinks in the background,
+// so slow sinks, such as a file synced on every event, don't hold up requests; Record
+// only blocks once queueSize events are waiting. Sink failures are logged rather than
+// returned, so auditing never prevents the audited action.
+func Record(r *http.Request, e Event) {
+	if r != nil {
+		e.IP = util.ClientIP(r)
+		e.UserAgent = r.UserAgent()
+		e.RequestID = requestid.FromContext(r.Context())
+	}
+	if e.Outcome == "" {
+		e.Outcome = Success
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	seq++
+	e.Seq = seq
+	e.Time = time.Now().UTC()
+	e.PrevHash = lastHash
+	e.Hash = hash(e)
+	lastHash = e.Hash
+
+	// Queued under the mutex, so events reach the sinks in sequence order
+	if queue != nil {
+		queue <- e
+	}
+}
+
+// Verify checks that events form an unbroken chain: every hash matches its event,
+// every event links to the one before it, and sequence numbers have no gaps.
+// events may start anywhere in the stream. It returns an error describing the first break.
+func Verify(events []Event) error {
+	for i, e := range events {
+		if e.Hash != hash(e) {
+			return fmt.Errorf("event %d: hash mismatch", e.Seq)
+		}
+		if i == 0 {
+			if e.Seq == 1 && e.PrevHash != "" {
+				return fmt.Errorf("event %d: first event links to a previous event", e.Seq)
+			}
+			continue
+		}
+		prev := events[i-1]
+		if e.Seq != prev.Seq+1 {
+			return fmt.Errorf("event %d: expected sequence number %d", e.Seq, prev.Seq+1)
+		}
+		if e.PrevHash != prev.Hash {
+			return fmt.Errorf("event %d: chain broken after event %d", e.Seq, prev.Seq)
+		}
+	}
+	return nil
+}
+
+// hash returns the hex-encoded SHA-256 of the event's JSON encoding without its own hash.
+// Map keys are encoded in sorted order, so the encoding is deterministic.
+func hash(e Event) string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,214 @@
+package audit
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memorySink collects events in memory.
+type memorySink struct {
+	events []Event
+}
+
+func (m *memorySink) Write(e Event) error {
+	m.events = append(m.events, e)
+	return nil
+}
+
+// TestRecord tests that recorded events are chained and carry the request's client details.
+func TestRecord(t *testing.T) {
+	sink := &memorySink{}
+	SetSinks(sink)
+
+	r := httptest.NewRequest("POST", "/v1/sessions", nil)
+	r.RemoteAddr = "203.0.113.7:52100"
+	r.Header.Set("User-Agent", "test-agent")
+	Record(r, Event{Type: TypeLogin, ActorID: 1, TargetID: 1})
+	Record(r, Event{Type: TypeLogin, TargetID: 1, Outcome: Failure, Reason: "invalid_credentials"})
+	Record(nil, Event{Type: TypePurge, TargetID: 1})
+	Close()
+
+	if len(sink.events) != 3 {
+		t.Fatalf("Expected 3 events, but got %d", len(sink.events))
+	}
+	first := sink.events[0]
+	if first.Seq != 1 || first.PrevHash != "" || first.Outcome != Success {
+		t.Fatalf("Unexpected first event: %+v", first)
+	}
+	if first.IP != "203.0.113.7" || first.UserAgent != "test-agent" {
+		t.Fatalf("Expected client details to be recorded, but got IP %q and user agent %q", first.IP, first.UserAgent)
+	}
+	if err := Verify(sink.events); err != nil {
+		t.Fatalf("Expected chain to verify, but got %v", err)
+	}
+
+	// Altering, removing or reordering events breaks the chain
+	altered := append([]Event(nil), sink.events...)
+	altered[1].Outcome = Success
+	if err := Verify(altered); err == nil {
+		t.Error("Expected altered event to be detected")
+	}
+	if err := Verify([]Event{sink.events[0], sink.events[2]}); err == nil {
+		t.Error("Expected removed event to be detected")
+	}
+	if err := Verify([]Event{sink.events[1], sink.events[0]}); err == nil {
+		t.Error("Expected reordered events to be detected")
+	}
+}
+
+// blockingSink collects events in memory once release is closed.
+type blockingSink struct {
+	memorySink
+	release chan struct{}
+}
+
+func (b *blockingSink) Write(e Event) error {
+	<-b.release
+	return b.memorySink.Write(e)
+}
+
+// TestRecordSlowSink tests that recording doesn't wait for slow sinks, and that Close
+// waits until every recorded event was written, in order.
+func TestRecordSlowSink(t *testing.T) {
+	sink := &blockingSink{release: make(chan struct{})}
+	SetSinks(sink)
+
+	recorded := make(chan struct{})
+	go func() {
+		for i := 1; i <= 10; i++ {
+			Record(nil, Event{Type: TypeLogin, TargetID: i})
+		}
+		close(recorded)
+	}()
+	select {
+	case <-recorded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Record not to wait for the sink")
+	}
+
+	close(sink.release)
+	if err := Close(); err != nil {
+		t.Fatalf("Expected sinks to close, but got %v", err)
+	}
+	if len(sink.events) != 10 {
+		t.Fatalf("Expected 10 events written before Close returned, but got %d", len(sink.events))
+	}
+	for i, e := range sink.events {
+		if e.TargetID != i+1 {
+			t.Fatalf("Expected events in recording order, but event %d targets %d", i, e.TargetID)
+		}
+	}
+	if err := Verify(sink.events); err != nil {
+		t.Fatalf("Expected chain to verify, but got %v", err)
+	}
+}
+
+// TestFileSink tests that the file sink resumes the chain when reopened and detects tampering.
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatalf("Failed to open file sink: %v", err)
+	}
+	SetSinks(sink)
+	Record(nil, Event{Type: TypeRegister, TargetID: 1})
+	Record(nil, Event{Type: TypeLogin, TargetID: 1})
+	Close()
+
+	// A new process continues the same chain
+	sink, err = NewFileSink(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen file sink: %v", err)
+	}
+	SetSinks(sink)
+	Record(nil, Event{Type: TypeLogout, TargetID: 1})
+	Close()
+
+	events, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	if len(events) != 3 || events[2].Seq != 3 {
+		t.Fatalf("Expected 3 chained events, but got %+v", events)
+	}
+	if err := Verify(events); err != nil {
+		t.Fatalf("Expected chain to verify after reopening, but got %v", err)
+	}
+
+	// Editing the file is detected when it is opened again
+	data, _ := os.ReadFile(path)
+	tampered := strings.Replace(string(data), `"target_id":1`, `"target_id":2`, 1)
+	if err := os.WriteFile(path, []byte(tampered), 0o640); err != nil {
+		t.Fatalf("Failed to tamper with audit log: %v", err)
+	}
+	if _, err := NewFileSink(path); !errors.Is(err, ErrChainBroken) {
+		t.Fatalf("Expected chain broken error, but got %v", err)
+	}
+	SetSinks()
+}
+
+// TestClose tests that Close closes the sinks and stops writing events to them.
+func TestClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatalf("Failed to open file sink: %v", err)
+	}
+	memory := &memorySink{}
+	SetSinks(sink, memory)
+	Record(nil, Event{Type: TypeLogin, TargetID: 1})
+
+	if err := Close(); err != nil {
+		t.Fatalf("Expected sinks to close, but got %v", err)
+	}
+	Record(nil, Event{Type: TypeLogout, TargetID: 1})
+	if len(memory.events) != 1 {
+		t.Fatalf("Expected no events written after Close, but got %d events", len(memory.events))
+	}
+	if err := sink.Close(); err == nil {
+		t.Error("Expected file to be closed")
+	}
+}
+
+// TestFileSinkTornWrite tests that an event left incomplete by a crash doesn't prevent
+// reopening the file, and that the chain continues after the last complete event.
+func TestFileSinkTornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatalf("Failed to open file sink: %v", err)
+	}
+	SetSinks(sink)
+	Record(nil, Event{Type: TypeLogin, TargetID: 1})
+	Close()
+
+	// A crash during the next write leaves half an event behind
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	file.WriteString(`{"seq":2,"time":"2026-`)
+	file.Close()
+
+	sink, err = NewFileSink(path)
+	if err != nil {
+		t.Fatalf("Expected incomplete event to be discarded, but got %v", err)
+	}
+	SetSinks(sink)
+	Record(nil, Event{Type: TypeLogout, TargetID: 1})
+	Close()
+
+	events, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	if len(events) != 2 || events[1].Type != TypeLogout {
+		t.Fatalf("Expected the first event followed by the new one, but got %+v", events)
+	}
+	if err := Verify(events); err != nil {
+		t.Fatalf("Expected chain to verify, but got %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrChainBroken is returned when stored events don't form an unbroken chain.
+var ErrChainBroken = errors.New("audit chain broken")
+
+// FileSink appends events to a file as JSON Lines. The file is only ever appended to.
+type FileSink struct {
+	mutex sync.Mutex
+	file  *os.File
+	last  *Event
+}
+
+// NewFileSink opens the JSON Lines file at path, creating it and its directory if needed.
+// The events already in the file are verified, and an error wrapping ErrChainBroken is
+// returned if they were altered, so tampering is noticed on startup. An unterminated last
+// line, left by a crash while an event was written, is logged and cut off instead.
+func NewFileSink(path string) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	events, torn, err := parseEvents(path, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := Verify(events); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrChainBroken, path, err)
+	}
+	if torn > 0 {
+		slog.Warn("discarding incomplete audit event", "path", path, "bytes", torn)
+		if err := os.Truncate(path, int64(len(data)-torn)); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	sink := &FileSink{file: file}
+	if len(events) > 0 {
+		sink.last = &events[len(events)-1]
+	}
+	return sink, nil
+}
+
+// Write implements Sink. Each event is synced to disk before Write returns.
+func (s *FileSink) Write(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	s.last = &e
+	return s.file.Sync()
+}
+
+// Last implements Resumer.
+func (s *FileSink) Last() (Event, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.last == nil {
+		return Event{}, false
+	}
+	return *s.last, true
+}
+
+// Close closes the file.
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// ReadFile returns the events stored in a JSON Lines file written by a FileSink.
+// An unterminated last line, left by a crash while an event was written, is ignored.
+func ReadFile(path string) ([]Event, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	events, _, err := parseEvents(path, data)
+	return events, err
+}
+
+// parseEvents parses the JSON Lines data read from the file at path. Every event is
+// written with its line break in one write, so only a crash mid-write leaves the last line
+// unterminated; torn is its length, and it is not parsed. Any other line that isn't an
+// event was altered, and an error wrapping ErrChainBroken is returned.
+func parseEvents(path string, data []byte) (events []Event, torn int, err error) {
+	if i := bytes.LastIndexByte(data, '\n'); i < len(data)-1 {
+		torn = len(data) - i - 1
+		data = data[:i+1]
+	}
+	for line := 1; len(data) > 0; line++ {
+		i := bytes.IndexByte(data, '\n')
+		var e Event
+		if err := json.Unmarshal(data[:i], &e); err != nil {
+			return nil, 0, fmt.Errorf("%w: %s:%d: %v", ErrChainBroken, path, line, err)
+		}
+		events = append(events, e)
+		data = data[i+1:]
+	}
+	return events, torn, nil
+}
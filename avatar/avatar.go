@@ -0,0 +1,161 @@
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// MaxDimension is the largest width or height accepted, which bounds the memory
+// needed to decode an image regardless of how well it compresses.
+const MaxDimension = 4096
+
+// Sizes are the names and side lengths, in pixels, of the square variants generated for every avatar.
+var Sizes = []struct {
+	Name string
+	Side int
+}{
+	{"small", 64},
+	{"medium", 256},
+	{"large", 512},
+}
+
+var (
+	// ErrUnsupportedType is returned for files that are not PNG, JPEG or GIF images,
+	// whatever content type the client declared.
+	ErrUnsupportedType = errors.New("avatar must be a PNG, JPEG or GIF image")
+	// ErrInvalidImage is returned for images that can't be decoded or are too large.
+	ErrInvalidImage = errors.New("avatar is not a valid image or is larger than 4096x4096 pixels")
+)
+
+// formats maps the content types detected from file contents to image formats.
+var formats = map[string]string{
+	"image/png":  "png",
+	"image/jpeg": "jpeg",
+	"image/gif":  "gif",
+}
+
+// Variant is an encoded, resized avatar image.
+type Variant struct {
+	Name        string // One of the names in Sizes
+	Side        int    // Width and height in pixels
+	ContentType string
+	Extension   string // File extension for the content type, without the dot
+	Data        []byte
+}
+
+// Process validates an uploaded avatar and returns its variants, one per entry of Sizes.
+// The content type is detected from the file contents rather than trusted from the client.
+// Images are cropped to a centered square and never scaled up. Variants are re-encoded
+// from the decoded pixels, so no metadata (EXIF, comments, color profiles) is kept;
+// JPEG sources produce JPEG variants and the others produce PNG, preserving transparency.
+// Only the first frame of animated GIFs is used.
+func Process(data []byte) ([]Variant, error) {
+	format, ok := formats[http.DetectContentType(data)]
+	if !ok {
+		return nil, ErrUnsupportedType
+	}
+
+	// Check the dimensions before decoding the pixels
+	config, decodedFormat, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || decodedFormat != format {
+		return nil, ErrInvalidImage
+	}
+	if config.Width < 1 || config.Height < 1 || config.Width > MaxDimension || config.Height > MaxDimension {
+		return nil, ErrInvalidImage
+	}
+
+	var img image.Image
+	switch format {
+	case "png":
+		img, err = png.Decode(bytes.NewReader(data))
+	case "jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(data))
+	case "gif":
+		img, err = gif.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	square := cropSquare(img)
+
+	variants := make([]Variant, 0, len(Sizes))
+	for _, size := range Sizes {
+		side := min(size.Side, square.Rect.Dx())
+		resized := resize(square, side)
+
+		variant := Variant{Name: size.Name, Side: side}
+		var buf bytes.Buffer
+		if format == "jpeg" {
+			variant.ContentType, variant.Extension = "image/jpeg", "jpg"
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85})
+		} else {
+			variant.ContentType, variant.Extension = "image/png", "png"
+			err = png.Encode(&buf, resized)
+		}
+		if err != nil {
+			return nil, err
+		}
+		variant.Data = buf.Bytes()
+		variants = append(variants, variant)
+	}
+	return variants, nil
+}
+
+// cropSquare returns the largest centered square of img as a non-premultiplied RGBA image.
+func cropSquare(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	origin := image.Pt(
+		bounds.Min.X+(bounds.Dx()-side)/2,
+		bounds.Min.Y+(bounds.Dy()-side)/2,
+	)
+
+	square := image.NewNRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(square, square.Rect, img, origin, draw.Src)
+	return square
+}
+
+// resize scales a square image down to side x side pixels by averaging the source pixels
+// covered by each destination pixel (a box filter), weighting colors by their alpha.
+func resize(src *image.NRGBA, side int) *image.NRGBA {
+	srcSide := src.Rect.Dx()
+	if side == srcSide {
+		return src
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, side, side))
+	for dy := 0; dy < side; dy++ {
+		y0, y1 := dy*srcSide/side, (dy+1)*srcSide/side
+		for dx := 0; dx < side; dx++ {
+			x0, x1 := dx*srcSide/side, (dx+1)*srcSide/side
+
+			var r, g, b, a, n uint64
+			for y := y0; y < y1; y++ {
+				row := src.Pix[y*src.Stride:]
+				for x := x0; x < x1; x++ {
+					p := row[x*4 : x*4+4]
+					alpha := uint64(p[3])
+					r += uint64(p[0]) * alpha
+					g += uint64(p[1]) * alpha
+					b += uint64(p[2]) * alpha
+					a += alpha
+					n++
+				}
+			}
+
+			q := dst.Pix[dy*dst.Stride+dx*4:]
+			if a > 0 {
+				q[0], q[1], q[2] = uint8(r/a), uint8(g/a), uint8(b/a)
+			}
+			q[3] = uint8(a / n)
+		}
+	}
+	return dst
+}
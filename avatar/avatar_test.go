@@ -0,0 +1,124 @@
+package avatar
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// testImage returns a width x height image with an opaque red left half and a transparent right half.
+func testImage(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width/2; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: 255, A: 255})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcess(t *testing.T) {
+	variants, err := Process(encodePNG(t, testImage(800, 600)))
+	if err != nil {
+		t.Fatalf("Failed to process PNG: %v", err)
+	}
+	if len(variants) != len(Sizes) {
+		t.Fatalf("Expected %d variants, but got %d", len(Sizes), len(variants))
+	}
+
+	for i, variant := range variants {
+		if variant.Name != Sizes[i].Name || variant.Side != Sizes[i].Side || variant.ContentType != "image/png" {
+			t.Errorf("Unexpected variant %s: %d pixels, %s", variant.Name, variant.Side, variant.ContentType)
+		}
+		img, err := png.Decode(bytes.NewReader(variant.Data))
+		if err != nil {
+			t.Fatalf("Variant %s is not a valid PNG: %v", variant.Name, err)
+		}
+		if img.Bounds().Dx() != variant.Side || img.Bounds().Dy() != variant.Side {
+			t.Errorf("Expected %s to be %dx%d, but got %v", variant.Name, variant.Side, variant.Side, img.Bounds())
+		}
+
+		// The centered crop keeps the red half on the left, and transparency is preserved
+		left := color.NRGBAModel.Convert(img.At(variant.Side/8, variant.Side/2)).(color.NRGBA)
+		right := color.NRGBAModel.Convert(img.At(variant.Side-1, variant.Side/2)).(color.NRGBA)
+		if left != (color.NRGBA{R: 255, A: 255}) || right.A != 0 {
+			t.Errorf("Unexpected pixels in %s: left %v, right %v", variant.Name, left, right)
+		}
+	}
+}
+
+// TestProcessSmallImage tests that images are never scaled up.
+func TestProcessSmallImage(t *testing.T) {
+	variants, err := Process(encodePNG(t, testImage(100, 120)))
+	if err != nil {
+		t.Fatalf("Failed to process PNG: %v", err)
+	}
+	if variants[0].Side != 64 || variants[1].Side != 100 || variants[2].Side != 100 {
+		t.Errorf("Unexpected sides %d, %d, %d", variants[0].Side, variants[1].Side, variants[2].Side)
+	}
+}
+
+// TestProcessStripsMetadata tests that JPEG variants don't keep the EXIF data of the upload.
+func TestProcessStripsMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(300, 300), nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	// Insert an APP1 EXIF segment, with a fake GPS tag, after the SOI marker
+	exif := []byte("Exif\x00\x00GPS 51.5007 N 0.1246 W")
+	segment := append([]byte{0xFF, 0xE1, 0, byte(len(exif) + 2)}, exif...)
+	data := append(append(append([]byte{}, buf.Bytes()[:2]...), segment...), buf.Bytes()[2:]...)
+
+	variants, err := Process(data)
+	if err != nil {
+		t.Fatalf("Failed to process JPEG: %v", err)
+	}
+	for _, variant := range variants {
+		if variant.ContentType != "image/jpeg" {
+			t.Errorf("Expected JPEG variants for a JPEG upload, but got %s", variant.ContentType)
+		}
+		if bytes.Contains(variant.Data, []byte("Exif")) || bytes.Contains(variant.Data, []byte("GPS")) {
+			t.Errorf("Variant %s still contains EXIF data", variant.Name)
+		}
+	}
+}
+
+func TestProcessRejectsInvalidFiles(t *testing.T) {
+	var gifData bytes.Buffer
+	palette := color.Palette{color.Black, color.White}
+	if err := gif.Encode(&gifData, image.NewPaletted(image.Rect(0, 0, 10, 10), palette), nil); err != nil {
+		t.Fatalf("Failed to encode GIF: %v", err)
+	}
+	if _, err := Process(gifData.Bytes()); err != nil {
+		t.Errorf("Expected GIF to be accepted, but got %v", err)
+	}
+
+	pngData := encodePNG(t, testImage(10, 10))
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"text", []byte("<svg xmlns='http://www.w3.org/2000/svg'></svg>"), ErrUnsupportedType},
+		{"empty", nil, ErrUnsupportedType},
+		{"truncated", pngData[:len(pngData)/2], ErrInvalidImage},
+		{"too wide", encodePNG(t, image.NewGray(image.Rect(0, 0, MaxDimension+1, 1))), ErrInvalidImage},
+	}
+	for _, test := range tests {
+		if _, err := Process(test.data); err != test.err {
+			t.Errorf("%s: expected %v, but got %v", test.name, test.err, err)
+		}
+	}
+}
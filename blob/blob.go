@@ -0,0 +1,61 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"user-api/config"
+)
+
+// Store stores files, such as avatar images, under slash-separated keys like "avatars/1/abc.png".
+type Store interface {
+	// Put stores data under key, replacing any existing file.
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Delete removes the file stored under key. Deleting a missing file is not an error.
+	Delete(ctx context.Context, key string) error
+	// URL returns the URL at which clients can download the file stored under key.
+	URL(key string) string
+}
+
+// ErrInvalidKey is returned for keys that are empty, absolute or contain "." or ".." segments.
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// New returns the store selected by BLOB_BACKEND.
+func New() (Store, error) {
+	switch config.C.BlobBackend {
+	case "", "local":
+		publicURL := config.C.BlobPublicURL
+		if publicURL == "" {
+			publicURL = "/media"
+		}
+		return NewLocal(config.C.BlobLocalDir, publicURL)
+	case "s3":
+		if config.C.S3Endpoint == "" || config.C.S3Bucket == "" || config.C.S3AccessKeyID == "" || config.C.S3SecretAccessKey == "" {
+			return nil, errors.New("S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY must be set for the s3 blob backend")
+		}
+		return &S3{
+			Endpoint:        config.C.S3Endpoint,
+			Region:          config.C.S3Region,
+			Bucket:          config.C.S3Bucket,
+			AccessKeyID:     config.C.S3AccessKeyID,
+			SecretAccessKey: config.C.S3SecretAccessKey,
+			PublicURL:       config.C.BlobPublicURL,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown blob backend %q", config.C.BlobBackend)
+	}
+}
+
+// validateKey returns ErrInvalidKey if key could escape the store's root.
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return ErrInvalidKey
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Local is a Store keeping files in a directory of the local filesystem.
+// Files are served by Handler under PublicURL.
+type Local struct {
+	Dir       string
+	PublicURL string // Base URL of the files, e.g. "/media" or "https://cdn.example.com"
+}
+
+// NewLocal returns a Local store for dir, creating the directory if needed.
+func NewLocal(dir, publicURL string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &Local{Dir: dir, PublicURL: strings.TrimSuffix(publicURL, "/")}, nil
+}
+
+// Put implements Store. The file is written to a temporary file first and then renamed,
+// so readers never see a partially written file.
+func (l *Local) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Delete implements Store.
+func (l *Local) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// URL implements Store.
+func (l *Local) URL(key string) string {
+	return l.PublicURL + "/" + key
+}
+
+// Handler serves the stored files. It must be mounted so that the request path,
+// after the prefix is stripped, is the key of a file. Files are never modified under
+// the same key, so responses may be cached indefinitely.
+func (l *Local) Handler() http.Handler {
+	files := http.FileServer(noDirFS{http.Dir(l.Dir)})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		files.ServeHTTP(w, r)
+	})
+}
+
+// path returns the filesystem path of key.
+func (l *Local) path(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(l.Dir, filepath.FromSlash(key)), nil
+}
+
+// noDirFS hides directories, so the file server doesn't list them.
+type noDirFS struct {
+	fs http.FileSystem
+}
+
+func (n noDirFS) Open(name string) (http.File, error) {
+	f, err := n.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		f.Close()
+		return nil, fs.ErrNotExist
+	}
+	return f, nil
+}
@@ -0,0 +1,65 @@
+package blob
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLocal(filepath.Join(dir, "blobs"), "/media/")
+	if err != nil {
+		t.Fatalf("Failed to create local store: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := l.Put(ctx, "avatars/1/abc-64.png", []byte("png data"), "image/png"); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+	if got := l.URL("avatars/1/abc-64.png"); got != "/media/avatars/1/abc-64.png" {
+		t.Errorf("Unexpected URL %s", got)
+	}
+
+	// Files are served by the handler, but directories aren't listed
+	server := httptest.NewServer(http.StripPrefix("/media", l.Handler()))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/media/avatars/1/abc-64.png")
+	if err != nil {
+		t.Fatalf("Failed to get file: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "png data" {
+		t.Fatalf("Expected file contents, but got %v %q", resp.StatusCode, body)
+	}
+	resp, err = http.Get(server.URL + "/media/avatars/1/")
+	if err != nil {
+		t.Fatalf("Failed to get directory: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected directory listing to be hidden, but got %v", resp.StatusCode)
+	}
+
+	if err := l.Delete(ctx, "avatars/1/abc-64.png"); err != nil {
+		t.Fatalf("Failed to delete file: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "blobs", "avatars", "1", "abc-64.png")); !os.IsNotExist(err) {
+		t.Fatalf("Expected file to be deleted, but got %v", err)
+	}
+	if err := l.Delete(ctx, "avatars/1/abc-64.png"); err != nil {
+		t.Fatalf("Deleting a missing file should not fail: %v", err)
+	}
+
+	for _, key := range []string{"", "/etc/passwd", "../outside", "avatars/../../outside", "avatars//1"} {
+		if err := l.Put(ctx, key, nil, "image/png"); err != ErrInvalidKey {
+			t.Errorf("Expected ErrInvalidKey for %q, but got %v", key, err)
+		}
+	}
+}
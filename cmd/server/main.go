@@ -1,49 +1,354 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"errors"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 	"user-api/api/handler"
+	"user-api/api/router"
+	"user-api/audit"
+	"user-api/blob"
 	"user-api/config"
+	"user-api/export"
+	"user-api/health"
+	"user-api/logging"
+	"user-api/metrics"
 	"user-api/middleware"
+	"user-api/notify"
+	"user-api/principal"
+	"user-api/servertls"
+	"user-api/store"
+	"user-api/tracing"
+	"user-api/util"
+)
+
+// The unversioned routes are deprecated in favour of the /v1 routes and may be removed after legacySunset.
+var (
+	legacyDeprecation = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	legacySunset      = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
 )
 
 type Middleware func(http.HandlerFunc) http.HandlerFunc
 
-// Chain applies middlewares in order to a http.HandlerFunc.
+// Chain applies middlewares to a http.HandlerFunc. Middlewares run in the order
+// given: the first one receives the request first and the handler runs last.
+// Each middleware and the handler run in a span of their own, named after their function.
 func Chain(f http.HandlerFunc, middlewares ...Middleware) http.HandlerFunc {
-	for _, m := range middlewares {
-		f = m(f)
+	f = middleware.Traced(funcName(f), f)
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		f = middleware.Traced(funcName(middlewares[i]), middlewares[i](f))
 	}
 	return f
 }
 
+// funcName returns the package-qualified name of a function, such as "handler.LoginHandler".
+// Closures are named after the function they were created in.
+func funcName(f any) string {
+	name := runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	for {
+		i := strings.LastIndex(name, ".func")
+		if i < 0 || strings.Trim(name[i+len(".func"):], "0123456789.") != "" {
+			return name
+		}
+		name = name[:i]
+	}
+}
+
 func main() {
 	// Config
-	config.Load()
+	err := config.Load()
+	logging.Setup()
+	if err != nil {
+		fatal("invalid configuration", err)
+	}
 	host, port := config.C.ServerHost, config.C.ServerPort
 	address := host + ":" + port
 
+	// Password hashing
+	if err := util.CheckPasswordConfig(); err != nil {
+		fatal("invalid password hashing configuration", err)
+	}
+
+	// Client addresses
+	if err := util.CheckProxyConfig(); err != nil {
+		fatal("invalid trusted proxies", err)
+	}
+
 	// Middlewares
 	commonMiddlewares := []Middleware{
 		middleware.LoggingMiddleware,
 		middleware.CORSMiddleware,
 	}
 
-	authMiddlewares := append(commonMiddlewares, middleware.JWTMiddleware)
+	authMiddlewares := []Middleware{
+		middleware.LoggingMiddleware,
+		middleware.CORSMiddleware,
+		middleware.JWTMiddleware,
+	}
+
+	// protected returns the auth middlewares followed by a check that the user holds all permissions.
+	// The full slice expression makes append copy, so routes never share a backing array.
+	protected := func(permissions ...string) []Middleware {
+		n := len(authMiddlewares)
+		return append(authMiddlewares[:n:n], middleware.RequirePermission(permissions...))
+	}
+
+	// adminOnly returns the auth middlewares followed by checks for the admin role and the given permissions.
+	adminOnly := func(permissions ...string) []Middleware {
+		return append(protected(permissions...), middleware.RequireRole(util.RoleAdmin))
+	}
+
+	// Blob storage
+	blobStore, err := blob.New()
+	if err != nil {
+		fatal("failed to open blob store", err)
+	}
+	handler.BlobStore = blobStore
+
+	// Tracing
+	if err := tracing.Setup(); err != nil {
+		fatal("failed to set up tracing", err)
+	}
+
+	// Notifications
+	notifier, err := notify.New()
+	if err != nil {
+		fatal("failed to set up notifier", err)
+	}
+	handler.Notifier = notifier
+
+	// Readiness checks
+	health.SetCacheTTL(config.C.HealthCheckCacheTTL)
+	health.Register("store", config.C.HealthCheckTimeout, store.Ping)
+	health.Register("signing_key", config.C.HealthCheckTimeout, func(ctx context.Context) error {
+		_, err := util.JWTKey()
+		return err
+	})
+	if pinger, ok := notifier.(notify.Pinger); ok {
+		health.Register("notifier", config.C.HealthCheckTimeout, pinger.Ping)
+	}
+
+	// TLS, terminated here unless TLS_CERT_FILE is empty
+	tlsConfig, certReloader, err := servertls.New()
+	if err != nil {
+		fatal("failed to set up TLS", err)
+	}
+	principals, err := principal.Parse(config.C.TLSClientPrincipals)
+	if err != nil {
+		fatal("failed to parse TLS_CLIENT_PRINCIPALS", err)
+	}
+
+	// Audit log
+	auditSinks := []audit.Sink{store.AuditSink{}}
+	if config.C.AuditLogFile != "" {
+		fileSink, err := audit.NewFileSink(config.C.AuditLogFile)
+		if err != nil {
+			fatal("failed to open audit log", err)
+		}
+		auditSinks = append([]audit.Sink{fileSink}, auditSinks...)
+	}
+	audit.SetSinks(auditSinks...)
+
+	// Background work stops once ctx is cancelled on shutdown
+	ctx, stopBackground := context.WithCancel(context.Background())
+	var background sync.WaitGroup
+
+	// Erase users whose deletion grace period has ended, along with their files
+	if config.C.PurgeInterval > 0 {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			store.RunPurger(ctx, config.C.PurgeInterval, func(u store.User) {
+				for _, image := range u.Avatar {
+					if err := blobStore.Delete(context.Background(), image.Key); err != nil {
+						slog.Error("failed to delete avatar image", "key", image.Key, "error", err)
+					}
+				}
+				export.DiscardUser(u.ID)
+				audit.Record(nil, audit.Event{Type: audit.TypePurge, TargetID: u.ID})
+				slog.Info("purged deleted user", "user_id", u.ID)
+			})
+		}()
+	}
+
+	// Serve renewed certificates without a restart
+	if certReloader != nil && config.C.TLSReloadInterval > 0 {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			certReloader.Run(ctx, config.C.TLSReloadInterval)
+		}()
+	}
+
+	// Bootstrap administrator
+	if err := bootstrapAdmin(context.Background()); err != nil {
+		fatal("failed to create administrator", err)
+	}
+
+	// conditional returns middlewares followed by a check that the request has an If-Match header.
+	// Legacy routes don't require one, so existing clients keep working until the sunset.
+	conditional := func(middlewares []Middleware) []Middleware {
+		return append(middlewares, middleware.RequireIfMatch)
+	}
+
+	// legacy returns the middlewares of a deprecated route, preceded by one marking its
+	// responses as deprecated in favour of successor.
+	legacy := func(successor string, middlewares []Middleware) []Middleware {
+		return append([]Middleware{middleware.Deprecated(legacyDeprecation, legacySunset, successor)}, middlewares...)
+	}
 
 	// Routes
-	http.HandleFunc("/register", Chain(handler.RegisterUserHandler, commonMiddlewares...))
-	http.HandleFunc("/profile", Chain(handler.ProfileHandler, authMiddlewares...))
-	http.HandleFunc("/profile/update", Chain(handler.UpdateUserHandler, authMiddlewares...))
-	http.HandleFunc("/profile/delete", Chain(handler.DeleteUserHandler, authMiddlewares...))
-	http.HandleFunc("/login", Chain(handler.LoginHandler, commonMiddlewares...))
-	http.HandleFunc("/logout", Chain(handler.LogoutHandler, authMiddlewares...))
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
+	mux := router.New()
+	mux.Handle(http.MethodPost, "/v1/users", Chain(handler.RegisterUserHandler, commonMiddlewares...))
+	mux.Handle(http.MethodGet, "/v1/users/me", Chain(handler.ProfileHandler, protected(util.PermProfileRead)...))
+	mux.Handle(http.MethodPatch, "/v1/users/me", Chain(handler.UpdateUserHandler, conditional(protected(util.PermProfileWrite))...))
+	mux.Handle(http.MethodDelete, "/v1/users/me", Chain(handler.DeleteUserHandler, conditional(protected(util.PermProfileDelete))...))
+	mux.Handle(http.MethodPut, "/v1/users/me/username", Chain(handler.RenameUserHandler, protected(util.PermProfileWrite)...))
+	mux.Handle(http.MethodPut, "/v1/users/me/avatar", Chain(handler.UploadAvatarHandler, protected(util.PermProfileWrite)...))
+	mux.Handle(http.MethodDelete, "/v1/users/me/avatar", Chain(handler.DeleteAvatarHandler, protected(util.PermProfileWrite)...))
+	mux.Handle(http.MethodGet, "/v1/users/me/logins", Chain(handler.LoginHistoryHandler, protected(util.PermProfileRead)...))
+	mux.Handle(http.MethodPost, "/v1/users/me/exports", Chain(handler.CreateExportHandler, protected(util.PermProfileRead)...))
+	mux.Handle(http.MethodGet, "/v1/users/me/exports/{id}", Chain(handler.ExportStatusHandler, protected(util.PermProfileRead)...))
+	mux.Handle(http.MethodGet, "/v1/exports/{id}/archive", Chain(handler.DownloadExportHandler, commonMiddlewares...))
+	mux.Handle(http.MethodPost, "/v1/sessions", Chain(handler.LoginHandler, commonMiddlewares...))
+	mux.Handle(http.MethodDelete, "/v1/sessions/current", Chain(handler.LogoutHandler, authMiddlewares...))
+	mux.Handle(http.MethodGet, "/v1/admin/users", Chain(handler.AdminListUsersHandler, adminOnly(util.PermUsersRead)...))
+	mux.Handle(http.MethodPost, "/v1/admin/users", Chain(handler.AdminCreateUserHandler, adminOnly(util.PermUsersWrite)...))
+	mux.Handle(http.MethodGet, "/v1/admin/users/{id}", Chain(handler.AdminGetUserHandler, adminOnly(util.PermUsersRead)...))
+	mux.Handle(http.MethodDelete, "/v1/admin/users/{id}", Chain(handler.AdminDeleteUserHandler, conditional(adminOnly(util.PermUsersDelete))...))
+	mux.Handle(http.MethodPut, "/v1/admin/users/{id}/email", Chain(handler.AdminUpdateEmailHandler, conditional(adminOnly(util.PermUsersWrite))...))
+	mux.Handle(http.MethodPost, "/v1/admin/users/{id}/password-reset", Chain(handler.AdminResetPasswordHandler, adminOnly(util.PermUsersWrite, util.PermTokensRevoke)...))
+	mux.Handle(http.MethodPost, "/v1/admin/users/{id}/disable", Chain(handler.AdminDisableUserHandler, adminOnly(util.PermUsersWrite, util.PermTokensRevoke)...))
+	mux.Handle(http.MethodPost, "/v1/admin/users/{id}/enable", Chain(handler.AdminEnableUserHandler, adminOnly(util.PermUsersWrite)...))
+	mux.Handle(http.MethodPut, "/v1/admin/users/{id}/roles", Chain(handler.AdminSetRolesHandler, adminOnly(util.PermUsersWrite, util.PermTokensRevoke)...))
+	mux.Handle(http.MethodPut, "/v1/admin/users/{id}/permissions", Chain(handler.AdminSetPermissionsHandler, adminOnly(util.PermUsersWrite, util.PermTokensRevoke)...))
+	mux.Handle(http.MethodPost, "/v1/admin/users/{id}/restore", Chain(handler.AdminRestoreUserHandler, adminOnly(util.PermUsersDelete)...))
+	mux.Handle(http.MethodDelete, "/v1/admin/users/{id}/tokens", Chain(handler.AdminRevokeTokensHandler, adminOnly(util.PermTokensRevoke)...))
+	mux.Handle(http.MethodGet, "/v1/admin/audit-events", Chain(handler.AdminListAuditEventsHandler, adminOnly(util.PermAuditRead)...))
+	if local, ok := blobStore.(*blob.Local); ok && config.C.BlobPublicURL == "" {
+		mux.Handle(http.MethodGet, "/media/{key...}", http.StripPrefix("/media", local.Handler()).ServeHTTP)
+	}
+	mux.Handle(http.MethodGet, "/livez", health.LivezHandler)
+	mux.Handle(http.MethodGet, "/readyz", health.ReadyzHandler)
+	mux.Handle(http.MethodGet, "/health", health.LivezHandler) // Kept for existing monitors; same as /livez
+	mux.Handle(http.MethodGet, "/metrics", metrics.Handler)
+
+	// Legacy routes, kept until legacySunset
+	mux.Handle(http.MethodPost, "/register", Chain(handler.RegisterUserHandler, legacy("/v1/users", commonMiddlewares)...))
+	mux.Handle(http.MethodGet, "/profile", Chain(handler.ProfileHandler, legacy("/v1/users/me", protected(util.PermProfileRead))...))
+	mux.Handle(http.MethodPatch, "/profile", Chain(handler.UpdateUserHandler, legacy("/v1/users/me", protected(util.PermProfileWrite))...))
+	mux.Handle(http.MethodPost, "/profile/update", Chain(handler.UpdateUserHandler, legacy("/v1/users/me", protected(util.PermProfileWrite))...))
+	mux.Handle(http.MethodPost, "/profile/username", Chain(handler.RenameUserHandler, legacy("/v1/users/me/username", protected(util.PermProfileWrite))...))
+	mux.Handle(http.MethodPut, "/profile/avatar", Chain(handler.UploadAvatarHandler, legacy("/v1/users/me/avatar", protected(util.PermProfileWrite))...))
+	mux.Handle(http.MethodGet, "/profile/logins", Chain(handler.LoginHistoryHandler, legacy("/v1/users/me/logins", protected(util.PermProfileRead))...))
+	mux.Handle(http.MethodPost, "/profile/export", Chain(handler.CreateExportHandler, legacy("/v1/users/me/exports", protected(util.PermProfileRead))...))
+	mux.Handle(http.MethodPost, "/profile/delete", Chain(handler.DeleteUserHandler, legacy("/v1/users/me", protected(util.PermProfileDelete))...))
+	mux.Handle(http.MethodPost, "/login", Chain(handler.LoginHandler, legacy("/v1/sessions", commonMiddlewares)...))
+	mux.Handle(http.MethodPost, "/logout", Chain(handler.LogoutHandler, legacy("/v1/sessions/current", authMiddlewares)...))
+
+	// Every request gets an ID, its client certificate's principal, a server span and metrics,
+	// even if it matches no route
+	server := middleware.RequestID(middleware.ClientCert(principals)(
+		middleware.Tracing(mux.Route)(middleware.Metrics(mux.Route)(mux.ServeHTTP))))
+
+	srv := &http.Server{
+		Addr:              address,
+		Handler:           server,
+		ReadTimeout:       config.C.ReadTimeout,
+		ReadHeaderTimeout: config.C.ReadHeaderTimeout,
+		WriteTimeout:      config.C.WriteTimeout,
+		IdleTimeout:       config.C.IdleTimeout,
+		MaxHeaderBytes:    config.C.MaxHeaderBytes,
+		TLSConfig:         tlsConfig,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+
+	// Serve until SIGINT or SIGTERM; a second signal stops the server immediately
+	signals, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+	served := make(chan error, 1)
+	go func() {
+		if tlsConfig != nil {
+			// The certificate is served by certReloader, so no files are passed
+			served <- srv.ListenAndServeTLS("", "")
+		} else {
+			served <- srv.ListenAndServe()
+		}
+	}()
+	slog.Info("server is up", "address", address, "tls", tlsConfig != nil)
+
+	select {
+	case err := <-served:
+		fatal("server stopped", err)
+	case <-signals.Done():
+		stopSignals()
+	}
+	shutdown(srv, func(ctx context.Context) error {
+		stopBackground()
+		background.Wait()
+		return handler.WaitBackground(ctx)
 	})
+}
+
+// shutdown stops the server gracefully. Readiness fails first, so load balancers stop
+// sending requests during the drain period; then the server stops accepting connections
+// and in-flight requests get until the shutdown timeout to complete, as does background
+// work, stopped by stopBackground. Finally buffered spans and the audit log are flushed.
+func shutdown(srv *http.Server, stopBackground func(ctx context.Context) error) {
+	slog.Info("shutting down", "drain_period", config.C.ShutdownDrainPeriod)
+	health.Drain()
+	time.Sleep(config.C.ShutdownDrainPeriod)
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.C.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("failed to complete in-flight requests", "error", err)
+	}
+	if err := stopBackground(ctx); err != nil {
+		slog.Error("failed to complete background work", "error", err)
+	}
+	if err := tracing.Shutdown(ctx); err != nil {
+		slog.Error("failed to flush spans", "error", err)
+	}
+	if err := audit.Close(); err != nil {
+		slog.Error("failed to close audit log", "error", err)
+	}
+	slog.Info("server stopped")
+}
+
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// bootstrapAdmin creates the administrator account configured through ADMIN_USERNAME,
+// ADMIN_EMAIL and ADMIN_PASSWORD, unless it is not configured or already exists.
+func bootstrapAdmin(ctx context.Context) error {
+	if config.C.AdminUsername == "" {
+		return nil
+	}
+	if _, err := store.GetUserByUsername(ctx, config.C.AdminUsername); err == nil {
+		return nil
+	}
+	if config.C.AdminPassword == "" {
+		return errors.New("ADMIN_PASSWORD must be set when ADMIN_USERNAME is set")
+	}
 
-	fmt.Printf("Server is up and listening on port: %s\n", port)
-	log.Fatal(http.ListenAndServe(address, nil))
+	return store.CreateUser(ctx, &store.User{
+		Username: config.C.AdminUsername,
+		Email:    config.C.AdminEmail,
+		Password: config.C.AdminPassword,
+		Roles:    []string{util.RoleUser, util.RoleAdmin},
+	})
 }
@@ -1,27 +1,190 @@
 package config
 
-import "os"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
 
 // Config represents the configuration structure used by the application.
-// It contains fields for the server host, server port, and JWT secret key.
+// It contains fields for the server host, server port, JWT secret key, password hashing parameters and file storage.
 type Config struct {
 	ServerHost     string
 	ServerPort     string
 	JWTSecret      string
 	AllowedOrigins string
+	TrustedProxies string // Comma-separated addresses or CIDR ranges of proxies whose X-Forwarded-For header is trusted
+
+	ReadTimeout         time.Duration // Maximum time to read a request, including its body
+	ReadHeaderTimeout   time.Duration // Maximum time to read the request headers
+	WriteTimeout        time.Duration // Maximum time from the end of the request headers to the end of the response
+	IdleTimeout         time.Duration // How long idle keep-alive connections are kept open
+	MaxHeaderBytes      int           // Maximum size of the request headers
+	ShutdownDrainPeriod time.Duration // How long readiness fails before the server stops accepting connections
+	ShutdownTimeout     time.Duration // How long in-flight requests and background work get to complete on shutdown
+
+	TLSCertFile         string        // PEM certificate chain served over TLS; plain HTTP is served if empty
+	TLSKeyFile          string        // PEM private key of the certificate
+	TLSReloadInterval   time.Duration // How often the certificate and key files are checked for changes
+	TLSMinVersion       string        // Minimum TLS version accepted: "1.2" or "1.3"
+	TLSCipherSuites     string        // Comma-separated TLS 1.2 cipher suites, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256; Go's defaults if empty
+	TLSClientAuth       string        // Client certificate authentication: "none", "optional" or "require"
+	TLSClientCAFile     string        // PEM certificates of the CAs client certificates are verified against
+	TLSClientPrincipals string        // Semicolon-separated "<principal>=<subject>" pairs mapping client certificate subjects to service principals
+
+	LogFormat string // Log output format: "text" or "json"
+	LogLevel  string // Minimum level logged: "debug", "info", "warn" or "error"
+
+	PasswordHashAlgorithm string // "argon2id" or "bcrypt"
+	Argon2Time            int    // Number of argon2id passes over the memory
+	Argon2Memory          int    // argon2id memory cost in KiB
+	Argon2Threads         int    // argon2id degree of parallelism
+	BcryptCost            int    // bcrypt cost factor
+	PasswordPeppers       string // Comma-separated "<version>:<secret>" pairs used to pepper passwords
+	PasswordPepperVersion int    // Pepper version used for new hashes; 0 selects the highest configured version
+
+	AdminUsername string // Username of the administrator account created at startup, if set
+	AdminEmail    string // Email of the bootstrap administrator account
+	AdminPassword string // Initial password of the bootstrap administrator account
+
+	UsernameReservationPeriod time.Duration // How long a released username stays reserved for its previous owner
+	ReservedUsernames         string        // Comma-separated usernames that can't be registered
+
+	BlobBackend       string // Where uploaded files are stored: "local" or "s3"
+	BlobLocalDir      string // Directory of the local blob store
+	BlobPublicURL     string // Base URL of stored files; defaults to /media for the local store
+	S3Endpoint        string // URL of the S3-compatible service, e.g. https://s3.eu-west-1.amazonaws.com
+	S3Region          string // Region used to sign S3 requests
+	S3Bucket          string // Bucket holding the files
+	S3AccessKeyID     string // Access key used to sign S3 requests
+	S3SecretAccessKey string // Secret key used to sign S3 requests
+
+	AvatarMaxBytes int // Maximum size of uploaded avatar images
+
+	AccountDeletionGracePeriod time.Duration // How long a deleted account can be restored before it is erased
+	PurgeInterval              time.Duration // How often accounts past their deletion grace period are erased
+
+	ExportRetention time.Duration // How long data export archives are kept
+	ExportLinkTTL   time.Duration // How long data export download links are valid
+	ExportMaxBytes  int           // Maximum total size of the data export archives kept in memory
+
+	AuditLogFile string // JSON Lines file audit events are appended to; empty to keep them in memory only
+
+	Notifier            string // How notifications are delivered: "log", "webhook" or "smtp"
+	NotifyWebhookURL    string // URL notifications are posted to by the webhook notifier
+	NotifyWebhookSecret string // Key used to sign webhook requests; unsigned if empty
+	SMTPAddr            string // host:port of the mail server used by the smtp notifier
+	SMTPUsername        string // Mail server username; no authentication if empty
+	SMTPPassword        string // Mail server password
+	SMTPFrom            string // Sender address of notification emails
+
+	TracingExporter    string  // Where spans are sent: "none" or "otlp"
+	TracingSampleRatio float64 // Fraction of traces started here that are recorded, from 0 to 1
+	TracingServiceName string  // Service name reported with spans
+	OTLPEndpoint       string  // Base URL of the OTLP/HTTP collector; spans are posted to /v1/traces under it
+	OTLPHeaders        string  // Comma-separated "key=value" headers sent to the collector, e.g. for authentication
+
+	HealthCheckTimeout  time.Duration // How long each readiness check may take before it fails
+	HealthCheckCacheTTL time.Duration // How long readiness check results are reused
 }
 
+// DefaultReservedUsernames lists the usernames reserved when RESERVED_USERNAMES is not set.
+const DefaultReservedUsernames = "admin,administrator,root,superuser,support,help,helpdesk,staff,moderator," +
+	"system,security,abuse,postmaster,hostmaster,webmaster,noreply,no-reply,api,www,mail,null,undefined,me"
+
 // C is the global configuration instance populated by the Load function.
 var C Config
 
+// loadErrors collects the variables Load could not parse.
+var loadErrors []error
+
 // Load initializes the global configuration (C) using environment variables or default values.
-func Load() {
+// It returns an error naming every variable that is set but malformed, e.g. a duration
+// without a unit; such variables are given their default value.
+func Load() error {
+	loadErrors = nil
 	C = Config{
 		ServerHost:     getEnv("HOST", "localhost"),    // Default to localhost if HOST environment variable is not set
 		ServerPort:     getEnv("PORT", "8080"),         // Default to port 8080 if PORT environment variable is not set
 		JWTSecret:      getEnv("JWT_KEY", ""),          // No default for JWT secret; it should be set securely in the environment
 		AllowedOrigins: getEnv("ALLOWED_ORIGINS", "*"), // Default to allow all origins
+		TrustedProxies: getEnv("TRUSTED_PROXIES", ""),  // No default; forwarding headers are ignored unless set
+
+		ReadTimeout:         getEnvDuration("READ_TIMEOUT", 30*time.Second),         // Default to 30 seconds, enough for avatar uploads
+		ReadHeaderTimeout:   getEnvDuration("READ_HEADER_TIMEOUT", 5*time.Second),   // Default to 5 seconds
+		WriteTimeout:        getEnvDuration("WRITE_TIMEOUT", 30*time.Second),        // Default to 30 seconds
+		IdleTimeout:         getEnvDuration("IDLE_TIMEOUT", 2*time.Minute),          // Default to 2 minutes
+		MaxHeaderBytes:      getEnvInt("MAX_HEADER_BYTES", 64<<10),                  // Default to 64 KiB
+		ShutdownDrainPeriod: getEnvDuration("SHUTDOWN_DRAIN_PERIOD", 5*time.Second), // Default to 5 seconds
+		ShutdownTimeout:     getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),     // Default to 30 seconds
+
+		TLSCertFile:         getEnv("TLS_CERT_FILE", ""),                           // No default; TLS is off unless set
+		TLSKeyFile:          getEnv("TLS_KEY_FILE", ""),                            // No default; required with TLS_CERT_FILE
+		TLSReloadInterval:   getEnvDuration("TLS_RELOAD_INTERVAL", 10*time.Second), // Default to 10 seconds
+		TLSMinVersion:       getEnv("TLS_MIN_VERSION", "1.2"),                      // Default to TLS 1.2
+		TLSCipherSuites:     getEnv("TLS_CIPHER_SUITES", ""),                       // Default to Go's secure cipher suites
+		TLSClientAuth:       getEnv("TLS_CLIENT_AUTH", "none"),                     // Default to not asking for client certificates
+		TLSClientCAFile:     getEnv("TLS_CLIENT_CA_FILE", ""),                      // No default; required unless TLS_CLIENT_AUTH is none
+		TLSClientPrincipals: getEnv("TLS_CLIENT_PRINCIPALS", ""),                   // No default; no certificate maps to a principal unless set
+
+		LogFormat: getEnv("LOG_FORMAT", "text"), // Default to human-readable logs
+		LogLevel:  getEnv("LOG_LEVEL", "info"),  // Default to info and above
+
+		PasswordHashAlgorithm: getEnv("PASSWORD_HASH_ALGORITHM", "argon2id"), // Default to argon2id for new hashes
+		Argon2Time:            getEnvInt("ARGON2_TIME", 3),                   // Default to 3 passes
+		Argon2Memory:          getEnvInt("ARGON2_MEMORY", 64*1024),           // Default to 64 MiB
+		Argon2Threads:         getEnvInt("ARGON2_THREADS", 2),                // Default to 2 lanes
+		BcryptCost:            getEnvInt("BCRYPT_COST", 10),                  // Default to bcrypt.DefaultCost
+		PasswordPeppers:       getEnv("PASSWORD_PEPPERS", ""),                // No default; passwords are not peppered unless set
+		PasswordPepperVersion: getEnvInt("PASSWORD_PEPPER_VERSION", 0),       // Default to the highest configured version
+
+		AdminUsername: getEnv("ADMIN_USERNAME", ""), // No default; no administrator is created unless set
+		AdminEmail:    getEnv("ADMIN_EMAIL", ""),    // No default
+		AdminPassword: getEnv("ADMIN_PASSWORD", ""), // No default; required when ADMIN_USERNAME is set
+
+		UsernameReservationPeriod: getEnvDuration("USERNAME_RESERVATION_PERIOD", 30*24*time.Hour), // Default to 30 days
+		ReservedUsernames:         getEnv("RESERVED_USERNAMES", DefaultReservedUsernames),         // Default to common staff and system names
+
+		BlobBackend:       getEnv("BLOB_BACKEND", "local"),        // Default to the local filesystem
+		BlobLocalDir:      getEnv("BLOB_LOCAL_DIR", "data/blobs"), // Default to a directory under the working directory
+		BlobPublicURL:     getEnv("BLOB_PUBLIC_URL", ""),          // Default to /media for local, the bucket URL for s3
+		S3Endpoint:        getEnv("S3_ENDPOINT", ""),              // No default; required for the s3 backend
+		S3Region:          getEnv("S3_REGION", "us-east-1"),       // Default to us-east-1
+		S3Bucket:          getEnv("S3_BUCKET", ""),                // No default; required for the s3 backend
+		S3AccessKeyID:     getEnv("S3_ACCESS_KEY_ID", ""),         // No default; required for the s3 backend
+		S3SecretAccessKey: getEnv("S3_SECRET_ACCESS_KEY", ""),     // No default; required for the s3 backend
+
+		AvatarMaxBytes: getEnvInt("AVATAR_MAX_BYTES", 5<<20), // Default to 5 MiB
+
+		AccountDeletionGracePeriod: getEnvDuration("ACCOUNT_DELETION_GRACE_PERIOD", 30*24*time.Hour), // Default to 30 days
+		PurgeInterval:              getEnvDuration("PURGE_INTERVAL", time.Hour),                      // Default to hourly
+
+		ExportRetention: getEnvDuration("EXPORT_RETENTION", 24*time.Hour),  // Default to a day
+		ExportLinkTTL:   getEnvDuration("EXPORT_LINK_TTL", 15*time.Minute), // Default to 15 minutes
+		ExportMaxBytes:  getEnvInt("EXPORT_MAX_BYTES", 256<<20),            // Default to 256 MiB
+
+		AuditLogFile: getEnv("AUDIT_LOG_FILE", "data/audit.jsonl"), // Default to a file under the working directory
+
+		Notifier:            getEnv("NOTIFIER", "log"),           // Default to logging notifications
+		NotifyWebhookURL:    getEnv("NOTIFY_WEBHOOK_URL", ""),    // No default; required for the webhook notifier
+		NotifyWebhookSecret: getEnv("NOTIFY_WEBHOOK_SECRET", ""), // No default; webhook requests are unsigned unless set
+		SMTPAddr:            getEnv("SMTP_ADDR", ""),             // No default; required for the smtp notifier
+		SMTPUsername:        getEnv("SMTP_USERNAME", ""),         // No default
+		SMTPPassword:        getEnv("SMTP_PASSWORD", ""),         // No default
+		SMTPFrom:            getEnv("SMTP_FROM", ""),             // No default; required for the smtp notifier
+
+		TracingExporter:    getEnv("TRACING_EXPORTER", "none"),                             // Default to no tracing
+		TracingSampleRatio: getEnvFloat("TRACING_SAMPLE_RATIO", 1),                         // Default to recording every trace
+		TracingServiceName: getEnv("OTEL_SERVICE_NAME", "user-api"),                        // Default to the module name
+		OTLPEndpoint:       getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318"), // Default to a local collector
+		OTLPHeaders:        getEnv("OTEL_EXPORTER_OTLP_HEADERS", ""),                       // No default
+
+		HealthCheckTimeout:  getEnvDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second),   // Default to 2 seconds
+		HealthCheckCacheTTL: getEnvDuration("HEALTH_CHECK_CACHE_TTL", 5*time.Second), // Default to 5 seconds
 	}
+	return errors.Join(loadErrors...)
 }
 
 // getEnv fetches the value of an environment variable or returns a default value.
@@ -33,3 +196,51 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvInt fetches an integer environment variable or returns a default value.
+// If the variable is set but cannot be parsed as an integer, the error is reported by Load
+// and the default is returned.
+func getEnvInt(key string, defaultValue int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		loadErrors = append(loadErrors, fmt.Errorf("invalid %s: %w", key, err))
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvFloat fetches a floating-point environment variable or returns a default value.
+// If the variable is set but cannot be parsed as a number, the error is reported by Load
+// and the default is returned.
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		loadErrors = append(loadErrors, fmt.Errorf("invalid %s: %w", key, err))
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvDuration fetches a duration environment variable (e.g. "90s", "24h") or returns a default value.
+// If the variable is set but cannot be parsed as a duration, the error is reported by Load
+// and the default is returned.
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		loadErrors = append(loadErrors, fmt.Errorf("invalid %s: %w", key, err))
+		return defaultValue
+	}
+	return parsed
+}
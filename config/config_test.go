@@ -0,0 +1,36 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLoadMalformed tests that malformed values are reported and replaced by their defaults.
+func TestLoadMalformed(t *testing.T) {
+	defer func(c Config) { C = c }(C)
+	t.Setenv("SHUTDOWN_TIMEOUT", "30")
+	t.Setenv("READ_TIMEOUT", "5sec")
+	t.Setenv("MAX_HEADER_BYTES", "1MB")
+	t.Setenv("WRITE_TIMEOUT", "45s")
+
+	err := Load()
+	if err == nil {
+		t.Fatal("Expected malformed values to be reported")
+	}
+	for _, key := range []string{"SHUTDOWN_TIMEOUT", "READ_TIMEOUT", "MAX_HEADER_BYTES"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("Expected %s to be reported, but got %v", key, err)
+		}
+	}
+	if C.ReadTimeout != 30*time.Second || C.WriteTimeout != 45*time.Second {
+		t.Errorf("Expected the default read timeout and the configured write timeout, but got %v and %v", C.ReadTimeout, C.WriteTimeout)
+	}
+
+	t.Setenv("SHUTDOWN_TIMEOUT", "30s")
+	t.Setenv("READ_TIMEOUT", "5s")
+	t.Setenv("MAX_HEADER_BYTES", "1048576")
+	if err := Load(); err != nil {
+		t.Errorf("Expected valid values to load, but got %v", err)
+	}
+}
@@ -0,0 +1,262 @@
+// Package export assembles archives of everything stored about a user, so they can
+// download their data. Archives are built in the background from the registered
+// sections and kept in memory until they expire.
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+	"user-api/config"
+	"user-api/store"
+	"user-api/tracing"
+	"user-api/util"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Defaults, used when none are configured.
+const (
+	defaultRetention = 24 * time.Hour
+	defaultLinkTTL   = 15 * time.Minute
+	defaultMaxBytes  = 256 << 20
+)
+
+// Status is the state of an export job.
+type Status string
+
+const (
+	StatusPending Status = "pending" // The archive is being assembled
+	StatusReady   Status = "ready"   // The archive can be downloaded
+	StatusFailed  Status = "failed"  // The archive could not be assembled
+)
+
+// ErrNotFound is returned for jobs that don't exist, belong to another user or have expired.
+var ErrNotFound = &store.Error{Kind: store.ErrNotFound, Code: "export_not_found", Message: "export not found"}
+
+// Job is a request for an archive of a user's data.
+type Job struct {
+	ID          string
+	UserID      int
+	Status      Status
+	CreatedAt   time.Time
+	CompletedAt time.Time // Zero while pending
+	ExpiresAt   time.Time // After this time the job and its archive are discarded
+
+	archive []byte
+}
+
+// Section is a named part of an archive, stored as <Name>.json.
+type Section struct {
+	Name string
+	// Collect returns the section's data for the user, which is encoded as JSON.
+	Collect func(ctx context.Context, user store.User) (any, error)
+}
+
+var (
+	mutex    sync.Mutex
+	sections []Section
+	jobs     = make(map[string]*Job)
+)
+
+// Register adds a section to every archive built from now on.
+// Sections appear in archives in the order they were registered.
+func Register(name string, collect func(ctx context.Context, user store.User) (any, error)) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	sections = append(sections, Section{Name: name, Collect: collect})
+}
+
+// Start creates an export job for the user and assembles its archive in the background.
+// If the user already has a pending job, that job is returned instead; completed jobs of
+// the user are replaced, so each user has at most one archive in memory.
+// The archive is assembled in a span continuing the trace carried by ctx.
+func Start(ctx context.Context, userID int) (Job, error) {
+	id, err := util.RandomString(18)
+	if err != nil {
+		return Job{}, err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	now := time.Now()
+	removeExpired(now)
+	for _, job := range jobs {
+		if job.UserID == userID && job.Status == StatusPending {
+			return *job, nil
+		}
+	}
+	for id, job := range jobs {
+		if job.UserID == userID {
+			delete(jobs, id)
+		}
+	}
+
+	job := &Job{ID: id, UserID: userID, Status: StatusPending, CreatedAt: now, ExpiresAt: now.Add(retention())}
+	jobs[id] = job
+	go build(context.WithoutCancel(ctx), id, userID, append([]Section(nil), sections...))
+
+	return *job, nil
+}
+
+// Get returns the job identified by id, if it belongs to the user and hasn't expired.
+func Get(id string, userID int) (Job, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	removeExpired(time.Now())
+	job, exists := jobs[id]
+	if !exists || job.UserID != userID {
+		return Job{}, ErrNotFound
+	}
+	return *job, nil
+}
+
+// Archive returns the ZIP archive of the ready job identified by id.
+func Archive(id string) (Job, []byte, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	removeExpired(time.Now())
+	job, exists := jobs[id]
+	if !exists || job.Status != StatusReady {
+		return Job{}, nil, ErrNotFound
+	}
+	return *job, job.archive, nil
+}
+
+// DiscardUser discards the jobs and archives of a user, e.g. once the user is deleted, so
+// download links already issued stop working.
+func DiscardUser(userID int) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	for id, job := range jobs {
+		if job.UserID == userID {
+			delete(jobs, id)
+		}
+	}
+}
+
+// build assembles the archive of a job and records the outcome.
+func build(ctx context.Context, id string, userID int, sections []Section) {
+	ctx, span := tracing.Start(ctx, "export.build", trace.WithAttributes(attribute.String("export.id", id)))
+	defer span.End()
+
+	archive, err := buildArchive(ctx, userID, sections, time.Now())
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	job, exists := jobs[id]
+	if !exists {
+		return
+	}
+	job.CompletedAt = time.Now()
+	if err == nil && storedBytes()+len(archive) > maxBytes() {
+		err = fmt.Errorf("archives kept in memory would exceed %d bytes", maxBytes())
+	}
+	if err != nil {
+		slog.Error("data export failed", "user_id", userID, "export_id", id, "error", err)
+		job.Status = StatusFailed
+		return
+	}
+	job.Status = StatusReady
+	job.archive = archive
+}
+
+// manifest describes the contents of an archive. It is stored as manifest.json.
+type manifest struct {
+	UserID      int       `json:"user_id"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Files       []string  `json:"files"`
+}
+
+// buildArchive returns a ZIP archive holding a manifest and one JSON file per section.
+func buildArchive(ctx context.Context, userID int, sections []Section, now time.Time) ([]byte, error) {
+	user, err := store.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	contents := manifest{UserID: userID, GeneratedAt: now.UTC(), Files: []string{}}
+
+	for _, section := range sections {
+		data, err := section.Collect(ctx, user)
+		if err != nil {
+			return nil, fmt.Errorf("section %s: %w", section.Name, err)
+		}
+		name := section.Name + ".json"
+		if err := writeJSON(archive, name, now, data); err != nil {
+			return nil, err
+		}
+		contents.Files = append(contents.Files, name)
+	}
+	if err := writeJSON(archive, "manifest.json", now, contents); err != nil {
+		return nil, err
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeJSON adds a file holding v as indented JSON to the archive.
+func writeJSON(archive *zip.Writer, name string, modified time.Time, v any) error {
+	file, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// removeExpired discards the jobs that expired by now. The caller must hold mutex.
+func removeExpired(now time.Time) {
+	for id, job := range jobs {
+		if !now.Before(job.ExpiresAt) {
+			delete(jobs, id)
+		}
+	}
+}
+
+// storedBytes returns the total size of the archives kept. The caller must hold mutex.
+func storedBytes() int {
+	total := 0
+	for _, job := range jobs {
+		total += len(job.archive)
+	}
+	return total
+}
+
+// maxBytes returns the maximum total size of the archives kept, or the default if unset.
+func maxBytes() int {
+	if config.C.ExportMaxBytes > 0 {
+		return config.C.ExportMaxBytes
+	}
+	return defaultMaxBytes
+}
+
+// retention returns how long jobs are kept, or the default if unset.
+func retention() time.Duration {
+	if config.C.ExportRetention > 0 {
+		return config.C.ExportRetention
+	}
+	return defaultRetention
+}
@@ -0,0 +1,161 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+	"user-api/config"
+	"user-api/store"
+)
+
+// TestExport tests that an export job assembles an archive with a manifest and every section,
+// and that jobs are only visible to the user they belong to.
+func TestExport(t *testing.T) {
+	user := store.User{Username: "ExportTestUser", Email: "ExportTest@email.com", Password: "exportPassword"}
+	if err := store.CreateUser(context.Background(), &user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	job, err := Start(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("Failed to start export: %v", err)
+	}
+	if _, err := Get(job.ID, user.ID+1); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected not found error getting another user's export, but got %v", err)
+	}
+
+	// Wait for the archive to be assembled
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status == StatusPending && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		if job, err = Get(job.ID, user.ID); err != nil {
+			t.Fatalf("Failed to get export: %v", err)
+		}
+	}
+	if job.Status != StatusReady {
+		t.Fatalf("Expected export to be ready, but got %s", job.Status)
+	}
+
+	_, archive, err := Archive(job.ID)
+	if err != nil {
+		t.Fatalf("Failed to get archive: %v", err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+	files := make(map[string][]byte)
+	for _, file := range reader.File {
+		f, _ := file.Open()
+		files[file.Name], _ = io.ReadAll(f)
+		f.Close()
+	}
+
+	var contents manifest
+	if err := json.Unmarshal(files["manifest.json"], &contents); err != nil {
+		t.Fatalf("Failed to decode manifest: %v", err)
+	}
+	if contents.UserID != user.ID || len(contents.Files) == 0 {
+		t.Fatalf("Unexpected manifest: %+v", contents)
+	}
+	for _, name := range contents.Files {
+		if _, exists := files[name]; !exists {
+			t.Errorf("Expected archive to contain %s", name)
+		}
+	}
+
+	var profile map[string]any
+	if err := json.Unmarshal(files["profile.json"], &profile); err != nil {
+		t.Fatalf("Failed to decode profile: %v", err)
+	}
+	if profile["username"] != user.Username {
+		t.Errorf("Expected username %q in profile, but got %v", user.Username, profile["username"])
+	}
+	if bytes.Contains(files["profile.json"], []byte("argon2")) {
+		t.Error("Expected password hash to be left out of the profile")
+	}
+}
+
+// waitForJob polls the job until it is no longer pending.
+func waitForJob(t *testing.T, job Job) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status == StatusPending && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		var err error
+		if job, err = Get(job.ID, job.UserID); err != nil {
+			t.Fatalf("Failed to get export: %v", err)
+		}
+	}
+	return job
+}
+
+// TestExportLimits tests that a new export replaces the user's previous archive, that
+// archives fail once they would exceed the memory limit, and that discarding a user's
+// jobs invalidates them.
+func TestExportLimits(t *testing.T) {
+	user := store.User{Username: "ExportLimitUser", Email: "ExportLimit@email.com", Password: "exportPassword"}
+	if err := store.CreateUser(context.Background(), &user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	first, _ := Start(context.Background(), user.ID)
+	if first = waitForJob(t, first); first.Status != StatusReady {
+		t.Fatalf("Expected export to be ready, but got %s", first.Status)
+	}
+	second, _ := Start(context.Background(), user.ID)
+	if second.ID == first.ID {
+		t.Fatal("Expected a new job once the previous one completed")
+	}
+	if _, err := Get(first.ID, user.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected the previous job to be replaced, but got %v", err)
+	}
+	if second = waitForJob(t, second); second.Status != StatusReady {
+		t.Fatalf("Expected export to be ready, but got %s", second.Status)
+	}
+
+	DiscardUser(user.ID)
+	if _, _, err := Archive(second.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected the archive to be discarded, but got %v", err)
+	}
+
+	t.Cleanup(func() { config.C.ExportMaxBytes = 0 })
+	config.C.ExportMaxBytes = 1
+	third, _ := Start(context.Background(), user.ID)
+	if third = waitForJob(t, third); third.Status != StatusFailed {
+		t.Errorf("Expected export exceeding the memory limit to fail, but got %s", third.Status)
+	}
+}
+
+// TestLink tests that download links are only valid for their job and until they expire.
+func TestLink(t *testing.T) {
+	now := time.Now()
+	job := Job{ID: "linkTestJob", ExpiresAt: now.Add(time.Hour)}
+	signature, expiresAt := SignLink(job, now)
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+
+	if !VerifyLink(job.ID, expires, signature, now) {
+		t.Fatal("Expected link to be valid")
+	}
+	if VerifyLink("otherJob", expires, signature, now) {
+		t.Error("Expected link to be invalid for another job")
+	}
+	if VerifyLink(job.ID, strconv.FormatInt(expiresAt.Unix()+3600, 10), signature, now) {
+		t.Error("Expected link with an extended expiry to be invalid")
+	}
+	if VerifyLink(job.ID, expires, signature, expiresAt) {
+		t.Error("Expected link to be invalid once expired")
+	}
+
+	// Links never outlive the job
+	shortJob := Job{ID: "shortJob", ExpiresAt: now.Add(time.Minute)}
+	if _, expiresAt := SignLink(shortJob, now); expiresAt.After(shortJob.ExpiresAt) {
+		t.Errorf("Expected link to expire by %v, but got %v", shortJob.ExpiresAt, expiresAt)
+	}
+}
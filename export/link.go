@@ -0,0 +1,59 @@
+package export
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"time"
+	"user-api/config"
+)
+
+// linkKey signs download links. Archives only live in this process's memory,
+// so a key generated at startup is enough and never needs to be configured.
+var linkKey = newLinkKey()
+
+func newLinkKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic("export: failed to generate link key: " + err.Error())
+	}
+	return key
+}
+
+// SignLink returns a signature allowing the archive of job to be downloaded until expiresAt,
+// which is the configured link lifetime from now, or when the job expires if that is sooner.
+func SignLink(job Job, now time.Time) (signature string, expiresAt time.Time) {
+	expiresAt = now.Add(linkTTL())
+	if expiresAt.After(job.ExpiresAt) {
+		expiresAt = job.ExpiresAt
+	}
+	expiresAt = expiresAt.Truncate(time.Second)
+	return sign(job.ID, expiresAt.Unix()), expiresAt
+}
+
+// VerifyLink reports whether signature is a valid signature for downloading the archive
+// of job id until expires, a Unix time, and that time has not passed.
+func VerifyLink(id, expires, signature string, now time.Time) bool {
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || !now.Before(time.Unix(unix, 0)) {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(sign(id, unix)))
+}
+
+// sign returns the HMAC of a job ID and expiry time.
+func sign(id string, expires int64) string {
+	mac := hmac.New(sha256.New, linkKey)
+	mac.Write([]byte(id + "\n" + strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// linkTTL returns how long download links are valid, or the default if unset.
+func linkTTL() time.Duration {
+	if config.C.ExportLinkTTL > 0 {
+		return config.C.ExportLinkTTL
+	}
+	return defaultLinkTTL
+}
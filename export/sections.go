@@ -0,0 +1,83 @@
+package export
+
+import (
+	"context"
+	"time"
+	"user-api/store"
+)
+
+// The sections built from the store are part of every archive.
+func init() {
+	Register("profile", profileSection)
+	Register("settings", func(ctx context.Context, user store.User) (any, error) { return user.Settings, nil })
+	Register("sessions", sessionsSection)
+	Register("login_history", func(ctx context.Context, user store.User) (any, error) {
+		return store.LoginHistory(ctx, user.ID, 0), nil
+	})
+	Register("audit_events", auditSection)
+}
+
+// profileSection returns the user's account and profile fields. Password hashes are left out.
+func profileSection(ctx context.Context, user store.User) (any, error) {
+	avatar := make([]string, 0, len(user.Avatar))
+	for _, image := range user.Avatar {
+		avatar = append(avatar, image.Key)
+	}
+	history := user.UsernameHistory
+	if history == nil {
+		history = []store.UsernameChange{}
+	}
+	return struct {
+		ID              int                    `json:"id"`
+		Username        string                 `json:"username"`
+		Email           string                 `json:"email"`
+		DisplayName     string                 `json:"display_name"`
+		Locale          string                 `json:"locale"`
+		Timezone        string                 `json:"timezone"`
+		Roles           []string               `json:"roles"`
+		Permissions     []string               `json:"permissions"`
+		Avatar          []string               `json:"avatar"` // Keys of the stored avatar images
+		UsernameHistory []store.UsernameChange `json:"username_history"`
+		CreatedAt       time.Time              `json:"created_at"`
+		UpdatedAt       time.Time              `json:"updated_at"`
+	}{
+		ID:              user.ID,
+		Username:        user.Username,
+		Email:           user.Email,
+		DisplayName:     user.DisplayName,
+		Locale:          user.Locale,
+		Timezone:        user.Timezone,
+		Roles:           user.Roles,
+		Permissions:     user.EffectivePermissions(),
+		Avatar:          avatar,
+		UsernameHistory: history,
+		CreatedAt:       user.CreatedAt,
+		UpdatedAt:       user.UpdatedAt,
+	}, nil
+}
+
+// sessionsSection returns the state of the user's sessions: when they last logged in,
+// and when all their earlier tokens were revoked.
+func sessionsSection(ctx context.Context, user store.User) (any, error) {
+	return struct {
+		LastLoginAt     *time.Time `json:"last_login_at"`
+		TokensRevokedAt *time.Time `json:"tokens_revoked_at"`
+	}{
+		LastLoginAt:     optionalTime(user.LastLoginAt),
+		TokensRevokedAt: optionalTime(user.TokensRevokedAt),
+	}, nil
+}
+
+// optionalTime returns a pointer to t, or nil if t is the zero time.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// auditSection returns the audit events performed by or applying to the user, most recent first.
+func auditSection(ctx context.Context, user store.User) (any, error) {
+	events, _ := store.ListAuditEvents(ctx, store.AuditFilter{UserID: user.ID}, 0, 0)
+	return events, nil
+}
@@ -0,0 +1,192 @@
+// Package health answers the liveness and readiness probes of orchestrators such as
+// Kubernetes. Liveness only tells that the process is serving requests; readiness runs
+// the registered dependency checks, and fails once the server starts shutting down so
+// load balancers stop sending it new requests. The probe needs no authentication, so
+// check results are cached briefly and their errors are logged rather than returned.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTimeout is how long a check may run when registered without a timeout.
+const DefaultTimeout = 2 * time.Second
+
+// Check reports whether a dependency is usable, returning an error describing why not.
+// It should give up once ctx is done.
+type Check func(ctx context.Context) error
+
+// ErrShuttingDown is reported by readiness once Drain was called.
+var ErrShuttingDown = errors.New("server is shutting down")
+
+type check struct {
+	name    string
+	timeout time.Duration
+	run     Check
+}
+
+var (
+	mutex    sync.Mutex
+	checks   []check
+	draining atomic.Bool
+
+	cacheMutex sync.Mutex // Held while the checks run, so concurrent probes share one run
+	cacheTTL   time.Duration
+	cached     Report
+	cachedAt   time.Time
+)
+
+// Register adds a readiness check. A check running longer than timeout fails;
+// a zero timeout selects DefaultTimeout.
+func Register(name string, timeout time.Duration, run Check) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	mutex.Lock()
+	checks = append(checks, check{name: name, timeout: timeout, run: run})
+	mutex.Unlock()
+
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	cachedAt = time.Time{}
+}
+
+// SetCacheTTL sets how long ReadyzHandler reuses the results of the checks, so frequent
+// or malicious probes don't hit every dependency each time. Zero disables caching.
+func SetCacheTTL(ttl time.Duration) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	cacheTTL, cachedAt = ttl, time.Time{}
+}
+
+// Drain makes readiness fail from now on, e.g. when the server starts shutting down.
+func Drain() {
+	draining.Store(true)
+}
+
+// Result is the outcome of a readiness check.
+type Result struct {
+	Status     string `json:"status"` // "ok" or "fail"
+	Error      string `json:"-"`      // Why the check failed; logged, as it may name internal hosts
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Report is the response of the readiness probe.
+type Report struct {
+	Status string            `json:"status"` // "ok" if every check passed, "fail" otherwise
+	Error  string            `json:"error,omitempty"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Ready runs every registered check concurrently and reports their results.
+func Ready(ctx context.Context) Report {
+	mutex.Lock()
+	registered := append([]check(nil), checks...)
+	mutex.Unlock()
+
+	report := Report{Status: "ok", Checks: make(map[string]Result, len(registered))}
+	if draining.Load() {
+		report.Status, report.Error = "fail", ErrShuttingDown.Error()
+	}
+
+	results := make([]Result, len(registered))
+	var wg sync.WaitGroup
+	for i, c := range registered {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = run(ctx, c)
+		}()
+	}
+	wg.Wait()
+
+	for i, c := range registered {
+		report.Checks[c.name] = results[i]
+		if results[i].Status != "ok" {
+			report.Status = "fail"
+		}
+	}
+	return report
+}
+
+// run runs a check with its timeout. Checks that ignore their context are abandoned
+// once the timeout passes, so a hung dependency can't hang the probe.
+func run(ctx context.Context, c check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- c.run(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = errors.New("timed out after " + c.timeout.String())
+	}
+
+	result := Result{Status: "ok", DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status, result.Error = "fail", err.Error()
+	}
+	return result
+}
+
+// LivezHandler reports that the process is up. It checks no dependencies, so a broken
+// dependency doesn't get the process restarted.
+func LivezHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// ReadyzHandler runs the readiness checks, or reuses their results for the cache TTL, and
+// responds with the status of each, with the status 200 OK if all passed and 503 Service
+// Unavailable otherwise. Failed checks are logged with their errors.
+func ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	report := cachedReady(r.Context())
+	status := http.StatusOK
+	if report.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
+
+// cachedReady returns the cached report if it is fresh, and runs the checks otherwise.
+// Draining is never cached, so readiness fails as soon as shutdown starts.
+func cachedReady(ctx context.Context) Report {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	if cachedAt.IsZero() || time.Since(cachedAt) >= cacheTTL {
+		// The checks outlive the request that happened to run them
+		cached, cachedAt = Ready(context.WithoutCancel(ctx)), time.Now()
+		for name, result := range cached.Checks {
+			if result.Status != "ok" {
+				slog.Warn("readiness check failed", "check", name, "error", result.Error, "duration_ms", result.DurationMS)
+			}
+		}
+	}
+
+	report := cached
+	if draining.Load() {
+		report.Status, report.Error = "fail", ErrShuttingDown.Error()
+	}
+	return report
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
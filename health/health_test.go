@@ -0,0 +1,120 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// reset forgets the registered checks and drain state when the test ends.
+func reset(t *testing.T) {
+	t.Cleanup(func() {
+		checks = nil
+		draining.Store(false)
+		SetCacheTTL(0)
+	})
+}
+
+// readyz calls the readiness handler and decodes its report.
+func readyz(t *testing.T) (int, Report) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	ReadyzHandler(rr, httptest.NewRequest("GET", "/readyz", nil))
+
+	var report Report
+	if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	return rr.Code, report
+}
+
+// TestReady tests that readiness reports every check and fails if any of them fails.
+func TestReady(t *testing.T) {
+	reset(t)
+	Register("store", 0, func(ctx context.Context) error { return nil })
+
+	code, report := readyz(t)
+	if code != http.StatusOK || report.Status != "ok" || report.Checks["store"].Status != "ok" {
+		t.Fatalf("Expected ready, but got %d %+v", code, report)
+	}
+
+	Register("mailer", 0, func(ctx context.Context) error { return errors.New("connection refused") })
+	code, report = readyz(t)
+	if code != http.StatusServiceUnavailable || report.Status != "fail" {
+		t.Fatalf("Expected not ready, but got %d %+v", code, report)
+	}
+	if got := report.Checks["mailer"]; got.Status != "fail" {
+		t.Errorf("Unexpected mailer result %+v", got)
+	}
+	// The error is only logged, as it may name internal hosts
+	if got := Ready(context.Background()).Checks["mailer"]; got.Error != "connection refused" {
+		t.Errorf("Expected the mailer error to be reported, but got %+v", got)
+	}
+	if got := report.Checks["store"]; got.Status != "ok" {
+		t.Errorf("Unexpected store result %+v", got)
+	}
+}
+
+// TestReadyTimeout tests that hung checks fail once their timeout passes.
+func TestReadyTimeout(t *testing.T) {
+	reset(t)
+	hang := make(chan struct{})
+	defer close(hang)
+	Register("hung", 20*time.Millisecond, func(ctx context.Context) error {
+		<-hang // Ignores ctx
+		return nil
+	})
+
+	start := time.Now()
+	report := Ready(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Expected the probe to give up on the check, but it took %v", elapsed)
+	}
+	if report.Status != "fail" || report.Checks["hung"].Error != "timed out after 20ms" {
+		t.Errorf("Expected the check to time out, but got %+v", report)
+	}
+}
+
+// TestDrain tests that readiness fails once the server starts shutting down, while liveness doesn't.
+func TestDrain(t *testing.T) {
+	reset(t)
+	Drain()
+
+	code, report := readyz(t)
+	if code != http.StatusServiceUnavailable || report.Error != ErrShuttingDown.Error() {
+		t.Errorf("Expected not ready while draining, but got %d %+v", code, report)
+	}
+
+	rr := httptest.NewRecorder()
+	LivezHandler(rr, httptest.NewRequest("GET", "/livez", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected live while draining, but got %d", rr.Code)
+	}
+}
+
+// TestReadyCache tests that probes reuse check results for the cache TTL, but fail as soon
+// as the server starts draining.
+func TestReadyCache(t *testing.T) {
+	reset(t)
+	var runs atomic.Int32
+	Register("counted", 0, func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	})
+	SetCacheTTL(time.Hour)
+
+	readyz(t)
+	if code, _ := readyz(t); code != http.StatusOK || runs.Load() != 1 {
+		t.Fatalf("Expected one run for two probes, but got %d runs and status %d", runs.Load(), code)
+	}
+
+	Drain()
+	if code, report := readyz(t); code != http.StatusServiceUnavailable || report.Error != ErrShuttingDown.Error() {
+		t.Errorf("Expected not ready while draining, but got %d %+v", code, report)
+	}
+}
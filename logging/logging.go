@@ -0,0 +1,101 @@
+// Package logging configures the structured logger and carries request-scoped loggers
+// in contexts, so every line logged while serving a request identifies the request.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"user-api/config"
+)
+
+// redactedKeys are the lowercase names of attributes and headers whose values are never logged.
+var redactedKeys = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+	"password":            true,
+	"token":               true,
+}
+
+// Redacted replaces the values of redacted attributes.
+const Redacted = "[REDACTED]"
+
+// Setup makes a logger configured by LOG_FORMAT and LOG_LEVEL the default, for both
+// log/slog and the log package, which then logs at the info level.
+func Setup() {
+	slog.SetDefault(New(os.Stderr, config.C.LogFormat, config.C.LogLevel))
+}
+
+// New returns a logger writing to w in format ("json" or "text", the default) from level
+// ("debug", "info" (the default), "warn" or "error"). Redacted attributes are replaced
+// wherever they appear, including in groups.
+func New(w io.Writer, format, level string) *slog.Logger {
+	var minLevel slog.Level
+	if err := minLevel.UnmarshalText([]byte(level)); err != nil {
+		minLevel = slog.LevelInfo
+	}
+	options := &slog.HandlerOptions{Level: minLevel, ReplaceAttr: redact}
+
+	if strings.EqualFold(format, "json") {
+		return slog.New(slog.NewJSONHandler(w, options))
+	}
+	return slog.New(slog.NewTextHandler(w, options))
+}
+
+// redact replaces the value of redacted attributes.
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if redactedKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, Redacted)
+	}
+	return a
+}
+
+// HeaderAttrs returns the headers as a group attribute, for debugging.
+// Redacted headers are replaced by the logger.
+func HeaderAttrs(key string, header http.Header) slog.Attr {
+	attrs := make([]any, 0, len(header))
+	for name, values := range header {
+		attrs = append(attrs, slog.String(name, strings.Join(values, ", ")))
+	}
+	return slog.Group(key, attrs...)
+}
+
+// holder keeps the logger of a request. It is shared by the contexts derived from the
+// request's, so attributes added by inner middleware also appear in the access log line.
+type holder struct {
+	mutex  sync.Mutex
+	logger *slog.Logger
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying logger as the request-scoped logger.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, &holder{logger: logger})
+}
+
+// FromContext returns the request-scoped logger of ctx, or the default logger if it has none.
+func FromContext(ctx context.Context) *slog.Logger {
+	if h, ok := ctx.Value(contextKey{}).(*holder); ok {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		return h.logger
+	}
+	return slog.Default()
+}
+
+// With adds attributes to the request-scoped logger of ctx, e.g. the authenticated user
+// once the token is validated. It does nothing if ctx has no request-scoped logger.
+func With(ctx context.Context, args ...any) {
+	if h, ok := ctx.Value(contextKey{}).(*holder); ok {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		h.logger = h.logger.With(args...)
+	}
+}
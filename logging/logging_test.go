@@ -0,0 +1,64 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestRedact tests that credentials are redacted, including inside groups.
+func TestRedact(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "text", "info")
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer secretToken")
+	header.Set("Cookie", "session=secretCookie")
+	header.Set("Accept", "application/json")
+	logger.Info("test", HeaderAttrs("headers", header), "password", "secretPassword")
+
+	out := buf.String()
+	for _, secret := range []string{"secretToken", "secretCookie", "secretPassword"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("Expected %s to be redacted, but got: %s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "headers.Accept=application/json") || !strings.Contains(out, "headers.Authorization="+Redacted) {
+		t.Errorf("Expected other headers to be kept, but got: %s", out)
+	}
+}
+
+// TestLevel tests that lines below the configured level are dropped.
+func TestLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "json", "warn")
+	logger.Info("dropped")
+	logger.Warn("kept")
+
+	if strings.Contains(buf.String(), "dropped") || !strings.Contains(buf.String(), `"msg":"kept"`) {
+		t.Errorf("Expected only the warning to be logged as JSON, but got: %s", buf.String())
+	}
+}
+
+// TestContext tests that attributes added to a request's logger are seen through every
+// context sharing it, and that contexts without one use the default logger.
+func TestContext(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := NewContext(context.Background(), New(&buf, "text", "info"))
+	type key struct{}
+	inner := context.WithValue(ctx, key{}, "inner")
+
+	With(inner, "user_id", 7)
+	FromContext(ctx).Info("outer")
+	if !strings.Contains(buf.String(), "user_id=7") {
+		t.Errorf("Expected attribute added through a derived context to be logged, but got: %s", buf.String())
+	}
+
+	// Without a request logger, With does nothing
+	With(context.Background(), "user_id", 8)
+	if FromContext(context.Background()) == nil {
+		t.Error("Expected the default logger")
+	}
+}
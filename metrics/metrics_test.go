@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// expose returns the exposition of every registered metric.
+func expose() string {
+	var buf bytes.Buffer
+	WriteTo(&buf)
+	return buf.String()
+}
+
+// TestCounterVec tests that counters are exposed per label values, with escaped labels.
+func TestCounterVec(t *testing.T) {
+	c := NewCounterVec("test_events_total", "Events seen\nin tests.", "kind")
+	c.Inc("a")
+	c.Add(2, "a")
+	c.Inc(`quo"te`)
+	NewCounterVec("test_plain_total", "Unlabeled counter.")
+
+	out := expose()
+	for _, line := range []string{
+		`# HELP test_events_total Events seen\nin tests.`,
+		"# TYPE test_events_total counter",
+		`test_events_total{kind="a"} 3`,
+		`test_events_total{kind="quo\"te"} 1`,
+		"test_plain_total 0",
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("Expected line %q in:\n%s", line, out)
+		}
+	}
+}
+
+// TestHistogramVec tests that bucket counts are cumulative and include +Inf, sum and count.
+func TestHistogramVec(t *testing.T) {
+	h := NewHistogramVec("test_latency_seconds", "Latency.", []float64{0.1, 1}, "op")
+	h.Observe(0.05, "get")
+	h.Observe(0.1, "get")
+	h.Observe(0.5, "get")
+	h.Observe(3, "get")
+
+	out := expose()
+	for _, line := range []string{
+		"# TYPE test_latency_seconds histogram",
+		`test_latency_seconds_bucket{op="get",le="0.1"} 2`,
+		`test_latency_seconds_bucket{op="get",le="1"} 3`,
+		`test_latency_seconds_bucket{op="get",le="+Inf"} 4`,
+		`test_latency_seconds_sum{op="get"} 3.65`,
+		`test_latency_seconds_count{op="get"} 4`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("Expected line %q in:\n%s", line, out)
+		}
+	}
+}
+
+// TestHandler tests that the handler serves the exposition format with metrics sorted by name.
+func TestHandler(t *testing.T) {
+	value := 1.5
+	NewGaugeFunc("test_z_gauge", "Gauge.", func() float64 { return value })
+	NewGaugeFunc("test_a_gauge", "Gauge.", func() float64 { return 0 })
+	value = 7
+
+	rr := httptest.NewRecorder()
+	Handler(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != ContentType {
+		t.Fatalf("Unexpected response %d with content type %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	body := rr.Body.String()
+	if !strings.Contains(body, "test_z_gauge 7\n") {
+		t.Errorf("Expected the gauge to be computed at collection, got:\n%s", body)
+	}
+	if strings.Index(body, "test_a_gauge") > strings.Index(body, "test_z_gauge") {
+		t.Errorf("Expected metrics sorted by name, got:\n%s", body)
+	}
+}
+
+// TestDuplicateMetric tests that registering a name twice panics.
+func TestDuplicateMetric(t *testing.T) {
+	NewCounterVec("test_duplicate_total", "Counter.")
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic")
+		}
+	}()
+	NewCounterVec("test_duplicate_total", "Counter.")
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+	"user-api/principal"
+)
+
+// ClientCert returns a middleware putting the service principal the request's verified
+// client certificate is mapped to into the request's context; see principal.FromContext.
+// Requests without a verified certificate, or with one whose subject isn't mapped, pass
+// through without a principal. It wraps the whole router, so every route can tell.
+func ClientCert(principals principal.Map) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			// VerifiedChains is only set when the certificate chains up to a configured CA
+			if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+				if p, ok := principals.Lookup(r.TLS.VerifiedChains[0][0]); ok {
+					r = r.WithContext(principal.NewContext(r.Context(), p))
+				}
+			}
+			next.ServeHTTP(w, r)
+		}
+	}
+}
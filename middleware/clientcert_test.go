@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-api/principal"
+)
+
+// TestClientCert tests that only verified, mapped client certificates yield a principal.
+func TestClientCert(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "billing.internal", Organization: []string{"Example"}}}
+	other := &x509.Certificate{Subject: pkix.Name{CommonName: "unknown.internal"}}
+	principals := principal.Map{"CN=billing.internal,O=Example": "billing"}
+
+	tests := []struct {
+		name string
+		tls  *tls.ConnectionState
+		want string
+	}{
+		{"plain HTTP", nil, ""},
+		{"no certificate", &tls.ConnectionState{}, ""},
+		{"unverified", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}, ""},
+		{"unmapped", &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{other}}}, ""},
+		{"mapped", &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}, "billing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := ClientCert(principals)(func(w http.ResponseWriter, r *http.Request) {
+				p, _ := principal.FromContext(r.Context())
+				seen = p.Name
+			})
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.TLS = tt.tls
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if seen != tt.want {
+				t.Errorf("Expected principal %q, but got %q", tt.want, seen)
+			}
+		})
+	}
+}
@@ -18,8 +18,9 @@ func CORSMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		// Check if the request's origin is allowed and set the CORS headers accordingly
 		if isOriginAllowed(origin) {
 			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE")
-			w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, Authorization")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, Authorization, If-Match, If-None-Match")
+			w.Header().Set("Access-Control-Expose-Headers", "ETag")
 		}
 
 		// If the request is an OPTIONS method (pre-flight CORS request), respond with 200 OK
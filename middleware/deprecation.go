@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Deprecated returns a middleware that marks the responses of a deprecated route.
+// The Deprecation header (RFC 9745) carries the date since which the route is deprecated,
+// the Sunset header (RFC 8594) the date after which it may be removed, and, if successor
+// is not empty, a Link header points clients to the route replacing it.
+func Deprecated(since, sunset time.Time, successor string) func(http.HandlerFunc) http.HandlerFunc {
+	deprecation := fmt.Sprintf("@%d", since.Unix())
+	sunsetDate := sunset.UTC().Format(http.TimeFormat)
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", deprecation)
+			w.Header().Set("Sunset", sunsetDate)
+			if successor != "" {
+				w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+			}
+
+			next.ServeHTTP(w, r)
+		}
+	}
+}
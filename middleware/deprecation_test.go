@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeprecated(t *testing.T) {
+	since := time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2027, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+	mockHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest("GET", "/profile", nil)
+	rr := httptest.NewRecorder()
+	Deprecated(since, sunset, "/v1/users/me")(mockHandler).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status code %v, but got %v", http.StatusOK, rr.Code)
+	}
+	if got := rr.Header().Get("Deprecation"); got != "@1790812800" {
+		t.Errorf("Expected Deprecation header @1790812800, but got %q", got)
+	}
+	if got := rr.Header().Get("Sunset"); got != "Thu, 01 Apr 2027 00:00:00 GMT" {
+		t.Errorf("Unexpected Sunset header %q", got)
+	}
+	if got := rr.Header().Get("Link"); got != `</v1/users/me>; rel="successor-version"` {
+		t.Errorf("Unexpected Link header %q", got)
+	}
+
+	// Without a successor no Link header is sent
+	rr = httptest.NewRecorder()
+	Deprecated(since, sunset, "")(mockHandler).ServeHTTP(rr, req)
+	if got := rr.Header().Get("Link"); got != "" {
+		t.Errorf("Expected no Link header, but got %q", got)
+	}
+}
@@ -5,38 +5,55 @@ import (
 	"errors"
 	"net/http"
 	"strings"
+	"time"
+	"user-api/api/problem"
+	"user-api/logging"
 	"user-api/store"
 	"user-api/util"
 )
 
 var isTokenBlacklisted = store.IsTokenBlacklisted
+var isTokenRevoked = store.IsTokenRevoked
 var validateToken = util.ValidateToken
 
 // JWTMiddleware ensures that the provided JWT in the request header is valid,
-// not blacklisted, and puts its contents (claims and token) into the request's context.
+// not blacklisted or revoked for its user, and puts its contents (claims and token) into the request's context.
 // If the token is not valid, it will respond with a 401 Unauthorized status.
 func JWTMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Extract the token from the request header
 		tokenStr, err := extractTokenFromRequest(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeTokenMissing, err.Error())
 			return
 		}
 
 		// Check if the token is blacklisted
-		if isTokenBlacklisted(tokenStr) {
-			http.Error(w, "Token is blacklisted", http.StatusUnauthorized)
+		if isTokenBlacklisted(r.Context(), tokenStr) {
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeTokenBlacklisted, "Token is blacklisted")
 			return
 		}
 
 		// Validate the token to get its claims
 		claims, err := validateToken(tokenStr)
 		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeTokenInvalid, "Invalid token")
 			return
 		}
 
+		// Check if the user's tokens were revoked since this one was issued
+		var issuedAt time.Time
+		if claims.IssuedAt != nil {
+			issuedAt = claims.IssuedAt.Time
+		}
+		if isTokenRevoked(r.Context(), claims.UserID(), issuedAt) {
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeTokenRevoked, "Token has been revoked")
+			return
+		}
+
+		// Identify the user in the request's log lines
+		logging.With(r.Context(), "user_id", claims.UserID())
+
 		// Add claims and token to the request context
 		ctx := context.WithValue(r.Context(), "claims", claims)
 		ctx = context.WithValue(ctx, "token", tokenStr)
@@ -1,10 +1,13 @@
 package middleware
 
 import (
+	"context"
 	"errors"
+	"github.com/golang-jwt/jwt/v5"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 	"user-api/util"
 )
 
@@ -30,21 +33,29 @@ func TestJWTMiddleware(t *testing.T) {
 		{"Bearer ", false, false, http.StatusUnauthorized},
 		{"Bearer blacklistedToken", true, true, http.StatusUnauthorized},
 		{"Bearer invalidToken", false, false, http.StatusUnauthorized},
+		{"Bearer revokedToken", false, true, http.StatusUnauthorized},
 		{"Bearer validToken", false, true, http.StatusOK},
 	}
 
 	// Mock functions for the purpose of testing
-	isTokenBlacklisted = func(token string) bool {
+	isTokenBlacklisted = func(ctx context.Context, token string) bool {
 		return token == "blacklistedToken"
 	}
 
 	validateToken = func(token string) (*util.Claims, error) {
-		if token == "validToken" {
-			return &util.Claims{Username: "username"}, nil
+		switch token {
+		case "validToken":
+			return &util.Claims{Username: "username", RegisteredClaims: jwt.RegisteredClaims{Subject: "1"}}, nil
+		case "revokedToken":
+			return &util.Claims{Username: "revokedUser", RegisteredClaims: jwt.RegisteredClaims{Subject: "2"}}, nil
 		}
 		return nil, errors.New("invalid token")
 	}
 
+	isTokenRevoked = func(ctx context.Context, userID int, issuedAt time.Time) bool {
+		return userID == 2
+	}
+
 	for _, test := range tests {
 		req, err := http.NewRequest("GET", "/test-endpoint", nil)
 		if err != nil {
@@ -1,26 +1,95 @@
 package middleware
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
+	"user-api/logging"
+	"user-api/principal"
+	"user-api/requestid"
+	"user-api/util"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
-// LoggingMiddleware is a middleware function that logs the method, request URI,
-// and the duration it took for the request to be processed.
-// It takes as its parameter a function that conforms to the http.HandlerFunc type
-// (i.e., a function that can be registered to serve a particular pattern in the Go HTTP package).
-// The function returns another http.HandlerFunc. This allows for chaining or
-// layering multiple middleware functions if needed.
+// LoggingMiddleware is a middleware function that logs every request as a structured line
+// with its method, path, status code, response size and duration.
+// It puts a logger carrying the request ID set by RequestID, the client's IP address, the
+// trace ID of traced requests and the service principal set by ClientCert, if any, into the
+// request's context; see logging.FromContext. JWTMiddleware adds the authenticated user to it.
+// At the debug level the request headers are logged too, with credentials such as the
+// Authorization header redacted.
 func LoggingMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Record the start time of the request processing
 		start := time.Now()
 
-		// Call the next handler or middleware in the chain
-		next.ServeHTTP(w, r)
+		logger := slog.Default().With("request_id", requestid.FromContext(r.Context()), "remote_ip", util.ClientIP(r))
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			logger = logger.With("trace_id", sc.TraceID().String())
+		}
+		if p, ok := principal.FromContext(r.Context()); ok {
+			logger = logger.With("principal", p.Name)
+		}
+		ctx := logging.NewContext(r.Context(), logger)
+		if logger.Enabled(ctx, slog.LevelDebug) {
+			logger.DebugContext(ctx, "request headers", logging.HeaderAttrs("headers", r.Header))
+		}
+
+		// Call the next handler or middleware in the chain, recording the response
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		// The query is left out, as it may carry secrets such as signed link signatures
+		level := slog.LevelInfo
+		if recorder.Status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logging.FromContext(ctx).Log(ctx, level, "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.Status(),
+			"bytes", recorder.bytes,
+			"duration", time.Since(start),
+			"user_agent", r.UserAgent(),
+		)
+	}
+}
+
+// statusRecorder is an http.ResponseWriter recording the status code and the number of
+// body bytes written.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
 
-		// Log the HTTP method, request URI, and the duration of the request
-		log.Printf("%s %s %s", r.Method, r.RequestURI, time.Since(start))
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
 	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += int64(n)
+	return n, err
+}
+
+// Status returns the status code sent, which is 200 if the handler wrote nothing.
+func (s *statusRecorder) Status() int {
+	if s.status == 0 {
+		return http.StatusOK
+	}
+	return s.status
+}
+
+// Unwrap returns the wrapped writer, so http.ResponseController can reach its optional
+// interfaces, such as flushing.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
 }
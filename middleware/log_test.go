@@ -1,9 +1,14 @@
 package middleware
 
 import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"user-api/logging"
 )
 
 func TestLoggingMiddleware(t *testing.T) {
@@ -38,3 +43,52 @@ func TestLoggingMiddleware(t *testing.T) {
 		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
 	}
 }
+
+// TestLoggingMiddlewareFields tests that the access log line carries the status, size,
+// request ID and attributes added by inner middleware, and that credentials are redacted.
+func TestLoggingMiddlewareFields(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&buf, "json", "debug"))
+	defer slog.SetDefault(previous)
+
+	handler := RequestID(LoggingMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		logging.With(r.Context(), "user_id", 42)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("created"))
+	}))
+
+	req := httptest.NewRequest("POST", "/v1/users?signature=secret", nil)
+	req.Header.Set("Authorization", "Bearer secretToken")
+	req.Header.Set("X-Request-ID", "clientRequestID")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get("X-Request-ID"); got != "clientRequestID" {
+		t.Errorf("Expected request ID to be echoed, but got %q", got)
+	}
+	if strings.Contains(buf.String(), "secretToken") || strings.Contains(buf.String(), "signature=secret") {
+		t.Fatalf("Expected credentials to be left out of the log, but got:\n%s", buf.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &entry); err != nil {
+		t.Fatalf("Failed to decode log line: %v", err)
+	}
+	expected := map[string]any{
+		"msg":        "request",
+		"method":     "POST",
+		"path":       "/v1/users",
+		"status":     float64(http.StatusCreated),
+		"bytes":      float64(len("created")),
+		"request_id": "clientRequestID",
+		"remote_ip":  "192.0.2.1",
+		"user_id":    float64(42),
+	}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("Expected %s to be %v, but got %v", key, value, entry[key])
+		}
+	}
+}
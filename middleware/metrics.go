@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+	"user-api/metrics"
+)
+
+var (
+	httpRequests = metrics.NewCounterVec("http_requests_total",
+		"HTTP requests served, by route, method and status code.", "route", "method", "status")
+	httpRequestDuration = metrics.NewHistogramVec("http_request_duration_seconds",
+		"Time taken to serve HTTP requests, by route, method and status code.", metrics.DefaultBuckets, "route", "method", "status")
+)
+
+// knownMethods are the methods reported as is; others are reported as OTHER, so clients
+// can't create arbitrarily many series.
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// Metrics counts requests and measures their latency by route, method and status code.
+// route returns the pattern matching the request, or an empty string if none does; such
+// requests are reported under the route "unmatched". Routes are patterns rather than
+// paths, so IDs in paths don't create new series.
+func Metrics(route func(*http.Request) string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r)
+
+			pattern := route(r)
+			if pattern == "" {
+				pattern = "unmatched"
+			}
+			method := r.Method
+			if !knownMethods[method] {
+				method = "OTHER"
+			}
+			status := strconv.Itoa(recorder.Status())
+
+			httpRequests.Inc(pattern, method, status)
+			httpRequestDuration.Observe(time.Since(start).Seconds(), pattern, method, status)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"user-api/metrics"
+)
+
+// TestMetrics tests that requests are counted by route pattern, method and status.
+func TestMetrics(t *testing.T) {
+	route := func(r *http.Request) string {
+		if strings.HasPrefix(r.URL.Path, "/items/") {
+			return "/items/{id}"
+		}
+		return ""
+	}
+	handler := Metrics(route)(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/items/2" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	for _, target := range []string{"/items/1", "/items/2", "/items/3", "/other"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BREW", "/items/1", nil))
+
+	var buf bytes.Buffer
+	metrics.WriteTo(&buf)
+	for _, line := range []string{
+		`http_requests_total{route="/items/{id}",method="GET",status="200"} 2`,
+		`http_requests_total{route="/items/{id}",method="GET",status="404"} 1`,
+		`http_requests_total{route="/items/{id}",method="OTHER",status="200"} 1`,
+		`http_requests_total{route="unmatched",method="GET",status="200"} 1`,
+		`http_request_duration_seconds_count{route="/items/{id}",method="GET",status="200"} 2`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("Expected line %q in:\n%s", line, buf.String())
+		}
+	}
+}
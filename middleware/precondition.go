@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"net/http"
+	"user-api/api/problem"
+)
+
+// RequireIfMatch is a middleware that rejects requests without an If-Match header with
+// 428 Precondition Required (RFC 6585). It is used on routes that modify or delete a
+// resource, so that clients can't overwrite changes they haven't seen; the handler
+// then compares the header with the resource's current ETag.
+func RequireIfMatch(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-Match") == "" {
+			problem.Write(w, r, http.StatusPreconditionRequired, problem.CodePreconditionRequired, "This request requires an If-Match header with the resource's ETag")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
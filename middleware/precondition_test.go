@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireIfMatch(t *testing.T) {
+	mockHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		ifMatch    string
+		statusCode int
+	}{
+		{`"3"`, http.StatusOK},
+		{"*", http.StatusOK},
+		{"", http.StatusPreconditionRequired},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("DELETE", "/v1/users/me", nil)
+		if test.ifMatch != "" {
+			req.Header.Set("If-Match", test.ifMatch)
+		}
+		rr := httptest.NewRecorder()
+		RequireIfMatch(mockHandler).ServeHTTP(rr, req)
+
+		if rr.Code != test.statusCode {
+			t.Errorf("Expected status code %v for If-Match %q, but got %v", test.statusCode, test.ifMatch, rr.Code)
+		}
+	}
+}
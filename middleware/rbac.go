@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"user-api/api/problem"
+	"user-api/util"
+)
+
+// RequirePermission returns a middleware that only lets requests through if the
+// authenticated user's token grants all of the given permissions. It reads the
+// claims placed in the request context by JWTMiddleware, so it must run after it
+// in the chain. Requests without claims get a 401 Unauthorized status, and
+// requests lacking a permission get a 403 Forbidden status.
+func RequirePermission(permissions ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value("claims").(*util.Claims)
+			if !ok {
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authentication required")
+				return
+			}
+
+			for _, permission := range permissions {
+				if !claims.HasPermission(permission) {
+					problem.Write(w, r, http.StatusForbidden, problem.CodeForbidden, "Missing permission: "+permission)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		}
+	}
+}
+
+// RequireRole returns a middleware that only lets requests through if the
+// authenticated user's token includes the given role. Like RequirePermission,
+// it must run after JWTMiddleware in the chain.
+func RequireRole(role string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value("claims").(*util.Claims)
+			if !ok {
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authentication required")
+				return
+			}
+
+			if !claims.HasRole(role) {
+				problem.Write(w, r, http.StatusForbidden, problem.CodeForbidden, "Missing role: "+role)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+	}
+}
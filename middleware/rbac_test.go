@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-api/util"
+)
+
+func TestRequirePermission(t *testing.T) {
+	// Mock handler to simulate HTTP request processing
+	mockHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write([]byte("OK"))
+		if err != nil {
+			t.Fatalf("Error writing response: %v", err)
+		}
+	})
+
+	// Wrap the mockHandler with the permission check
+	handlerWithMiddleware := RequirePermission(util.PermUsersRead, util.PermUsersWrite)(mockHandler)
+
+	tests := []struct {
+		claims     *util.Claims
+		statusCode int
+	}{
+		{nil, http.StatusUnauthorized},
+		{&util.Claims{Username: "user", Permissions: []string{util.PermProfileRead}}, http.StatusForbidden},
+		{&util.Claims{Username: "support", Permissions: []string{util.PermUsersRead}}, http.StatusForbidden},
+		{&util.Claims{Username: "admin", Permissions: []string{util.PermUsersRead, util.PermUsersWrite}}, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", "/test-endpoint", nil)
+		if err != nil {
+			t.Fatalf("Could not create request: %v", err)
+		}
+		if test.claims != nil {
+			req = req.WithContext(context.WithValue(req.Context(), "claims", test.claims))
+		}
+
+		rr := httptest.NewRecorder()
+		handlerWithMiddleware.ServeHTTP(rr, req)
+
+		if rr.Code != test.statusCode {
+			t.Errorf("Expected status code %v, but got %v for claims %+v", test.statusCode, rr.Code, test.claims)
+		}
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	// Mock handler to simulate HTTP request processing
+	mockHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// Wrap the mockHandler with the role check
+	handlerWithMiddleware := RequireRole(util.RoleAdmin)(mockHandler)
+
+	tests := []struct {
+		claims     *util.Claims
+		statusCode int
+	}{
+		{nil, http.StatusUnauthorized},
+		{&util.Claims{Username: "user", Roles: []string{util.RoleUser}}, http.StatusForbidden},
+		{&util.Claims{Username: "admin", Roles: []string{util.RoleUser, util.RoleAdmin}}, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", "/test-endpoint", nil)
+		if err != nil {
+			t.Fatalf("Could not create request: %v", err)
+		}
+		if test.claims != nil {
+			req = req.WithContext(context.WithValue(req.Context(), "claims", test.claims))
+		}
+
+		rr := httptest.NewRecorder()
+		handlerWithMiddleware.ServeHTTP(rr, req)
+
+		if rr.Code != test.statusCode {
+			t.Errorf("Expected status code %v, but got %v for claims %+v", test.statusCode, rr.Code, test.claims)
+		}
+	}
+}
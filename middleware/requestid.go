@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"net/http"
+	"user-api/requestid"
+)
+
+// RequestID gives every request an ID, taken from the X-Request-ID header if the client
+// sent a valid one and generated otherwise. The ID is stored in the request's context,
+// see requestid.FromContext, and echoed in the X-Request-ID response header.
+// It wraps the whole router, so even requests matching no route get an ID.
+func RequestID(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+
+		w.Header().Set(requestid.Header, id)
+		next.ServeHTTP(w, r.WithContext(requestid.NewContext(r.Context(), id)))
+	}
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-api/requestid"
+)
+
+// TestRequestID tests that valid client request IDs are kept, invalid ones are replaced,
+// and the ID is both echoed and available to the handler.
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		keepsID bool
+	}{
+		{"valid", "client-id:42", true},
+		{"missing", "", false},
+		{"invalid", "bad id\nforged log line", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := RequestID(func(w http.ResponseWriter, r *http.Request) {
+				seen = requestid.FromContext(r.Context())
+			})
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				req.Header.Set(requestid.Header, tt.header)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			echoed := rr.Header().Get(requestid.Header)
+			if echoed == "" || echoed != seen {
+				t.Fatalf("Expected the echoed ID %q to match the context ID %q", echoed, seen)
+			}
+			if (echoed == tt.header) != tt.keepsID {
+				t.Errorf("Got request ID %q for header %q", echoed, tt.header)
+			}
+			if !requestid.Valid(echoed) {
+				t.Errorf("Expected a valid request ID, but got %q", echoed)
+			}
+		})
+	}
+}
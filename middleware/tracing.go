@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"user-api/tracing"
+	"user-api/util"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing serves each request in a server span, continuing the trace of the caller if it
+// sent a traceparent header. Spans are named after the method and the route pattern the
+// request matched, as returned by route, and requests answered with a 5xx status are
+// marked as failed.
+func Tracing(route func(*http.Request) string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			pattern := route(r)
+			name := r.Method
+			if pattern != "" {
+				name += " " + pattern
+			}
+
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracing.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("http.route", pattern),
+				attribute.String("client.address", util.ClientIP(r)),
+				attribute.String("user_agent.original", r.UserAgent()),
+			))
+			defer span.End()
+
+			recorder := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r.WithContext(ctx))
+
+			status := recorder.Status()
+			span.SetAttributes(attribute.Int("http.response.status_code", status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+		}
+	}
+}
+
+// Traced runs f in a span named name, as a child of the span of the request.
+func Traced(name string, f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracing.Start(r.Context(), name)
+		defer span.End()
+		f(w, r.WithContext(ctx))
+	}
+}
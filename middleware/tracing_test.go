@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-api/tracing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TestTracing tests that requests are served in a server span continuing the caller's
+// trace, with nested spans for wrapped handlers.
+func TestTracing(t *testing.T) {
+	memory := tracetest.NewInMemoryExporter()
+	tracing.SetProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(memory)))
+	defer tracing.Shutdown(context.Background())
+
+	route := func(r *http.Request) string { return "/items/{id}" }
+	handler := Tracing(route)(Traced("handler.Items", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	req := httptest.NewRequest("GET", "/items/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := memory.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, but got %d", len(spans))
+	}
+	inner, server := spans[0], spans[1]
+
+	if server.Name != "GET /items/{id}" || server.SpanKind != trace.SpanKindServer || server.Status.Code != codes.Error {
+		t.Errorf("Unexpected server span %+v", server)
+	}
+	if server.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || server.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("Expected the server span to continue the caller's trace, got %v", server.SpanContext)
+	}
+	if inner.Name != "handler.Items" || inner.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Errorf("Expected the handler span to nest under the server span, got %+v", inner)
+	}
+
+	var status int64
+	for _, attr := range server.Attributes {
+		if attr.Key == "http.response.status_code" {
+			status = attr.Value.AsInt64()
+		}
+	}
+	if status != http.StatusInternalServerError {
+		t.Errorf("Expected status code attribute 500, but got %v", status)
+	}
+}
@@ -0,0 +1,16 @@
+package notify
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Log is a Notifier writing messages to the server log instead of delivering them,
+// for development and deployments without a mail server.
+type Log struct{}
+
+// Notify implements Notifier.
+func (Log) Notify(ctx context.Context, m Message) error {
+	slog.InfoContext(ctx, "notification", "type", m.Type, "user_id", m.UserID, "to", m.To, "subject", m.Subject)
+	return nil
+}
@@ -0,0 +1,65 @@
+// Package notify sends notifications, such as security alerts, to users.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"user-api/config"
+)
+
+// Notification types.
+const (
+	TypeNewDeviceLogin = "new_device_login"
+)
+
+// Message is a notification addressed to a user.
+type Message struct {
+	Type    string `json:"type"` // One of the Type constants
+	UserID  int    `json:"user_id"`
+	To      string `json:"to"` // Email address of the user
+	Subject string `json:"subject"`
+	Body    string `json:"body"` // Plain text
+}
+
+// Notifier delivers messages.
+type Notifier interface {
+	Notify(ctx context.Context, m Message) error
+}
+
+// Pinger is implemented by notifiers delivering through another service, to check
+// that it is reachable without sending anything.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// New returns the notifier selected by NOTIFIER.
+func New() (Notifier, error) {
+	switch config.C.Notifier {
+	case "", "log":
+		return Log{}, nil
+	case "webhook":
+		if config.C.NotifyWebhookURL == "" {
+			return nil, errors.New("NOTIFY_WEBHOOK_URL must be set for the webhook notifier")
+		}
+		return &Webhook{URL: config.C.NotifyWebhookURL, Secret: config.C.NotifyWebhookSecret}, nil
+	case "smtp":
+		if config.C.SMTPAddr == "" || config.C.SMTPFrom == "" {
+			return nil, errors.New("SMTP_ADDR and SMTP_FROM must be set for the smtp notifier")
+		}
+		return &SMTP{
+			Addr:     config.C.SMTPAddr,
+			Username: config.C.SMTPUsername,
+			Password: config.C.SMTPPassword,
+			From:     config.C.SMTPFrom,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier %q", config.C.Notifier)
+	}
+}
+
+// singleLine replaces line breaks, so values can't inject headers or forge log lines.
+func singleLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,214 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestWebhook tests that messages are posted as JSON with a signature of the body.
+func TestWebhook(t *testing.T) {
+	var received Message
+	var signature string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get("X-Signature")
+		_ = json.Unmarshal(body, &received)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	webhook := &Webhook{URL: server.URL, Secret: "webhookSecret"}
+	message := Message{Type: TypeNewDeviceLogin, UserID: 7, To: "user@example.com", Subject: "New sign-in", Body: "Hello"}
+	if err := webhook.Notify(context.Background(), message); err != nil {
+		t.Fatalf("Failed to notify: %v", err)
+	}
+
+	if received != message {
+		t.Fatalf("Expected %+v to be posted, but got %+v", message, received)
+	}
+	mac := hmac.New(sha256.New, []byte("webhookSecret"))
+	mac.Write(body)
+	if expected := "sha256=" + hex.EncodeToString(mac.Sum(nil)); signature != expected {
+		t.Fatalf("Expected signature %s, but got %s", expected, signature)
+	}
+
+	// Non-2xx responses are errors
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	if err := (&Webhook{URL: failing.URL}).Notify(context.Background(), message); err == nil {
+		t.Fatal("Expected error for failed delivery, but got none")
+	}
+}
+
+// TestSMTP tests that messages are sent as well-formed emails that can't inject headers.
+func TestSMTP(t *testing.T) {
+	var sentFrom string
+	var sentTo []string
+	var sent []byte
+	original := sendMail
+	defer func() { sendMail = original }()
+	sendMail = func(ctx context.Context, addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		sentFrom, sentTo, sent = from, to, msg
+		return nil
+	}
+
+	notifier := &SMTP{Addr: "mail.example.com:587", From: "Accounts <accounts@example.com>"}
+	message := Message{To: "user@example.com", Subject: "New sign-in\r\nBcc: victim@example.com", Body: "Héllo"}
+	if err := notifier.Notify(context.Background(), message); err != nil {
+		t.Fatalf("Failed to notify: %v", err)
+	}
+
+	if sentFrom != "accounts@example.com" || len(sentTo) != 1 || sentTo[0] != "user@example.com" {
+		t.Fatalf("Unexpected envelope: from %s to %v", sentFrom, sentTo)
+	}
+	headers, body, _ := strings.Cut(string(sent), "\r\n\r\n")
+	if strings.Contains(headers, "\r\nBcc:") {
+		t.Fatalf("Expected subject not to inject headers, but got:\n%s", headers)
+	}
+	if !strings.Contains(headers, "Content-Type: text/plain; charset=utf-8") || body != "H=C3=A9llo" {
+		t.Fatalf("Expected quoted-printable UTF-8 body, but got:\n%s", sent)
+	}
+
+	if err := notifier.Notify(context.Background(), Message{Subject: "No recipient"}); err == nil {
+		t.Fatal("Expected error for message without recipient, but got none")
+	}
+}
+
+// TestPing tests that the SMTP and webhook notifiers check their server is reachable.
+func TestPing(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Write([]byte("220 mail.example.com ESMTP\r\n"))
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if strings.HasPrefix(line, "QUIT") {
+				_, _ = conn.Write([]byte("221 Bye\r\n"))
+				return
+			}
+			_, _ = conn.Write([]byte("250 mail.example.com\r\n"))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := (&SMTP{Addr: listener.Addr().String()}).Ping(ctx); err != nil {
+		t.Errorf("Expected the mail server to be reachable, but got %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected no request to be sent")
+	}))
+	webhook := &Webhook{URL: server.URL + "/notify"}
+	if err := webhook.Ping(ctx); err != nil {
+		t.Errorf("Expected the webhook to be reachable, but got %v", err)
+	}
+	server.Close()
+	if err := webhook.Ping(ctx); err == nil {
+		t.Error("Expected an error once the webhook is down")
+	}
+}
+
+// fakeMailServer accepts one connection on a local port and answers every command with
+// success, recording the message data. It returns the server's address.
+func fakeMailServer(t *testing.T, data *strings.Builder) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Write([]byte("220 mail.example.com ESMTP\r\n"))
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch {
+			case strings.HasPrefix(line, "DATA"):
+				_, _ = conn.Write([]byte("354 Go ahead\r\n"))
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				_, _ = conn.Write([]byte("250 Queued\r\n"))
+			case strings.HasPrefix(line, "QUIT"):
+				_, _ = conn.Write([]byte("221 Bye\r\n"))
+				return
+			default:
+				_, _ = conn.Write([]byte("250 mail.example.com\r\n"))
+			}
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// TestSMTPSend tests that messages are delivered to the mail server, and that a hung mail
+// server doesn't block the sender beyond its context's deadline.
+func TestSMTPSend(t *testing.T) {
+	var data strings.Builder
+	notifier := &SMTP{Addr: fakeMailServer(t, &data), From: "accounts@example.com"}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := notifier.Notify(ctx, Message{To: "user@example.com", Subject: "Hi", Body: "Hello"}); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if !strings.Contains(data.String(), "Subject: Hi") {
+		t.Fatalf("Expected the message to be sent, but got:\n%s", data.String())
+	}
+
+	// A server that accepts connections but never greets
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	hung := &SMTP{Addr: listener.Addr().String(), From: "accounts@example.com"}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := hung.Notify(ctx, Message{To: "user@example.com", Subject: "Hi"}); err == nil {
+		t.Fatal("Expected an error from a hung mail server")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected sending to give up at the deadline, but it took %v", elapsed)
+	}
+}
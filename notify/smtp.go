@@ -0,0 +1,156 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+// SMTP is a Notifier sending messages as plain text emails through a mail server.
+// The connection is upgraded with STARTTLS when the server supports it; credentials
+// are only sent over TLS or to localhost, as enforced by smtp.PlainAuth.
+type SMTP struct {
+	Addr     string // host:port of the mail server
+	Username string // Empty to send without authentication
+	Password string
+	From     string // Sender address, e.g. "Accounts <accounts@example.com>"
+}
+
+// sendMail sends msg like smtp.SendMail, but gives up once ctx is done. It is replaced in tests.
+var sendMail = func(ctx context.Context, addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+	client, err := dial(ctx, addr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		host, _, _ := net.SplitHostPort(addr)
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(msg); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// Notify implements Notifier. Sending is abandoned once ctx is done, so a slow or hung
+// mail server can't hold up the caller.
+func (s *SMTP) Notify(ctx context.Context, m Message) error {
+	if m.To == "" {
+		return errors.New("smtp: message has no recipient")
+	}
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return fmt.Errorf("smtp: invalid sender: %w", err)
+	}
+	to, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return fmt.Errorf("smtp: invalid recipient: %w", err)
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return fmt.Errorf("smtp: invalid address: %w", err)
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	message, err := buildEmail(from, to, m.Subject, m.Body, time.Now())
+	if err != nil {
+		return err
+	}
+	return sendMail(ctx, s.Addr, auth, from.Address, []string{to.Address}, message)
+}
+
+// Ping implements Pinger by connecting to the mail server, waiting for its greeting and
+// saying goodbye.
+func (s *SMTP) Ping(ctx context.Context) error {
+	client, err := dial(ctx, s.Addr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return client.Quit()
+}
+
+// dial connects to the mail server at addr and waits for its greeting. Once connected,
+// reads and writes fail at the deadline of ctx, if it has one.
+func dial(ctx context.Context, addr string) (*smtp.Client, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("smtp: invalid address: %w", err)
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("smtp: %w", err)
+	}
+	return client, nil
+}
+
+// buildEmail returns an RFC 5322 message with a quoted-printable UTF-8 text body.
+// The subject is encoded as an RFC 2047 word, so it can't inject headers.
+func buildEmail(from, to *mail.Address, subject, body string, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", singleLine(subject)))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	buf.WriteString("\r\n")
+
+	writer := quotedprintable.NewWriter(&buf)
+	if _, err := writer.Write([]byte(body)); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
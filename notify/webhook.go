@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+	"user-api/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Webhook is a Notifier posting messages as JSON to a URL, e.g. a service that sends
+// emails or push notifications. If Secret is set, the X-Signature header holds the
+// hex-encoded HMAC-SHA256 of the body, prefixed with "sha256=", so the receiver can
+// check that the request came from this server.
+type Webhook struct {
+	URL    string
+	Secret string
+	Client *http.Client // Defaults to a client with a 10 second timeout
+}
+
+// Notify implements Notifier. Any 2xx response counts as delivered. The request runs in a
+// client span and carries its traceparent, so the receiver can continue the trace.
+func (wh *Webhook) Notify(ctx context.Context, m Message) error {
+	ctx, span := tracing.Start(ctx, "POST webhook", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("http.request.method", http.MethodPost), attribute.String("notification.type", m.Type)))
+	defer span.End()
+
+	err := wh.post(ctx, m)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// Ping implements Pinger by opening a TCP connection to the webhook's host. It sends
+// no request, as the receiver might treat any request as a notification.
+func (wh *Webhook) Ping(ctx context.Context) error {
+	u, err := url.Parse(wh.URL)
+	if err != nil {
+		return err
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// post sends the message to the webhook.
+func (wh *Webhook) post(ctx context.Context, m Message) error {
+	body, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	if wh.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(wh.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	client := wh.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook %s: %s", wh.URL, resp.Status)
+	}
+	return nil
+}
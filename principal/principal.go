@@ -0,0 +1,68 @@
+// Package principal identifies services calling the API with a client certificate.
+// A certificate verified against the configured CAs is mapped by its subject to a
+// service principal, which handlers find in the request's context.
+package principal
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// Principal is a service authenticated by its client certificate.
+type Principal struct {
+	Name    string // Name the subject is mapped to, e.g. "billing"
+	Subject string // Subject of the certificate, e.g. "CN=billing.internal,O=Example"
+}
+
+// Map maps certificate subjects, in the RFC 2253 form returned by pkix.Name.String,
+// to principal names.
+type Map map[string]string
+
+// Parse parses semicolon-separated "<principal>=<subject>" pairs, as in TLS_CLIENT_PRINCIPALS,
+// e.g. "billing=CN=billing.internal,O=Example;reports=CN=reports.internal,O=Example".
+// Pairs are split at their first '=', so subjects may contain '=' but principal names can't;
+// neither can contain ';'.
+func Parse(value string) (Map, error) {
+	m := make(Map)
+	for _, pair := range strings.Split(value, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, subject, ok := strings.Cut(pair, "=")
+		name, subject = strings.TrimSpace(name), strings.TrimSpace(subject)
+		if !ok || name == "" || subject == "" {
+			return nil, fmt.Errorf("invalid principal mapping %q: expected <principal>=<subject>", pair)
+		}
+		if other, exists := m[subject]; exists && other != name {
+			return nil, fmt.Errorf("subject %q is mapped to both %q and %q", subject, other, name)
+		}
+		m[subject] = name
+	}
+	return m, nil
+}
+
+// Lookup returns the principal cert's subject is mapped to. cert must have been verified.
+func (m Map) Lookup(cert *x509.Certificate) (Principal, bool) {
+	subject := cert.Subject.String()
+	name, ok := m[subject]
+	if !ok {
+		return Principal{}, false
+	}
+	return Principal{Name: name, Subject: subject}, true
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the principal.
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal carried by ctx, if the request was authenticated
+// by a mapped client certificate.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(Principal)
+	return p, ok
+}
@@ -0,0 +1,49 @@
+package principal
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+)
+
+// TestParse tests that mappings are parsed and that malformed or conflicting ones are rejected.
+func TestParse(t *testing.T) {
+	m, err := Parse("billing=CN=billing.internal,O=Example; reports = CN=reports.internal,O=Example;")
+	if err != nil {
+		t.Fatalf("Failed to parse mappings: %v", err)
+	}
+	if len(m) != 2 || m["CN=billing.internal,O=Example"] != "billing" || m["CN=reports.internal,O=Example"] != "reports" {
+		t.Fatalf("Unexpected mappings: %v", m)
+	}
+	if m, err := Parse(""); err != nil || len(m) != 0 {
+		t.Errorf("Expected no mappings, but got %v and %v", m, err)
+	}
+
+	for _, value := range []string{"billing", "=CN=billing.internal", "billing=", "a=CN=x;b=CN=x"} {
+		if _, err := Parse(value); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
+
+// TestLookup tests that certificates are mapped by their subject and the principal travels in a context.
+func TestLookup(t *testing.T) {
+	m := Map{"CN=billing.internal,O=Example": "billing"}
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "billing.internal", Organization: []string{"Example"}}}
+	p, ok := m.Lookup(cert)
+	if !ok || p.Name != "billing" || p.Subject != "CN=billing.internal,O=Example" {
+		t.Fatalf("Unexpected principal %+v", p)
+	}
+	if _, ok := m.Lookup(&x509.Certificate{Subject: pkix.Name{CommonName: "billing.internal"}}); ok {
+		t.Error("Expected a certificate with a different subject not to be mapped")
+	}
+
+	if _, ok := FromContext(context.Background()); ok {
+		t.Error("Expected no principal in an empty context")
+	}
+	if got, ok := FromContext(NewContext(context.Background(), p)); !ok || got != p {
+		t.Errorf("Expected %+v from the context, but got %+v", p, got)
+	}
+}
@@ -0,0 +1,55 @@
+// Package requestid identifies requests, so client reports, error responses, logs and
+// audit events about the same request can be correlated.
+package requestid
+
+import (
+	"context"
+	"user-api/util"
+)
+
+// Header is the request and response header carrying the request ID.
+const Header = "X-Request-ID"
+
+// MaxLength is the maximum length of a request ID accepted from a client.
+const MaxLength = 128
+
+type contextKey struct{}
+
+// New returns a random request ID.
+func New() string {
+	id, err := util.RandomString(12)
+	if err != nil {
+		return "unknown"
+	}
+	return id
+}
+
+// Valid reports whether id is acceptable as a request ID sent by a client: 1 to MaxLength
+// ASCII letters, digits or any of "-_.:". Other IDs are replaced, so clients can't inject
+// arbitrary text into logs and responses.
+func Valid(id string) bool {
+	if id == "" || len(id) > MaxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// NewContext returns a context carrying the request ID.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID carried by ctx, or an empty string if it has none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
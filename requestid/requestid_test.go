@@ -0,0 +1,37 @@
+package requestid
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// TestValid tests which client-provided request IDs are accepted.
+func TestValid(t *testing.T) {
+	valid := []string{"abc", "3f2b9c1e-8a4d-4c6e-9f1a-2b3c4d5e6f70", "trace:42.1_x", strings.Repeat("a", MaxLength)}
+	invalid := []string{"", "with space", "line\nbreak", "quote\"", "ünïcode", strings.Repeat("a", MaxLength+1)}
+
+	for _, id := range valid {
+		if !Valid(id) {
+			t.Errorf("Expected %q to be valid", id)
+		}
+	}
+	for _, id := range invalid {
+		if Valid(id) {
+			t.Errorf("Expected %q to be invalid", id)
+		}
+	}
+	if id := New(); !Valid(id) {
+		t.Errorf("Expected generated ID %q to be valid", id)
+	}
+}
+
+// TestContext tests that request IDs are carried by contexts.
+func TestContext(t *testing.T) {
+	if id := FromContext(context.Background()); id != "" {
+		t.Errorf("Expected no request ID, but got %q", id)
+	}
+	if id := FromContext(NewContext(context.Background(), "abc")); id != "abc" {
+		t.Errorf("Expected request ID abc, but got %q", id)
+	}
+}
@@ -0,0 +1,110 @@
+package servertls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader serves a certificate and key pair from files, reloading them when they change
+// on disk, so renewed certificates are picked up without a restart. Until both files hold
+// a valid pair again, for example while they are being replaced one at a time, the
+// previous certificate keeps being served.
+type Reloader struct {
+	certFile, keyFile string
+
+	mutex   sync.RWMutex
+	cert    *tls.Certificate
+	version [2]fileVersion // Versions of the certificate and key files cert was loaded from
+}
+
+// fileVersion tells whether a file changed since it was loaded.
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewReloader returns a reloader serving the pair in certFile and keyFile, which must be valid.
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate. It is used as tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.cert, nil
+}
+
+// Reload loads the certificate and key files if either changed since they were last
+// loaded, and reports whether they did. On error the current certificate is kept.
+func (r *Reloader) Reload() (bool, error) {
+	version, err := r.versions()
+	if err != nil {
+		return false, err
+	}
+	r.mutex.RLock()
+	unchanged := r.cert != nil && version == r.version
+	r.mutex.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return false, fmt.Errorf("failed to parse TLS certificate: %w", err)
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.cert, r.version = &cert, version
+	return true, nil
+}
+
+// Run checks the files for changes every interval until ctx is done, logging reloads and failures.
+func (r *Reloader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			if err != nil {
+				slog.Error("failed to reload TLS certificate", "cert_file", r.certFile, "error", err)
+			} else if reloaded {
+				cert, _ := r.GetCertificate(nil)
+				slog.Info("reloaded TLS certificate", "cert_file", r.certFile, "not_after", cert.Leaf.NotAfter)
+			}
+		}
+	}
+}
+
+// versions returns the current versions of the certificate and key files.
+func (r *Reloader) versions() ([2]fileVersion, error) {
+	var version [2]fileVersion
+	for i, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return version, err
+		}
+		version[i] = fileVersion{modTime: info.ModTime(), size: info.Size()}
+	}
+	return version, nil
+}
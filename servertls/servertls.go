@@ -0,0 +1,138 @@
+// Package servertls configures TLS termination by the server itself, for deployments
+// without a TLS-terminating proxy in front of it. The certificate is reloaded when its
+// files change on disk, and clients may authenticate with certificates of their own.
+package servertls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"user-api/config"
+)
+
+// New returns the server's TLS configuration and the reloader serving its certificate,
+// built from TLS_CERT_FILE, TLS_KEY_FILE and the other TLS settings. It returns a nil
+// configuration if TLS_CERT_FILE is not set, so plain HTTP is served.
+func New() (*tls.Config, *Reloader, error) {
+	if config.C.TLSCertFile == "" {
+		return nil, nil, nil
+	}
+	if config.C.TLSKeyFile == "" {
+		return nil, nil, errors.New("TLS_KEY_FILE must be set when TLS_CERT_FILE is set")
+	}
+
+	minVersion, err := ParseVersion(config.C.TLSMinVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	cipherSuites, err := ParseCipherSuites(config.C.TLSCipherSuites)
+	if err != nil {
+		return nil, nil, err
+	}
+	if minVersion == tls.VersionTLS13 && cipherSuites != nil {
+		return nil, nil, errors.New("TLS_CIPHER_SUITES has no effect when TLS_MIN_VERSION is 1.3")
+	}
+	clientAuth, err := parseClientAuth(config.C.TLSClientAuth)
+	if err != nil {
+		return nil, nil, err
+	}
+	reloader, err := NewReloader(config.C.TLSCertFile, config.C.TLSKeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		ClientAuth:     clientAuth,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if clientAuth != tls.NoClientCert {
+		if config.C.TLSClientCAFile == "" {
+			return nil, nil, errors.New("TLS_CLIENT_CA_FILE must be set when TLS_CLIENT_AUTH is not none")
+		}
+		tlsConfig.ClientCAs, err = loadCertPool(config.C.TLSClientCAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return tlsConfig, reloader, nil
+}
+
+// ParseVersion returns the TLS version named by value, "1.2" or "1.3". Older versions
+// are not supported.
+func ParseVersion(value string) (uint16, error) {
+	switch value {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version %q: expected 1.2 or 1.3", value)
+	}
+}
+
+// ParseCipherSuites returns the IDs of the comma-separated cipher suites named in value,
+// or nil for Go's defaults if value is empty. Only suites without known security issues
+// are accepted. Cipher suites only apply to TLS 1.2; TLS 1.3 suites are not configurable,
+// so naming one is an error rather than a restriction that silently has no effect.
+func ParseCipherSuites(value string) ([]uint16, error) {
+	supported := make(map[string]uint16)
+	tls13 := make(map[string]bool)
+	for _, suite := range tls.CipherSuites() {
+		if slices.Contains(suite.SupportedVersions, tls.VersionTLS12) {
+			supported[suite.Name] = suite.ID
+		} else {
+			tls13[suite.Name] = true
+		}
+	}
+
+	var ids []uint16
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if tls13[name] {
+			return nil, fmt.Errorf("cipher suite %q is a TLS 1.3 suite, which can't be configured", name)
+		}
+		id, ok := supported[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// parseClientAuth returns the client certificate policy named by value. Certificates are
+// verified against the client CAs whenever they are presented.
+func parseClientAuth(value string) (tls.ClientAuthType, error) {
+	switch value {
+	case "", "none":
+		return tls.NoClientCert, nil
+	case "optional":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return 0, fmt.Errorf("unknown client authentication %q: expected none, optional or require", value)
+	}
+}
+
+// loadCertPool returns a pool of the PEM certificates in the file at path.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
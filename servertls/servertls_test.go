@@ -0,0 +1,227 @@
+package servertls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"user-api/config"
+)
+
+// authority issues certificates for tests.
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newAuthority(t *testing.T) *authority {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create CA certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &authority{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns PEM certificate and key of a leaf for subject, usable by servers for
+// localhost or by clients.
+func (a *authority) issue(t *testing.T, subject pkix.Name, serial int64) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      subject,
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.cert, &key.PublicKey, a.key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeFile writes data to the file at path, failing the test on error.
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+// TestParse tests parsing of TLS versions and cipher suites.
+func TestParse(t *testing.T) {
+	if v, err := ParseVersion("1.3"); err != nil || v != tls.VersionTLS13 {
+		t.Errorf("Expected TLS 1.3, but got %x and %v", v, err)
+	}
+	if v, err := ParseVersion(""); err != nil || v != tls.VersionTLS12 {
+		t.Errorf("Expected TLS 1.2 by default, but got %x and %v", v, err)
+	}
+	if _, err := ParseVersion("1.0"); err == nil {
+		t.Error("Expected TLS 1.0 to be rejected")
+	}
+
+	ids, err := ParseCipherSuites("TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384")
+	if err != nil || len(ids) != 2 || ids[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("Unexpected cipher suites %x and %v", ids, err)
+	}
+	if ids, err := ParseCipherSuites(""); err != nil || ids != nil {
+		t.Errorf("Expected Go's defaults, but got %x and %v", ids, err)
+	}
+	// Insecure suites are not accepted
+	if _, err := ParseCipherSuites("TLS_RSA_WITH_RC4_128_SHA"); err == nil {
+		t.Error("Expected an insecure cipher suite to be rejected")
+	}
+	// TLS 1.3 suites can't be configured, so naming one would have no effect
+	if _, err := ParseCipherSuites("TLS_AES_128_GCM_SHA256"); err == nil {
+		t.Error("Expected a TLS 1.3 cipher suite to be rejected")
+	}
+}
+
+// TestReloader tests that changed files are reloaded, and that the previous certificate
+// is kept while the files don't hold a valid pair.
+func TestReloader(t *testing.T) {
+	ca := newAuthority(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	certPEM, keyPEM := ca.issue(t, pkix.Name{CommonName: "first"}, 2)
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	subject := func() string {
+		cert, _ := r.GetCertificate(nil)
+		return cert.Leaf.Subject.CommonName
+	}
+	if reloaded, err := r.Reload(); reloaded || err != nil {
+		t.Fatalf("Expected unchanged files not to be reloaded, but got %v and %v", reloaded, err)
+	}
+
+	// Only the certificate is replaced so far: it doesn't match the key
+	certPEM, keyPEM = ca.issue(t, pkix.Name{CommonName: "second"}, 3)
+	writeFile(t, certFile, certPEM)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	if _, err := r.Reload(); err == nil {
+		t.Fatal("Expected a mismatched pair to fail to load")
+	}
+	if subject() != "first" {
+		t.Fatalf("Expected the previous certificate to be kept, but got %q", subject())
+	}
+
+	writeFile(t, keyFile, keyPEM)
+	os.Chtimes(keyFile, later, later)
+	if reloaded, err := r.Reload(); !reloaded || err != nil {
+		t.Fatalf("Expected the new pair to be reloaded, but got %v and %v", reloaded, err)
+	}
+	if subject() != "second" {
+		t.Errorf("Expected the new certificate, but got %q", subject())
+	}
+}
+
+// TestNew tests that a server configured by New requires verified client certificates
+// when TLS_CLIENT_AUTH is require.
+func TestNew(t *testing.T) {
+	ca := newAuthority(t)
+	dir := t.TempDir()
+	certPEM, keyPEM := ca.issue(t, pkix.Name{CommonName: "localhost"}, 2)
+	writeFile(t, filepath.Join(dir, "tls.crt"), certPEM)
+	writeFile(t, filepath.Join(dir, "tls.key"), keyPEM)
+	writeFile(t, filepath.Join(dir, "ca.crt"), ca.pem)
+
+	t.Cleanup(func() { config.C = config.Config{} })
+	config.C = config.Config{
+		TLSCertFile:     filepath.Join(dir, "tls.crt"),
+		TLSKeyFile:      filepath.Join(dir, "tls.key"),
+		TLSMinVersion:   "1.2",
+		TLSClientAuth:   "require",
+		TLSClientCAFile: filepath.Join(dir, "ca.crt"),
+	}
+	tlsConfig, _, err := New()
+	if err != nil {
+		t.Fatalf("Failed to set up TLS: %v", err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.String()))
+	}))
+	server.TLS = tlsConfig
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(certificates ...tls.Certificate) (*http.Response, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: certificates,
+			ServerName:   "localhost",
+		}}}
+		defer client.CloseIdleConnections()
+		return client.Get(server.URL)
+	}
+
+	if _, err := get(); err == nil {
+		t.Error("Expected a client without a certificate to be rejected")
+	}
+
+	clientCertPEM, clientKeyPEM := ca.issue(t, pkix.Name{CommonName: "billing.internal", Organization: []string{"Example"}}, 3)
+	clientCert, _ := tls.X509KeyPair(clientCertPEM, clientKeyPEM)
+	resp, err := get(clientCert)
+	if err != nil {
+		t.Fatalf("Expected a client with a certificate to be accepted, but got %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "CN=billing.internal,O=Example" {
+		t.Errorf("Expected the verified client subject, but got status %d and %q", resp.StatusCode, body)
+	}
+
+	// Missing settings are reported
+	config.C.TLSClientCAFile = ""
+	if _, _, err := New(); err == nil {
+		t.Error("Expected client authentication without CAs to be rejected")
+	}
+
+	// Cipher suites don't apply when only TLS 1.3 is allowed
+	config.C = config.Config{
+		TLSCertFile:     filepath.Join(dir, "tls.crt"),
+		TLSKeyFile:      filepath.Join(dir, "tls.key"),
+		TLSMinVersion:   "1.3",
+		TLSCipherSuites: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	}
+	if _, _, err := New(); err == nil {
+		t.Error("Expected cipher suites with TLS 1.3 only to be rejected")
+	}
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"user-api/audit"
+)
+
+// maxAuditEvents is the number of audit events kept in the store; older ones are dropped,
+// so clients can't grow memory without limit, e.g. by failing to log in. The audit log
+// file keeps every event.
+const maxAuditEvents = 10000
+
+// AuditSink is an audit.Sink keeping the most recent events in the store, so they can be
+// queried by user. Like the rest of the store, events are lost on restart.
+type AuditSink struct{}
+
+// Write implements audit.Sink. Once maxAuditEvents are kept, each event replaces the oldest.
+func (AuditSink) Write(e audit.Event) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if len(store.auditEvents) < maxAuditEvents {
+		store.auditEvents = append(store.auditEvents, e)
+		return nil
+	}
+	store.auditEvents[store.auditNext] = e
+	store.auditNext = (store.auditNext + 1) % len(store.auditEvents)
+	return nil
+}
+
+// AuditFilter narrows the events returned by ListAuditEvents. Zero values match all events.
+type AuditFilter struct {
+	UserID int    // User the event was performed by or applies to
+	Type   string // Event type
+}
+
+// ListAuditEvents returns a page of the audit events matching filter, most recent first,
+// together with the total number of matching events. A non-positive limit returns all remaining events.
+func ListAuditEvents(ctx context.Context, filter AuditFilter, offset, limit int) ([]audit.Event, int) {
+	_, done := observe(ctx, "list_audit_events")
+	defer done()
+
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	matches := make([]audit.Event, 0)
+	n := len(store.auditEvents)
+	for i := 1; i <= n; i++ {
+		// The most recent event is the one before auditNext, wrapping around
+		e := store.auditEvents[(store.auditNext-i+n)%n]
+		if filter.UserID != 0 && e.ActorID != filter.UserID && e.TargetID != filter.UserID {
+			continue
+		}
+		if filter.Type != "" && e.Type != filter.Type {
+			continue
+		}
+		matches = append(matches, e)
+	}
+
+	total := len(matches)
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > total {
+		offset = total
+	}
+	end := total
+	if limit > 0 && offset+limit < total {
+		end = offset + limit
+	}
+	return matches[offset:end], total
+}
@@ -0,0 +1,47 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"user-api/audit"
+)
+
+// TestListAuditEvents tests that audit events are listed most recent first and filtered by user and type.
+func TestListAuditEvents(t *testing.T) {
+	sink := AuditSink{}
+	_ = sink.Write(audit.Event{Seq: 1, Type: audit.TypeLogin, ActorID: 9001, TargetID: 9001})
+	_ = sink.Write(audit.Event{Seq: 2, Type: audit.TypeAdminDisable, ActorID: 9002, TargetID: 9001})
+	_ = sink.Write(audit.Event{Seq: 3, Type: audit.TypeLogin, ActorID: 9002, TargetID: 9002})
+
+	events, total := ListAuditEvents(context.Background(), AuditFilter{UserID: 9001}, 0, 0)
+	if total != 2 || len(events) != 2 || events[0].Seq != 2 || events[1].Seq != 1 {
+		t.Fatalf("Expected events 2 and 1 of user 9001, but got %+v", events)
+	}
+
+	events, total = ListAuditEvents(context.Background(), AuditFilter{UserID: 9002, Type: audit.TypeLogin}, 0, 0)
+	if total != 1 || events[0].Seq != 3 {
+		t.Fatalf("Expected login event 3 of user 9002, but got %+v", events)
+	}
+
+	events, total = ListAuditEvents(context.Background(), AuditFilter{UserID: 9001}, 1, 1)
+	if total != 2 || len(events) != 1 || events[0].Seq != 1 {
+		t.Fatalf("Expected second page to hold event 1, but got %+v", events)
+	}
+}
+
+// TestAuditSinkLimit tests that only the most recent maxAuditEvents events are kept.
+func TestAuditSinkLimit(t *testing.T) {
+	sink := AuditSink{}
+	for i := 1; i <= maxAuditEvents+3; i++ {
+		_ = sink.Write(audit.Event{Seq: uint64(i), Type: audit.TypeLogin, TargetID: 9003})
+	}
+
+	events, total := ListAuditEvents(context.Background(), AuditFilter{UserID: 9003}, 0, 0)
+	if total != maxAuditEvents || len(events) != maxAuditEvents {
+		t.Fatalf("Expected %d events, but got %d", maxAuditEvents, total)
+	}
+	// The three oldest events were dropped
+	if events[0].Seq != maxAuditEvents+3 || events[len(events)-1].Seq != 4 {
+		t.Fatalf("Expected events %d to 4, but got %d to %d", maxAuditEvents+3, events[0].Seq, events[len(events)-1].Seq)
+	}
+}
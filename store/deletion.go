@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"time"
+	"user-api/config"
+)
+
+// defaultDeletionGracePeriod is used when no account deletion grace period is configured.
+const defaultDeletionGracePeriod = 30 * 24 * time.Hour
+
+// PurgeAt returns the time at which a user pending deletion will be permanently erased,
+// or the zero time if the user is not pending deletion.
+func (u User) PurgeAt() time.Time {
+	if u.DeletedAt.IsZero() {
+		return time.Time{}
+	}
+	return u.DeletedAt.Add(deletionGracePeriod())
+}
+
+// RestoreUser cancels the pending deletion of a user. Tokens revoked by the deletion stay revoked.
+// Returns an error if the user is not found, its grace period has ended, or it is not pending deletion.
+func RestoreUser(ctx context.Context, id int) error {
+	_, done := observe(ctx, "restore_user")
+	defer done()
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	storeUser, exists := store.userByID[id]
+	if !exists || (!storeUser.DeletedAt.IsZero() && !time.Now().Before(storeUser.PurgeAt())) {
+		return ErrUserNotFound
+	}
+	if storeUser.DeletedAt.IsZero() {
+		return ErrUserNotDeleted
+	}
+	storeUser.DeletedAt = time.Time{}
+	touch(storeUser)
+
+	return nil
+}
+
+// PurgeDeletedUsers permanently erases the users whose deletion grace period ended by now,
+// along with their login history, blacklisted tokens and reserved usernames. Expired blacklist entries
+// are dropped as well, as the tokens are rejected anyway.
+//
+// Returns:
+// - the erased users, so callers can delete data kept outside the store, such as avatars.
+func PurgeDeletedUsers(ctx context.Context, now time.Time) []User {
+	_, done := observe(ctx, "purge_deleted_users")
+	defer done()
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var purged []User
+	purgedIDs := make(map[int]bool)
+	for _, u := range store.userByID {
+		if u.DeletedAt.IsZero() || now.Before(u.PurgeAt()) {
+			continue
+		}
+		removeUser(u)
+		delete(store.loginHistory, u.ID)
+		delete(store.knownDevices, u.ID)
+		purged = append(purged, *u)
+		purgedIDs[u.ID] = true
+	}
+
+	for token, entry := range store.blacklistedTokens {
+		expired := !entry.expiresAt.IsZero() && !now.Before(entry.expiresAt)
+		if purgedIDs[entry.userID] || expired {
+			delete(store.blacklistedTokens, token)
+		}
+	}
+	for key, reservation := range store.reservedUsernames {
+		if purgedIDs[reservation.userID] {
+			delete(store.reservedUsernames, key)
+		}
+	}
+
+	return purged
+}
+
+// RunPurger calls PurgeDeletedUsers every interval until ctx is done.
+// onPurge, if not nil, is called for every erased user.
+func RunPurger(ctx context.Context, interval time.Duration, onPurge func(User)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, u := range PurgeDeletedUsers(ctx, now) {
+				if onPurge != nil {
+					onPurge(u)
+				}
+			}
+		}
+	}
+}
+
+// deletionGracePeriod returns the configured account deletion grace period, or the default if unset.
+func deletionGracePeriod() time.Duration {
+	if config.C.AccountDeletionGracePeriod > 0 {
+		return config.C.AccountDeletionGracePeriod
+	}
+	return defaultDeletionGracePeriod
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestRestoreUser tests that a user pending deletion can be restored until the grace period ends.
+func TestRestoreUser(t *testing.T) {
+	user := User{Username: "RestoreTestUser", Email: "RestoreTest@email.com", Password: "restorePassword"}
+	if err := CreateUser(context.Background(), &user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// Only users pending deletion can be restored
+	if err := RestoreUser(context.Background(), user.ID); !errors.Is(err, ErrUserNotDeleted) {
+		t.Fatalf("Expected not deleted error, but got %v", err)
+	}
+
+	issuedAt := time.Now().Add(-time.Minute)
+	if err := DeleteUserByID(context.Background(), user.ID, 0); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	if err := RestoreUser(context.Background(), user.ID); err != nil {
+		t.Fatalf("Failed to restore user: %v", err)
+	}
+
+	restored, err := GetUserByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("Failed to retrieve restored user: %v", err)
+	}
+	if !restored.DeletedAt.IsZero() {
+		t.Fatalf("Expected restored user not to be pending deletion, but got deleted at %v", restored.DeletedAt)
+	}
+
+	// Tokens issued before the deletion stay revoked; new ones are accepted
+	if !IsTokenRevoked(context.Background(), user.ID, issuedAt) {
+		t.Fatal("Expected tokens issued before the deletion to stay revoked")
+	}
+	if IsTokenRevoked(context.Background(), user.ID, time.Now().Add(time.Minute)) {
+		t.Fatal("Expected tokens issued after the restore to be accepted")
+	}
+
+	// Restored users are not purged
+	PurgeDeletedUsers(context.Background(), time.Now().Add(100*365*24*time.Hour))
+	if _, err := GetUserByID(context.Background(), user.ID); err != nil {
+		t.Fatalf("Expected restored user to be kept, but got %v", err)
+	}
+}
+
+// TestRestoreUserAfterGracePeriod tests that a user can't be restored once the grace period has ended.
+func TestRestoreUserAfterGracePeriod(t *testing.T) {
+	user := User{Username: "LateRestoreUser", Email: "LateRestore@email.com", Password: "restorePassword"}
+	if err := CreateUser(context.Background(), &user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := DeleteUserByID(context.Background(), user.ID, 0); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+
+	// Move the deletion back past the grace period, as if the purger hadn't run yet
+	store.mutex.Lock()
+	store.userByID[user.ID].DeletedAt = time.Now().Add(-deletionGracePeriod() - time.Second)
+	store.mutex.Unlock()
+
+	if err := RestoreUser(context.Background(), user.ID); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("Expected not found error restoring user after the grace period, but got %v", err)
+	}
+}
+
+// TestPurgeDeletedUsers tests that purging erases the user along with their blacklisted
+// tokens and reserved usernames, and drops expired blacklist entries.
+func TestPurgeDeletedUsers(t *testing.T) {
+	user := User{Username: "PurgeTestUser", Email: "PurgeTest@email.com", Password: "purgePassword"}
+	if err := CreateUser(context.Background(), &user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := RenameUser(context.Background(), user.ID, "PurgeTestRenamed"); err != nil {
+		t.Fatalf("Failed to rename user: %v", err)
+	}
+	AddTokenToBlacklist(context.Background(), "purgeUserToken", user.ID, time.Now().Add(100*365*24*time.Hour))
+	AddTokenToBlacklist(context.Background(), "purgeExpiredToken", user.ID+1, time.Now().Add(-time.Second))
+	AddTokenToBlacklist(context.Background(), "purgeValidToken", user.ID+1, time.Now().Add(100*365*24*time.Hour))
+
+	if err := DeleteUserByID(context.Background(), user.ID, 0); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	deleted, _ := GetUserByID(context.Background(), user.ID)
+
+	purged := PurgeDeletedUsers(context.Background(), deleted.PurgeAt())
+	found := false
+	for _, u := range purged {
+		found = found || u.ID == user.ID
+	}
+	if !found {
+		t.Fatalf("Expected user %d to be returned as purged", user.ID)
+	}
+
+	if _, err := GetUserByID(context.Background(), user.ID); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("Expected not found error retrieving purged user, but got %v", err)
+	}
+	if IsTokenBlacklisted(context.Background(), "purgeUserToken") {
+		t.Fatal("Expected blacklisted tokens of the purged user to be dropped")
+	}
+	if IsTokenBlacklisted(context.Background(), "purgeExpiredToken") {
+		t.Fatal("Expected expired blacklist entries to be dropped")
+	}
+	if !IsTokenBlacklisted(context.Background(), "purgeValidToken") {
+		t.Fatal("Expected unexpired blacklist entries of other users to be kept")
+	}
+
+	// The previous username is released along with the current one
+	other := User{Username: "PurgeTestUser", Email: "PurgeTestOther@email.com", Password: "purgePassword"}
+	if err := CreateUser(context.Background(), &other); err != nil {
+		t.Fatalf("Expected previous username of purged user to be released, but got %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package store
+
+import "errors"
+
+// Error kinds. Every *Error wraps one of these, so callers can classify store
+// errors with errors.Is without knowing every specific error.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrValidation   = errors.New("validation failed")
+	ErrPrecondition = errors.New("precondition failed")
+)
+
+// Error is an error returned by the store with a stable, machine-readable code.
+// Errors are compared by identity, e.g. errors.Is(err, ErrEmailTaken), or by
+// kind, e.g. errors.Is(err, ErrConflict).
+type Error struct {
+	Kind    error  // One of ErrNotFound, ErrConflict, ErrValidation or ErrPrecondition
+	Code    string // Stable identifier of the error, e.g. "email_taken"
+	Message string // Human-readable description, safe to show to clients
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the kind of the error.
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// Errors returned by the store.
+var (
+	ErrUserNotFound      = &Error{ErrNotFound, "user_not_found", "user not found"}
+	ErrUsernameTaken     = &Error{ErrConflict, "username_taken", "username already exists"}
+	ErrUsernameReserved  = &Error{ErrConflict, "username_reserved", "username is reserved"}
+	ErrEmailTaken        = &Error{ErrConflict, "email_taken", "email already exists"}
+	ErrUsernameUnchanged = &Error{ErrValidation, "username_unchanged", "username unchanged"}
+	ErrRoleRequired      = &Error{ErrValidation, "role_required", "at least one role is required"}
+	ErrVersionMismatch   = &Error{ErrPrecondition, "version_mismatch", "user was modified concurrently"}
+	ErrPasswordChanged   = &Error{ErrPrecondition, "password_changed", "password was changed concurrently"}
+	ErrUserNotDeleted    = &Error{ErrConflict, "user_not_deleted", "user is not pending deletion"}
+	ErrLastAdmin         = &Error{ErrConflict, "last_admin", "user is the last active administrator"}
+)
+
+// validationError returns an *Error of kind ErrValidation with the given code and message.
+func validationError(code, message string) *Error {
+	return &Error{ErrValidation, code, message}
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"time"
+	"user-api/util"
+)
+
+// maxLoginHistory is the number of login attempts kept per user; older ones are dropped.
+const maxLoginHistory = 50
+
+// LoginAttempt is an entry of a user's login history.
+type LoginAttempt struct {
+	Time      time.Time      `json:"time"`
+	IP        string         `json:"ip"`
+	UserAgent util.UserAgent `json:"user_agent"`
+	Success   bool           `json:"success"`
+	Reason    string         `json:"reason,omitempty"`     // Error code of failed attempts
+	NewDevice bool           `json:"new_device,omitempty"` // Successful login from an unfamiliar device
+}
+
+// AddLoginAttempt appends an attempt to log in as an existing user to their login history.
+// Successful attempts from a device, identified by the fingerprint of its user agent and
+// network, that the user never logged in from before are marked as NewDevice, unless it is the user's first
+// device. The attempt is returned as stored.
+// Returns an error if the user is not found.
+func AddLoginAttempt(ctx context.Context, userID int, attempt LoginAttempt) (LoginAttempt, error) {
+	_, done := observe(ctx, "add_login_attempt")
+	defer done()
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, exists := store.userByID[userID]; !exists {
+		return LoginAttempt{}, ErrUserNotFound
+	}
+
+	if attempt.Success {
+		devices := store.knownDevices[userID]
+		if devices == nil {
+			devices = make(map[string]bool)
+			store.knownDevices[userID] = devices
+		}
+		fingerprint := attempt.UserAgent.Fingerprint(attempt.IP)
+		attempt.NewDevice = len(devices) > 0 && !devices[fingerprint]
+		devices[fingerprint] = true
+	}
+
+	history := append(store.loginHistory[userID], attempt)
+	if len(history) > maxLoginHistory {
+		history = append([]LoginAttempt(nil), history[len(history)-maxLoginHistory:]...)
+	}
+	store.loginHistory[userID] = history
+
+	return attempt, nil
+}
+
+// LoginHistory returns up to limit of the user's most recent login attempts, most recent
+// first. A non-positive limit returns the whole history.
+func LoginHistory(ctx context.Context, userID, limit int) []LoginAttempt {
+	_, done := observe(ctx, "login_history")
+	defer done()
+
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	history := store.loginHistory[userID]
+	if limit <= 0 || limit > len(history) {
+		limit = len(history)
+	}
+	attempts := make([]LoginAttempt, 0, limit)
+	for i := len(history) - 1; i >= len(history)-limit; i-- {
+		attempts = append(attempts, history[i])
+	}
+	return attempts
+}
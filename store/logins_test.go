@@ -0,0 +1,61 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+	"user-api/util"
+)
+
+// TestLoginHistory tests that login attempts are kept most recent first, capped, and that
+// only successful logins from unfamiliar devices are marked as new.
+func TestLoginHistory(t *testing.T) {
+	user := User{Username: "LoginHistoryUser", Email: "LoginHistory@email.com", Password: "historyPassword"}
+	if err := CreateUser(context.Background(), &user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	laptop := util.UserAgent{Browser: "Firefox", BrowserVersion: "127", OS: "Linux", Device: "Desktop"}
+	phone := util.UserAgent{Browser: "Safari", BrowserVersion: "17", OS: "iOS", Device: "Mobile"}
+
+	steps := []struct {
+		attempt   LoginAttempt
+		newDevice bool
+	}{
+		{LoginAttempt{UserAgent: laptop, Success: true}, false}, // The first device is not unfamiliar
+		{LoginAttempt{UserAgent: laptop, Success: true}, false},
+		{LoginAttempt{UserAgent: phone, Success: false, Reason: "invalid_credentials"}, false},
+		{LoginAttempt{UserAgent: phone, Success: true}, true},
+		{LoginAttempt{UserAgent: phone, Success: true}, false},
+	}
+	for i, step := range steps {
+		step.attempt.Time = time.Now().Add(time.Duration(i) * time.Second)
+		stored, err := AddLoginAttempt(context.Background(), user.ID, step.attempt)
+		if err != nil {
+			t.Fatalf("Failed to add login attempt %d: %v", i, err)
+		}
+		if stored.NewDevice != step.newDevice {
+			t.Errorf("Attempt %d: expected new device %v, but got %v", i, step.newDevice, stored.NewDevice)
+		}
+	}
+
+	history := LoginHistory(context.Background(), user.ID, 2)
+	if len(history) != 2 || !history[0].Time.After(history[1].Time) {
+		t.Fatalf("Expected the 2 most recent attempts, most recent first, but got %+v", history)
+	}
+	if len(LoginHistory(context.Background(), user.ID, 0)) != len(steps) {
+		t.Fatalf("Expected the whole history of %d attempts", len(steps))
+	}
+
+	// Only the most recent attempts are kept
+	for i := 0; i < maxLoginHistory; i++ {
+		_, _ = AddLoginAttempt(context.Background(), user.ID, LoginAttempt{UserAgent: laptop, Success: true})
+	}
+	if got := len(LoginHistory(context.Background(), user.ID, 0)); got != maxLoginHistory {
+		t.Fatalf("Expected history to be capped at %d attempts, but got %d", maxLoginHistory, got)
+	}
+
+	if _, err := AddLoginAttempt(context.Background(), -1, LoginAttempt{}); err != ErrUserNotFound {
+		t.Fatalf("Expected not found error for unknown user, but got %v", err)
+	}
+}
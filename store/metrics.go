@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+	"time"
+	"user-api/metrics"
+	"user-api/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var operationDuration = metrics.NewHistogramVec("store_operation_duration_seconds",
+	"Time taken by store operations, including waiting for the store's lock, by operation.",
+	[]float64{0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1}, "operation")
+
+var _ = metrics.NewGaugeFunc("auth_token_blacklist_size",
+	"Blacklisted tokens that haven't expired yet.",
+	func() float64 { return float64(activeBlacklistSize(time.Now())) })
+
+// observe times a store operation and runs it in a span; call the returned function when
+// it completes. The returned context carries the span, for operations doing slow work
+// such as hashing passwords:
+//
+//	ctx, done := observe(ctx, "create_user")
+//	defer done()
+func observe(ctx context.Context, operation string) (context.Context, func()) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "store."+operation, trace.WithAttributes(attribute.String("db.operation.name", operation)))
+	return ctx, func() {
+		span.End()
+		operationDuration.Observe(time.Since(start).Seconds(), operation)
+	}
+}
+
+// activeBlacklistSize returns the number of blacklisted tokens that haven't expired at now.
+func activeBlacklistSize(now time.Time) int {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	count := 0
+	for _, entry := range store.blacklistedTokens {
+		if entry.expiresAt.IsZero() || entry.expiresAt.After(now) {
+			count++
+		}
+	}
+	return count
+}
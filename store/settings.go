@@ -0,0 +1,69 @@
+package store
+
+import "slices"
+
+// Themes are the values allowed for Settings.Theme.
+var Themes = []string{"system", "light", "dark"}
+
+// Settings is a user's preferences document. Its schema is fixed by these types,
+// so every store persists and validates it the same way.
+type Settings struct {
+	Theme         string               `json:"theme"` // One of Themes
+	Notifications NotificationSettings `json:"notifications"`
+}
+
+// NotificationSettings controls which notifications a user receives.
+type NotificationSettings struct {
+	Email          bool `json:"email"`           // Account notices by email
+	SecurityAlerts bool `json:"security_alerts"` // Alerts about new sign-ins and credential changes
+	Newsletter     bool `json:"newsletter"`      // Product news
+}
+
+// DefaultSettings returns the settings of new users.
+func DefaultSettings() Settings {
+	return Settings{
+		Theme: "system",
+		Notifications: NotificationSettings{
+			Email:          true,
+			SecurityAlerts: true,
+			Newsletter:     false,
+		},
+	}
+}
+
+// SettingsPatch describes changes to a user's settings. Nil fields are left unchanged.
+type SettingsPatch struct {
+	Reset bool // Restore the defaults before applying the other fields
+
+	Theme                *string
+	NotifyEmail          *bool
+	NotifySecurityAlerts *bool
+	NotifyNewsletter     *bool
+}
+
+// validate returns an error if the patch would store an invalid value.
+func (p SettingsPatch) validate() error {
+	if p.Theme != nil && !slices.Contains(Themes, *p.Theme) {
+		return validationError("invalid_theme", "unknown theme: "+*p.Theme)
+	}
+	return nil
+}
+
+// Apply applies the patch to s.
+func (p SettingsPatch) Apply(s *Settings) {
+	if p.Reset {
+		*s = DefaultSettings()
+	}
+	if p.Theme != nil {
+		s.Theme = *p.Theme
+	}
+	if p.NotifyEmail != nil {
+		s.Notifications.Email = *p.NotifyEmail
+	}
+	if p.NotifySecurityAlerts != nil {
+		s.Notifications.SecurityAlerts = *p.NotifySecurityAlerts
+	}
+	if p.NotifyNewsletter != nil {
+		s.Notifications.Newsletter = *p.NotifyNewsletter
+	}
+}
@@ -1,18 +1,65 @@
 package store
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"user-api/audit"
+)
 
 // inMemoryStore is an in-memory data structure used to store and manage user data.
 type inMemoryStore struct {
-	userMap           map[string]*User // A map to store user data by username as the key
-	userCount         int              // Count of total users, used to assign unique IDs
-	mutex             *sync.RWMutex    // Mutex to ensure concurrent safe access to the userMap
-	blacklistedTokens map[string]bool  // A map to store blacklisted tokens
+	userMap           map[string]*User               // A map to store user data by username as the key
+	userByID          map[int]*User                  // Secondary index of the users in userMap by ID
+	userByEmail       map[string]*User               // Secondary index of the users in userMap by normalized email
+	userCount         int                            // Count of total users, used to assign unique IDs
+	mutex             *sync.RWMutex                  // Mutex to ensure concurrent safe access to the userMap
+	blacklistedTokens map[string]blacklistEntry      // A map to store blacklisted tokens
+	reservedUsernames map[string]usernameReservation // Canonical usernames released by a rename, reserved for their previous owner
+	auditEvents       []audit.Event                  // Ring of the audit events written through AuditSink
+	auditNext         int                            // Index in auditEvents of the oldest event, overwritten next once it is full
+	loginHistory      map[int][]LoginAttempt         // Recent login attempts by user ID, oldest first
+	knownDevices      map[int]map[string]bool        // Fingerprints of the devices each user logged in from
 }
 
 // store is the in-memory database instance.
 var store = inMemoryStore{
 	userMap:           make(map[string]*User),
+	userByID:          make(map[int]*User),
+	userByEmail:       make(map[string]*User),
 	mutex:             &sync.RWMutex{},
-	blacklistedTokens: make(map[string]bool),
+	blacklistedTokens: make(map[string]blacklistEntry),
+	reservedUsernames: make(map[string]usernameReservation),
+	loginHistory:      make(map[int][]LoginAttempt),
+	knownDevices:      make(map[int]map[string]bool),
+}
+
+// Ping checks that the store can be read and that its indexes agree. It fails if the
+// store's lock can't be acquired before ctx is done, e.g. because an operation hangs.
+func Ping(ctx context.Context) error {
+	result := make(chan error, 1)
+	go func() {
+		store.mutex.RLock()
+		defer store.mutex.RUnlock()
+		if len(store.userByID) != len(store.userMap) || len(store.userByEmail) > len(store.userMap) {
+			result <- errors.New("user indexes are inconsistent")
+			return
+		}
+		result <- nil
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// normalizeEmail returns the key used to index an email address. Addresses are
+// compared case-insensitively; the local part is technically case-sensitive, but
+// no mainstream provider treats it that way and users don't expect it to be.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
@@ -0,0 +1,24 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestPing tests that pinging fails while the store's lock is held for writing.
+func TestPing(t *testing.T) {
+	if err := Ping(context.Background()); err != nil {
+		t.Fatalf("Expected the store to be usable, but got %v", err)
+	}
+
+	store.mutex.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := Ping(ctx)
+	store.mutex.Unlock()
+
+	if err == nil {
+		t.Error("Expected an error while the store is locked")
+	}
+}
@@ -1,24 +1,46 @@
 package store
 
+import (
+	"context"
+	"time"
+)
+
+// blacklistEntry records who a blacklisted token was issued to and when it expires,
+// so entries can be purged with the user or once the token is no longer valid anyway.
+type blacklistEntry struct {
+	userID    int
+	expiresAt time.Time
+}
+
 // AddTokenToBlacklist adds a given JWT token to the blacklist.
 // Once a token is blacklisted, it's considered invalid for further authentications.
 //
 // Parameters:
+// - ctx: The context carrying the span of the caller.
 // - token: The JWT token string to be blacklisted.
-func AddTokenToBlacklist(token string) {
+// - userID: The ID of the user the token was issued to.
+// - expiresAt: The expiry time of the token, after which the entry may be purged; zero if it never expires.
+func AddTokenToBlacklist(ctx context.Context, token string, userID int, expiresAt time.Time) {
+	_, done := observe(ctx, "add_token_to_blacklist")
+	defer done()
+
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
-	store.blacklistedTokens[token] = true
+	store.blacklistedTokens[token] = blacklistEntry{userID: userID, expiresAt: expiresAt}
 }
 
 // IsTokenBlacklisted checks if a given JWT token is in the blacklist.
 //
 // Parameters:
+// - ctx: The context carrying the span of the caller.
 // - token: The JWT token string to be checked.
 //
 // Returns:
 // - true if the token is found in the blacklist; false otherwise.
-func IsTokenBlacklisted(token string) bool {
+func IsTokenBlacklisted(ctx context.Context, token string) bool {
+	_, done := observe(ctx, "is_token_blacklisted")
+	defer done()
+
 	store.mutex.RLock()
 	defer store.mutex.RUnlock()
 	_, exists := store.blacklistedTokens[token]
@@ -1,16 +1,20 @@
 package store
 
-import "testing"
+import (
+	"context"
+	"testing"
+	"time"
+)
 
 // TestAddTokenToBlacklist tests the function to add a token to the blacklist.
 func TestAddTokenToBlacklist(t *testing.T) {
 	token := "testToken"
 
 	// Add the token to the blacklist.
-	AddTokenToBlacklist(token)
+	AddTokenToBlacklist(context.Background(), token, 1, time.Now().Add(time.Hour))
 
 	// Check if the token has been successfully added to the blacklist.
-	if !IsTokenBlacklisted(token) {
+	if !IsTokenBlacklisted(context.Background(), token) {
 		t.Errorf("Token %s was not added to the blacklist", token)
 	}
 }
@@ -20,15 +24,29 @@ func TestIsTokenBlacklisted(t *testing.T) {
 	token := "anotherTestToken"
 
 	// Initially, the token should not be blacklisted.
-	if IsTokenBlacklisted(token) {
+	if IsTokenBlacklisted(context.Background(), token) {
 		t.Errorf("Token %s should not be blacklisted yet", token)
 	}
 
 	// Add the token to the blacklist.
-	AddTokenToBlacklist(token)
+	AddTokenToBlacklist(context.Background(), token, 1, time.Now().Add(time.Hour))
 
 	// Now, the token should be blacklisted.
-	if !IsTokenBlacklisted(token) {
+	if !IsTokenBlacklisted(context.Background(), token) {
 		t.Errorf("Token %s should be blacklisted after adding it", token)
 	}
 }
+
+// TestActiveBlacklistSize tests that only tokens that haven't expired are counted.
+func TestActiveBlacklistSize(t *testing.T) {
+	now := time.Now()
+	before := activeBlacklistSize(now)
+
+	AddTokenToBlacklist(context.Background(), "activeToken", 1, now.Add(time.Hour))
+	AddTokenToBlacklist(context.Background(), "expiredToken", 1, now.Add(-time.Hour))
+	AddTokenToBlacklist(context.Background(), "eternalToken", 1, time.Time{})
+
+	if size := activeBlacklistSize(now); size != before+2 {
+		t.Errorf("Expected %d active blacklisted tokens, but got %d", before+2, size)
+	}
+}
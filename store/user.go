@@ -1,97 +1,655 @@
 package store
 
 import (
-	"errors"
+	"context"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 	"user-api/util"
 )
 
-// User represents a user with ID, username, email, and password fields.
+// User represents a user with ID, username, email, password, role and permission fields.
 // ID, username, and email fields are tagged to be included in JSON serialization, while the password field is excluded.
+// Roles and Permissions control what the user may do; Permissions holds grants in addition to those of the roles.
+// DisplayName, Locale, Timezone and Settings are profile fields the user manages themselves.
+// Account state fields are managed by operators and never read from JSON.
 type User struct {
-	ID       int    `json:"id,omitempty"`
-	Username string `json:"username,omitempty"`
-	Email    string `json:"email,omitempty"`
-	Password string
+	ID          int    `json:"id,omitempty"`
+	Username    string `json:"username,omitempty"`
+	Email       string `json:"email,omitempty"`
+	Password    string
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+
+	Disabled              bool      `json:"-"` // Disabled users can't log in and their tokens are rejected
+	PasswordResetRequired bool      `json:"-"` // The user must choose a new password on their next login
+	TokensRevokedAt       time.Time `json:"-"` // Tokens issued at or before this time are rejected
+	DeletedAt             time.Time `json:"-"` // Set while the user is pending deletion; zero otherwise
+
+	UsernameHistory []UsernameChange `json:"-"` // Previous usernames, oldest first
+
+	DisplayName string        `json:"display_name,omitempty"`
+	Locale      string        `json:"locale,omitempty"`   // BCP 47 language tag, e.g. "en-GB"
+	Timezone    string        `json:"timezone,omitempty"` // IANA time zone, e.g. "Europe/London"
+	Settings    Settings      `json:"settings"`
+	Avatar      []AvatarImage `json:"-"` // Stored variants of the user's avatar, if any
+
+	CreatedAt   time.Time `json:"-"`
+	UpdatedAt   time.Time `json:"-"` // Time of the last change to the user
+	LastLoginAt time.Time `json:"-"` // Zero if the user never logged in
+
+	Version int `json:"-"` // Incremented on every change to the user, starting at 1
+}
+
+// UserFilter narrows the users returned by ListUsers. Zero values match all users.
+type UserFilter struct {
+	Query    string // Case-insensitive substring of the username or email
+	Role     string // Role the user must have
+	Disabled *bool  // Required disabled state
+}
+
+// EffectivePermissions returns the permissions granted to the user by their roles and direct grants.
+func (u User) EffectivePermissions() []string {
+	return util.EffectivePermissions(u.Roles, u.Permissions)
 }
 
 // CreateUser adds a new user to the in-memory store.
-// It first hashes the password using a utility function, then assigns a unique ID to the user
-// and finally adds the user to the userMap.
-// Returns an error if the username already exists or if there's an error hashing the password.
-func CreateUser(u *User) error {
+// It first hashes the password using a utility function, before locking the store, as hashing
+// is slow by design, then assigns a unique ID to the user and finally adds the user to the userMap
+// and its ID and email indexes. Users without roles are given the default user role.
+// Usernames are unique by their canonical form (see util.CanonicalUsername).
+// Returns an error if the username or email already exists, if the username is reserved, if a role or permission is unknown,
+// or if there's an error hashing the password.
+func CreateUser(ctx context.Context, u *User) error {
+	ctx, done := observe(ctx, "create_user")
+	defer done()
+
+	hashedPassword, err := util.HashPassword(ctx, u.Password)
+	if err != nil {
+		return fmt.Errorf("error hashing password: %w", err)
+	}
+
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
-	if _, exists := store.userMap[u.Username]; exists {
-		return errors.New("username already exists")
+	key := util.CanonicalUsername(u.Username)
+	if _, exists := store.userMap[key]; exists {
+		return ErrUsernameTaken
+	}
+	if isUsernameReserved(key, 0) {
+		return ErrUsernameReserved
+	}
+	if _, exists := store.userByEmail[normalizeEmail(u.Email)]; exists && u.Email != "" {
+		return ErrEmailTaken
 	}
 
-	hashedPassword, err := util.HashPassword(u.Password)
-	if err != nil {
-		return fmt.Errorf("error hashing password: %v", err)
+	if len(u.Roles) == 0 {
+		u.Roles = []string{util.RoleUser}
+	}
+	if err := validateAccess(u.Roles, u.Permissions); err != nil {
+		return err
 	}
 	u.Password = hashedPassword
 
+	if u.Settings == (Settings{}) {
+		u.Settings = DefaultSettings()
+	}
+
 	store.userCount++
 	u.ID = store.userCount
-	store.userMap[u.Username] = u
+	u.Version = 1
+	u.CreatedAt = time.Now()
+	u.UpdatedAt = u.CreatedAt
+	store.userMap[key] = u
+	store.userByID[u.ID] = u
+	if u.Email != "" {
+		store.userByEmail[normalizeEmail(u.Email)] = u
+	}
 
 	return nil
 }
 
 // GetUserByUsername retrieves a user from the in-memory store by username.
+// Usernames are matched by their canonical form, so "Admin" finds the user "admin".
 // Returns the user and an error if the user is not found.
-func GetUserByUsername(username string) (User, error) {
+func GetUserByUsername(ctx context.Context, username string) (User, error) {
+	_, done := observe(ctx, "get_user_by_username")
+	defer done()
+
 	store.mutex.RLock()
 	defer store.mutex.RUnlock()
 
-	user, exists := store.userMap[username]
+	user, exists := store.userMap[util.CanonicalUsername(username)]
 	if !exists {
-		return User{}, errors.New("user not found")
+		return User{}, ErrUserNotFound
 	}
 	return *user, nil
 }
 
-// UpdateUser updates the details of an existing user in the in-memory store.
-// It updates only the provided fields: email and password. For updating the password,
-// it first hashes the new password and then replaces the old one.
-// Returns an error if the user is not found or if there's an error hashing the password.
-func UpdateUser(u *User) error {
+// UserPatch describes changes to an existing user. Nil fields are left unchanged.
+type UserPatch struct {
+	Email       *string
+	Password    *string // Plain text; hashed before it is stored
+	DisplayName *string
+	Locale      *string
+	Timezone    *string
+	Settings    *SettingsPatch
+
+	Version int // If non-zero, the patch is only applied if the user is still at this version
+}
+
+// UpdateUser applies patch to the user identified by id in the in-memory store.
+// Setting a password also clears a pending forced password reset. Locale and time zone
+// are stored as given; callers validate them.
+// Returns an error if the user is not found or was changed since patch.Version, the email
+// is empty or belongs to another user, or the password can't be hashed.
+// Nothing is changed if an error is returned.
+func UpdateUser(ctx context.Context, id int, patch UserPatch) error {
+	ctx, done := observe(ctx, "update_user")
+	defer done()
+
+	// Hash before locking the store, so the slow hash doesn't block other store calls
+	var hashedPassword string
+	if patch.Password != nil {
+		var err error
+		hashedPassword, err = util.HashPassword(ctx, *patch.Password)
+		if err != nil {
+			return fmt.Errorf("error hashing password: %w", err)
+		}
+	}
+
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
-	storeUser, exists := store.userMap[u.Username]
+	storeUser, exists := store.userByID[id]
 	if !exists {
-		return errors.New("user not found")
+		return ErrUserNotFound
+	}
+	if patch.Version != 0 && patch.Version != storeUser.Version {
+		return ErrVersionMismatch
 	}
 
-	if u.Email != "" {
-		storeUser.Email = u.Email
+	var emailKey string
+	if patch.Email != nil {
+		if *patch.Email == "" {
+			return validationError("email_required", "email is required")
+		}
+		emailKey = normalizeEmail(*patch.Email)
+		if owner, exists := store.userByEmail[emailKey]; exists && owner != storeUser {
+			return ErrEmailTaken
+		}
 	}
 
-	if u.Password != "" {
-		hashedPassword, err := util.HashPassword(u.Password)
-		if err != nil {
-			return errors.New("failed to hash password")
+	if patch.Settings != nil {
+		if err := patch.Settings.validate(); err != nil {
+			return err
 		}
+	}
+
+	if patch.Email != nil {
+		delete(store.userByEmail, normalizeEmail(storeUser.Email))
+		storeUser.Email = *patch.Email
+		store.userByEmail[emailKey] = storeUser
+	}
+	if patch.Password != nil {
 		storeUser.Password = hashedPassword
+		storeUser.PasswordResetRequired = false
+	}
+	if patch.DisplayName != nil {
+		storeUser.DisplayName = *patch.DisplayName
+	}
+	if patch.Locale != nil {
+		storeUser.Locale = *patch.Locale
+	}
+	if patch.Timezone != nil {
+		storeUser.Timezone = *patch.Timezone
 	}
+	if patch.Settings != nil {
+		patch.Settings.Apply(&storeUser.Settings)
+	}
+	touch(storeUser)
 
 	return nil
 }
 
-// DeleteUserByUsername removes a user from the in-memory store by username.
+// AvatarImage is a stored variant of a user's avatar.
+type AvatarImage struct {
+	Name string // Name of the variant, e.g. "small"
+	Side int    // Width and height in pixels
+	Key  string // Key of the image in the blob store
+}
+
+// SetUserAvatar replaces the avatar of an existing user, or removes it if images is empty.
+// It returns the images of the previous avatar, so the caller can delete them from the blob store.
+// Returns an error if the user is not found.
+func SetUserAvatar(ctx context.Context, id int, images []AvatarImage) ([]AvatarImage, error) {
+	_, done := observe(ctx, "set_user_avatar")
+	defer done()
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	storeUser, exists := store.userByID[id]
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+	previous := storeUser.Avatar
+	storeUser.Avatar = append([]AvatarImage(nil), images...)
+	touch(storeUser)
+
+	return previous, nil
+}
+
+// RecordLogin sets the time of the last login of an existing user. A login is not a change
+// to the user, so their version is kept: otherwise logging in on one device would make
+// the ETags held by the others stale. ETags therefore don't cover the last login time.
 // Returns an error if the user is not found.
-func DeleteUserByUsername(username string) error {
+func RecordLogin(ctx context.Context, id int, at time.Time) error {
+	_, done := observe(ctx, "record_login")
+	defer done()
+
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
-	_, exists := store.userMap[username]
+	storeUser, exists := store.userByID[id]
 	if !exists {
-		return errors.New("user not found")
+		return ErrUserNotFound
 	}
-	delete(store.userMap, username)
+	storeUser.LastLoginAt = at
 
 	return nil
 }
+
+// touch records a change to a user, incrementing its version.
+// The caller must hold the store's write lock.
+func touch(u *User) {
+	u.Version++
+	u.UpdatedAt = time.Now()
+}
+
+// DeleteUserByUsername marks a user, identified by username, as pending deletion and
+// revokes their tokens. Usernames are matched by their canonical form.
+// The user is erased by PurgeDeletedUsers once the deletion grace period has passed,
+// unless they are restored before.
+// Returns an error if the user is not found, already pending deletion or the last active administrator.
+func DeleteUserByUsername(ctx context.Context, username string) error {
+	_, done := observe(ctx, "delete_user_by_username")
+	defer done()
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	storeUser, exists := store.userMap[util.CanonicalUsername(username)]
+	if !exists || !storeUser.DeletedAt.IsZero() {
+		return ErrUserNotFound
+	}
+	if isLastAdmin(storeUser) {
+		return ErrLastAdmin
+	}
+	markDeleted(storeUser)
+
+	return nil
+}
+
+// DeleteUserByID marks a user, identified by ID, as pending deletion and revokes their tokens.
+// If version is non-zero, the user is only deleted if it is still at that version.
+// The user is erased by PurgeDeletedUsers once the deletion grace period has passed,
+// unless they are restored before.
+// Returns an error if the user is not found, already pending deletion, was changed since version
+// or is the last active administrator.
+func DeleteUserByID(ctx context.Context, id, version int) error {
+	_, done := observe(ctx, "delete_user_by_id")
+	defer done()
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	storeUser, exists := store.userByID[id]
+	if !exists || !storeUser.DeletedAt.IsZero() {
+		return ErrUserNotFound
+	}
+	if version != 0 && version != storeUser.Version {
+		return ErrVersionMismatch
+	}
+	if isLastAdmin(storeUser) {
+		return ErrLastAdmin
+	}
+	markDeleted(storeUser)
+
+	return nil
+}
+
+// markDeleted marks a user as pending deletion and revokes their tokens.
+// The caller must hold the store's write lock.
+func markDeleted(u *User) {
+	u.DeletedAt = time.Now()
+	revokeTokens(u)
+	touch(u)
+}
+
+// revokeTokens revokes every token issued to u so far. Tokens issued within the second
+// after the previous revocation are dated to the next second by util.GenerateToken, so
+// the revocation time is moved to at least that second to cover them too.
+// The caller must hold the store's write lock.
+func revokeTokens(u *User) {
+	now := time.Now()
+	if next := u.TokensRevokedAt.Truncate(time.Second).Add(time.Second); !u.TokensRevokedAt.IsZero() && now.Before(next) {
+		now = next
+	}
+	u.TokensRevokedAt = now
+}
+
+// removeUser removes a user from the userMap and all of its indexes.
+// The caller must hold the store's write lock.
+func removeUser(u *User) {
+	delete(store.userMap, util.CanonicalUsername(u.Username))
+	delete(store.userByID, u.ID)
+	if u.Email != "" {
+		delete(store.userByEmail, normalizeEmail(u.Email))
+	}
+}
+
+// GetUserByID retrieves a user from the in-memory store by ID.
+// Returns the user and an error if the user is not found.
+func GetUserByID(ctx context.Context, id int) (User, error) {
+	_, done := observe(ctx, "get_user_by_id")
+	defer done()
+
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	user, exists := store.userByID[id]
+	if !exists {
+		return User{}, ErrUserNotFound
+	}
+	return *user, nil
+}
+
+// GetUserByEmail retrieves a user from the in-memory store by email.
+// Emails are matched case-insensitively.
+// Returns the user and an error if the user is not found.
+func GetUserByEmail(ctx context.Context, email string) (User, error) {
+	_, done := observe(ctx, "get_user_by_email")
+	defer done()
+
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	user, exists := store.userByEmail[normalizeEmail(email)]
+	if !exists || email == "" {
+		return User{}, ErrUserNotFound
+	}
+	return *user, nil
+}
+
+// ListUsers returns a page of users matching the filter, ordered by ID, together with
+// the total number of matching users. A non-positive limit returns all remaining users.
+func ListUsers(ctx context.Context, filter UserFilter, offset, limit int) ([]User, int) {
+	_, done := observe(ctx, "list_users")
+	defer done()
+
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	query := strings.ToLower(filter.Query)
+	matches := make([]User, 0)
+	for _, user := range store.userMap {
+		if query != "" &&
+			!strings.Contains(strings.ToLower(user.Username), query) &&
+			!strings.Contains(strings.ToLower(user.Email), query) {
+			continue
+		}
+		if filter.Role != "" && !hasRole(user.Roles, filter.Role) {
+			continue
+		}
+		if filter.Disabled != nil && user.Disabled != *filter.Disabled {
+			continue
+		}
+		matches = append(matches, *user)
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+
+	total := len(matches)
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > total {
+		offset = total
+	}
+	end := total
+	if limit > 0 && offset+limit < total {
+		end = offset + limit
+	}
+	return matches[offset:end], total
+}
+
+// UpdatePasswordHash replaces the stored password hash of an existing user, provided it
+// is still oldHash, the hash the password was verified against. Otherwise the password was
+// changed or reset in the meantime, and rehashing the previous password would undo that.
+// Unlike UpdateUser, the given value is stored as-is; it must already be an encoded hash.
+// This is used to upgrade hashes produced with outdated algorithms or parameters.
+// Returns an error if the user is not found or their password hash is no longer oldHash.
+func UpdatePasswordHash(ctx context.Context, id int, oldHash, hash string) error {
+	_, done := observe(ctx, "update_password_hash")
+	defer done()
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	storeUser, exists := store.userByID[id]
+	if !exists {
+		return ErrUserNotFound
+	}
+	if storeUser.Password != oldHash {
+		return ErrPasswordChanged
+	}
+	storeUser.Password = hash
+
+	return nil
+}
+
+// SetUserRoles replaces the roles of an existing user and revokes their tokens,
+// which hold the previous roles.
+// Returns an error if the user is not found, if a role is unknown or if the admin role would be
+// removed from the last active administrator.
+func SetUserRoles(ctx context.Context, id int, roles []string) error {
+	_, done := observe(ctx, "set_user_roles")
+	defer done()
+
+	if len(roles) == 0 {
+		return ErrRoleRequired
+	}
+	if err := validateAccess(roles, nil); err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	storeUser, exists := store.userByID[id]
+	if !exists {
+		return ErrUserNotFound
+	}
+	if !hasRole(roles, util.RoleAdmin) && isLastAdmin(storeUser) {
+		return ErrLastAdmin
+	}
+	storeUser.Roles = append([]string(nil), roles...)
+	revokeTokens(storeUser)
+	touch(storeUser)
+
+	return nil
+}
+
+// SetUserPermissions replaces the permissions granted directly to an existing user,
+// in addition to those granted by their roles, and revokes their tokens, which hold
+// the previous permissions.
+// Returns an error if the user is not found or if a permission is unknown.
+func SetUserPermissions(ctx context.Context, id int, permissions []string) error {
+	_, done := observe(ctx, "set_user_permissions")
+	defer done()
+
+	if err := validateAccess(nil, permissions); err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	storeUser, exists := store.userByID[id]
+	if !exists {
+		return ErrUserNotFound
+	}
+	storeUser.Permissions = append([]string(nil), permissions...)
+	revokeTokens(storeUser)
+	touch(storeUser)
+
+	return nil
+}
+
+// validateAccess returns an error if any of the given roles or permissions is unknown.
+func validateAccess(roles, permissions []string) error {
+	for _, role := range roles {
+		if !util.IsValidRole(role) {
+			return validationError("unknown_role", "unknown role: "+role)
+		}
+	}
+	for _, permission := range permissions {
+		if !util.IsValidPermission(permission) {
+			return validationError("unknown_permission", "unknown permission: "+permission)
+		}
+	}
+	return nil
+}
+
+// SetUserDisabled disables or re-enables an existing user. Disabling a user also
+// revokes all of their tokens.
+// Returns an error if the user is not found, or is disabled while the last active administrator.
+func SetUserDisabled(ctx context.Context, id int, disabled bool) error {
+	_, done := observe(ctx, "set_user_disabled")
+	defer done()
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	storeUser, exists := store.userByID[id]
+	if !exists {
+		return ErrUserNotFound
+	}
+	if disabled && isLastAdmin(storeUser) {
+		return ErrLastAdmin
+	}
+	storeUser.Disabled = disabled
+	if disabled {
+		revokeTokens(storeUser)
+	}
+	touch(storeUser)
+
+	return nil
+}
+
+// ForcePasswordReset replaces the password of an existing user with a temporary one,
+// requires the user to choose a new password on their next login and revokes all of their tokens.
+// Returns an error if the user is not found or if there's an error hashing the password.
+func ForcePasswordReset(ctx context.Context, id int, temporaryPassword string) error {
+	ctx, done := observe(ctx, "force_password_reset")
+	defer done()
+
+	hashedPassword, err := util.HashPassword(ctx, temporaryPassword)
+	if err != nil {
+		return fmt.Errorf("error hashing password: %w", err)
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	storeUser, exists := store.userByID[id]
+	if !exists {
+		return ErrUserNotFound
+	}
+	storeUser.Password = hashedPassword
+	storeUser.PasswordResetRequired = true
+	revokeTokens(storeUser)
+	touch(storeUser)
+
+	return nil
+}
+
+// RevokeUserTokens invalidates every token issued to an existing user so far.
+// Returns an error if the user is not found.
+func RevokeUserTokens(ctx context.Context, id int) error {
+	_, done := observe(ctx, "revoke_user_tokens")
+	defer done()
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	storeUser, exists := store.userByID[id]
+	if !exists {
+		return ErrUserNotFound
+	}
+	revokeTokens(storeUser)
+
+	return nil
+}
+
+// IsTokenRevoked checks whether a token issued to a user at issuedAt is no longer valid,
+// because the user no longer exists, is disabled, or had their tokens revoked afterwards.
+// Token issue times have a precision of one second, so tokens issued within the same
+// second as a revocation are treated as revoked; util.GenerateToken dates tokens issued
+// after the revocation in that second to the next one.
+//
+// Parameters:
+// - ctx: the context carrying the span of the caller.
+// - id: the ID of the user the token was issued to.
+// - issuedAt: the time the token was issued.
+//
+// Returns:
+// - true if the token must be rejected; false otherwise.
+func IsTokenRevoked(ctx context.Context, id int, issuedAt time.Time) bool {
+	_, done := observe(ctx, "is_token_revoked")
+	defer done()
+
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	user, exists := store.userByID[id]
+	if !exists || user.Disabled || !user.DeletedAt.IsZero() {
+		return true
+	}
+	if user.TokensRevokedAt.IsZero() {
+		return false
+	}
+	return !issuedAt.After(user.TokensRevokedAt.Truncate(time.Second))
+}
+
+// isLastAdmin reports whether u is the only active administrator, i.e. the only user
+// with the admin role who is neither disabled nor pending deletion. Such a user can't be
+// disabled, deleted or lose the admin role, as nobody could administer the users anymore.
+// The caller must hold the store's lock.
+func isLastAdmin(u *User) bool {
+	if !isActiveAdmin(u) {
+		return false
+	}
+	for _, other := range store.userMap {
+		if other != u && isActiveAdmin(other) {
+			return false
+		}
+	}
+	return true
+}
+
+// isActiveAdmin reports whether u has the admin role and is neither disabled nor pending deletion.
+func isActiveAdmin(u *User) bool {
+	return hasRole(u.Roles, util.RoleAdmin) && !u.Disabled && u.DeletedAt.IsZero()
+}
+
+// hasRole reports whether roles contains role.
+func hasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
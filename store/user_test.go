@@ -1,7 +1,11 @@
 package store
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
+	"user-api/config"
 	"user-api/util"
 )
 
@@ -19,13 +23,13 @@ func TestAddAndGetUser(t *testing.T) {
 
 	for _, tt := range tests {
 		// Create the user
-		err := CreateUser(&tt.user)
+		err := CreateUser(context.Background(), &tt.user)
 		if err != nil {
 			t.Fatalf("Failed to create new user: %v", err)
 		}
 
 		// Retrieve and validate the created user
-		retrievedUser, err := GetUserByUsername(tt.user.Username)
+		retrievedUser, err := GetUserByUsername(context.Background(), tt.user.Username)
 		if err != nil {
 			t.Fatalf("Failed to retrieve user: %v", err)
 		}
@@ -38,7 +42,7 @@ func TestAddAndGetUser(t *testing.T) {
 // TestNonExistentUser tests the behavior of trying to retrieve a user that doesn't exist.
 // The expected behavior is that an error should be returned.
 func TestNonExistentUser(t *testing.T) {
-	_, err := GetUserByUsername("Nobody")
+	_, err := GetUserByUsername(context.Background(), "Nobody")
 	if err == nil {
 		t.Fatalf("Expected error for non-existent user, but got none")
 	}
@@ -54,37 +58,53 @@ func TestUpdateUser(t *testing.T) {
 		Email:    "UpdateTest@email.com",
 		Password: "initialPassword",
 	}
-	err := CreateUser(&user)
+	err := CreateUser(context.Background(), &user)
 	if err != nil {
 		t.Fatalf("Failed to create user for update: %v", err)
 	}
 
 	// Update the user's details
-	updatedDetails := User{
-		Username: user.Username, // Using the same username since it's our retrieval key
-		Email:    "UpdatedTest@email.com",
-		Password: "updatedPassword",
-	}
-	err = UpdateUser(&updatedDetails)
+	email, password := "UpdatedTest@email.com", "updatedPassword"
+	err = UpdateUser(context.Background(), user.ID, UserPatch{Email: &email, Password: &password})
 	if err != nil {
 		t.Fatalf("Failed to update user: %v", err)
 	}
 
 	// Retrieve and validate the updated user details
-	retrievedUser, err := GetUserByUsername(user.Username)
+	retrievedUser, err := GetUserByUsername(context.Background(), user.Username)
 	if err != nil {
 		t.Fatalf("Failed to retrieve updated user: %v", err)
 	}
-	if retrievedUser.Email != updatedDetails.Email {
-		t.Fatalf("Expected updated email %s, got %s", updatedDetails.Email, retrievedUser.Email)
+	if retrievedUser.Email != email {
+		t.Fatalf("Expected updated email %s, got %s", email, retrievedUser.Email)
 	}
-	if !util.CheckHashedPassword(updatedDetails.Password, retrievedUser.Password) {
+	if !util.CheckHashedPassword(context.Background(), password, retrievedUser.Password) {
 		t.Fatalf("Password was not updated correctly")
 	}
+
+	// Fields left out of the patch are unchanged
+	newEmail := "UpdatedAgain@email.com"
+	if err := UpdateUser(context.Background(), user.ID, UserPatch{Email: &newEmail}); err != nil {
+		t.Fatalf("Failed to update user: %v", err)
+	}
+	retrievedUser, _ = GetUserByID(context.Background(), user.ID)
+	if retrievedUser.Email != newEmail || !util.CheckHashedPassword(context.Background(), password, retrievedUser.Password) {
+		t.Fatal("Expected only the email to change")
+	}
+
+	// A rejected patch changes nothing
+	empty := ""
+	if err := UpdateUser(context.Background(), user.ID, UserPatch{Email: &empty, Password: &password}); !errors.Is(err, ErrValidation) {
+		t.Fatalf("Expected validation error for an empty email, but got %v", err)
+	}
+	if err := UpdateUser(context.Background(), user.ID+1000, UserPatch{}); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("Expected user not found error, but got %v", err)
+	}
 }
 
 // TestDeleteUser tests the user deletion functionality.
-// It begins by creating a user, deletes it, and then ensures that the user no longer exists in the store.
+// It begins by creating a user, deletes it, ensures that the user is pending deletion with
+// their tokens revoked, and then ensures that the user no longer exists once purged.
 func TestDeleteUser(t *testing.T) {
 	// Create a user for testing the delete functionality
 	user := User{
@@ -92,20 +112,548 @@ func TestDeleteUser(t *testing.T) {
 		Email:    "DeleteTest@email.com",
 		Password: "deleteMePassword",
 	}
-	err := CreateUser(&user)
+	err := CreateUser(context.Background(), &user)
 	if err != nil {
 		t.Fatalf("Failed to create user for deletion: %v", err)
 	}
 
 	// Delete the created user
-	err = DeleteUserByUsername(user.Username)
+	err = DeleteUserByUsername(context.Background(), user.Username)
 	if err != nil {
 		t.Fatalf("Failed to delete user: %v", err)
 	}
 
-	// Ensure that the deleted user can't be retrieved
-	_, err = GetUserByUsername(user.Username)
+	// The user is kept, pending deletion, with their tokens revoked
+	deleted, err := GetUserByUsername(context.Background(), user.Username)
+	if err != nil {
+		t.Fatalf("Failed to retrieve user pending deletion: %v", err)
+	}
+	if deleted.DeletedAt.IsZero() || !deleted.PurgeAt().After(deleted.DeletedAt) {
+		t.Fatalf("Expected user to be pending deletion, but got deleted at %v, purged at %v", deleted.DeletedAt, deleted.PurgeAt())
+	}
+	if !IsTokenRevoked(context.Background(), user.ID, time.Now().Add(time.Minute)) {
+		t.Fatal("Expected tokens of user pending deletion to be revoked")
+	}
+
+	// Deleting twice fails
+	if err := DeleteUserByUsername(context.Background(), user.Username); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("Expected not found error deleting user twice, but got %v", err)
+	}
+
+	// The user is kept until the grace period ends
+	PurgeDeletedUsers(context.Background(), deleted.PurgeAt().Add(-time.Second))
+	if _, err := GetUserByUsername(context.Background(), user.Username); err != nil {
+		t.Fatalf("Expected user to be kept during the grace period, but got %v", err)
+	}
+
+	// Ensure that the purged user can't be retrieved
+	PurgeDeletedUsers(context.Background(), deleted.PurgeAt())
+	_, err = GetUserByUsername(context.Background(), user.Username)
 	if err == nil {
 		t.Fatal("Expected error retrieving deleted user, but got none")
 	}
 }
+
+// TestUpdatePasswordHash tests that an encoded hash is stored as-is for an existing user.
+func TestUpdatePasswordHash(t *testing.T) {
+	user := User{
+		Username: "RehashTestUser",
+		Email:    "RehashTest@email.com",
+		Password: "rehashPassword",
+	}
+	err := CreateUser(context.Background(), &user)
+	if err != nil {
+		t.Fatalf("Failed to create user for rehash: %v", err)
+	}
+
+	hash, err := util.BcryptHasher{Cost: 4}.Hash("rehashPassword")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+
+	err = UpdatePasswordHash(context.Background(), user.ID, user.Password, hash)
+	if err != nil {
+		t.Fatalf("Failed to update password hash: %v", err)
+	}
+
+	retrievedUser, err := GetUserByUsername(context.Background(), user.Username)
+	if err != nil {
+		t.Fatalf("Failed to retrieve user: %v", err)
+	}
+	if retrievedUser.Password != hash {
+		t.Fatalf("Expected stored hash %s, got %s", hash, retrievedUser.Password)
+	}
+
+	// Updating a non-existent user must fail
+	if err := UpdatePasswordHash(context.Background(), -1, "", hash); err == nil {
+		t.Fatal("Expected error updating hash of non-existent user, but got none")
+	}
+}
+
+// TestUpdatePasswordHashAfterChange tests that a rehash on login doesn't undo a password
+// change that lands between checking the password and storing its new hash.
+func TestUpdatePasswordHashAfterChange(t *testing.T) {
+	user := User{Username: "RehashRaceUser", Email: "RehashRace@email.com", Password: "oldPassword"}
+	if err := CreateUser(context.Background(), &user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// The login has checked the old password against this hash...
+	checked, _ := GetUserByUsername(context.Background(), user.Username)
+	rehashed, err := util.BcryptHasher{Cost: 4}.Hash("oldPassword")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+
+	// ...when the password is changed
+	newPassword := "newPassword"
+	if err := UpdateUser(context.Background(), user.ID, UserPatch{Password: &newPassword}); err != nil {
+		t.Fatalf("Failed to change password: %v", err)
+	}
+
+	err = UpdatePasswordHash(context.Background(), user.ID, checked.Password, rehashed)
+	if !errors.Is(err, ErrPasswordChanged) {
+		t.Fatalf("Expected password changed error, but got %v", err)
+	}
+	stored, _ := GetUserByUsername(context.Background(), user.Username)
+	if !util.CheckHashedPassword(context.Background(), "newPassword", stored.Password) {
+		t.Fatal("Expected the new password to be kept")
+	}
+}
+
+// TestUserRoles tests default role assignment and updating roles and permissions.
+func TestUserRoles(t *testing.T) {
+	user := User{
+		Username: "RoleTestUser",
+		Email:    "RoleTest@email.com",
+		Password: "rolePassword",
+	}
+	err := CreateUser(context.Background(), &user)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// New users get the default user role
+	retrievedUser, _ := GetUserByUsername(context.Background(), user.Username)
+	if len(retrievedUser.Roles) != 1 || retrievedUser.Roles[0] != util.RoleUser {
+		t.Fatalf("Expected default role %s, got %v", util.RoleUser, retrievedUser.Roles)
+	}
+
+	// Update roles and direct permissions
+	if err := SetUserRoles(context.Background(), user.ID, []string{util.RoleSupport}); err != nil {
+		t.Fatalf("Failed to set roles: %v", err)
+	}
+	if err := SetUserPermissions(context.Background(), user.ID, []string{util.PermTokensRevoke}); err != nil {
+		t.Fatalf("Failed to set permissions: %v", err)
+	}
+
+	retrievedUser, _ = GetUserByUsername(context.Background(), user.Username)
+	perms := retrievedUser.EffectivePermissions()
+	for _, expected := range []string{util.PermUsersRead, util.PermTokensRevoke} {
+		found := false
+		for _, p := range perms {
+			found = found || p == expected
+		}
+		if !found {
+			t.Errorf("Expected permission %s in %v", expected, perms)
+		}
+	}
+
+	// Unknown roles and permissions are rejected
+	if err := SetUserRoles(context.Background(), user.ID, []string{"superuser"}); err == nil {
+		t.Error("Expected error setting unknown role, but got none")
+	}
+	if err := SetUserPermissions(context.Background(), user.ID, []string{"everything"}); err == nil {
+		t.Error("Expected error setting unknown permission, but got none")
+	}
+	if err := CreateUser(context.Background(), &User{Username: "BadRoleUser", Password: "pw", Roles: []string{"superuser"}}); err == nil {
+		t.Error("Expected error creating user with unknown role, but got none")
+	}
+}
+
+// TestLastAdmin tests that the last active administrator can't be disabled, deleted or
+// lose the admin role, while any other administrator can.
+func TestLastAdmin(t *testing.T) {
+	ctx := context.Background()
+	first := User{Username: "FirstAdmin", Password: "adminPassword", Roles: []string{util.RoleAdmin}}
+	second := User{Username: "SecondAdmin", Password: "adminPassword", Roles: []string{util.RoleAdmin}}
+	for _, user := range []*User{&first, &second} {
+		if err := CreateUser(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+
+	if err := SetUserDisabled(ctx, first.ID, true); err != nil {
+		t.Fatalf("Expected an administrator to be disabled while another one is active, but got %v", err)
+	}
+	if err := SetUserDisabled(ctx, second.ID, true); err != ErrLastAdmin {
+		t.Errorf("Expected ErrLastAdmin disabling the last administrator, but got %v", err)
+	}
+	if err := DeleteUserByID(ctx, second.ID, 0); err != ErrLastAdmin {
+		t.Errorf("Expected ErrLastAdmin deleting the last administrator, but got %v", err)
+	}
+	if err := DeleteUserByUsername(ctx, second.Username); err != ErrLastAdmin {
+		t.Errorf("Expected ErrLastAdmin deleting the last administrator, but got %v", err)
+	}
+	if err := SetUserRoles(ctx, second.ID, []string{util.RoleSupport}); err != ErrLastAdmin {
+		t.Errorf("Expected ErrLastAdmin removing the admin role of the last administrator, but got %v", err)
+	}
+
+	// Once the first administrator is enabled again, the second one can go
+	if err := SetUserDisabled(ctx, first.ID, false); err != nil {
+		t.Fatalf("Failed to enable user: %v", err)
+	}
+	if err := SetUserRoles(ctx, second.ID, []string{util.RoleSupport}); err != nil {
+		t.Errorf("Expected the admin role to be removed, but got %v", err)
+	}
+	if err := DeleteUserByID(ctx, first.ID, 0); err != ErrLastAdmin {
+		t.Errorf("Expected ErrLastAdmin deleting the last administrator, but got %v", err)
+	}
+}
+
+// TestGetUserByID tests retrieving a created user by its assigned ID.
+func TestGetUserByID(t *testing.T) {
+	user := User{Username: "IDTestUser", Email: "IDTest@email.com", Password: "idPassword"}
+	if err := CreateUser(context.Background(), &user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	retrievedUser, err := GetUserByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("Failed to retrieve user by ID: %v", err)
+	}
+	if retrievedUser.Username != user.Username {
+		t.Fatalf("Expected %s, but got %s", user.Username, retrievedUser.Username)
+	}
+
+	if _, err := GetUserByID(context.Background(), -1); err == nil {
+		t.Fatal("Expected error for non-existent user ID, but got none")
+	}
+}
+
+// TestListUsers tests filtering and paginating users.
+func TestListUsers(t *testing.T) {
+	for _, name := range []string{"ListTestUserA", "ListTestUserB", "ListTestUserC"} {
+		user := User{Username: name, Email: name + "@list.example", Password: "listPassword"}
+		if err := CreateUser(context.Background(), &user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+	listed, _ := GetUserByUsername(context.Background(), "ListTestUserB")
+	if err := SetUserDisabled(context.Background(), listed.ID, true); err != nil {
+		t.Fatalf("Failed to disable user: %v", err)
+	}
+
+	users, total := ListUsers(context.Background(), UserFilter{Query: "listtestuser"}, 0, 2)
+	if total != 3 || len(users) != 2 {
+		t.Fatalf("Expected 2 of 3 users, got %d of %d", len(users), total)
+	}
+	if users[0].ID >= users[1].ID {
+		t.Fatalf("Expected users ordered by ID, got %d before %d", users[0].ID, users[1].ID)
+	}
+
+	users, total = ListUsers(context.Background(), UserFilter{Query: "@list.example"}, 2, 2)
+	if total != 3 || len(users) != 1 || users[0].Username != "ListTestUserC" {
+		t.Fatalf("Expected last page with ListTestUserC, got %d users of %d", len(users), total)
+	}
+
+	disabled := true
+	users, total = ListUsers(context.Background(), UserFilter{Query: "ListTestUser", Disabled: &disabled}, 0, 0)
+	if total != 1 || users[0].Username != "ListTestUserB" {
+		t.Fatalf("Expected only the disabled user, got %d users", total)
+	}
+}
+
+// TestTokenRevocation tests that revoking, disabling and resetting a user invalidates earlier tokens.
+func TestTokenRevocation(t *testing.T) {
+	user := User{Username: "RevokeTestUser", Email: "RevokeTest@email.com", Password: "revokePassword"}
+	if err := CreateUser(context.Background(), &user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	issuedAt := time.Now().Add(-time.Minute)
+	if IsTokenRevoked(context.Background(), user.ID, issuedAt) {
+		t.Fatal("Token should be valid before any revocation")
+	}
+
+	if err := RevokeUserTokens(context.Background(), user.ID); err != nil {
+		t.Fatalf("Failed to revoke tokens: %v", err)
+	}
+	if !IsTokenRevoked(context.Background(), user.ID, issuedAt) {
+		t.Fatal("Token issued before revocation should be revoked")
+	}
+	if IsTokenRevoked(context.Background(), user.ID, time.Now().Add(time.Minute)) {
+		t.Fatal("Token issued after revocation should be valid")
+	}
+
+	// Disabled users have all tokens rejected until re-enabled
+	if err := SetUserDisabled(context.Background(), user.ID, true); err != nil {
+		t.Fatalf("Failed to disable user: %v", err)
+	}
+	if !IsTokenRevoked(context.Background(), user.ID, time.Now().Add(time.Minute)) {
+		t.Fatal("Tokens of a disabled user should be revoked")
+	}
+	if err := SetUserDisabled(context.Background(), user.ID, false); err != nil {
+		t.Fatalf("Failed to enable user: %v", err)
+	}
+
+	// A forced reset replaces the password and flags the user
+	if err := ForcePasswordReset(context.Background(), user.ID, "temporaryPassword"); err != nil {
+		t.Fatalf("Failed to force password reset: %v", err)
+	}
+	retrievedUser, _ := GetUserByUsername(context.Background(), user.Username)
+	if !retrievedUser.PasswordResetRequired || !util.CheckHashedPassword(context.Background(), "temporaryPassword", retrievedUser.Password) {
+		t.Fatal("Expected temporary password and pending reset")
+	}
+	newPassword := "newPassword"
+	if err := UpdateUser(context.Background(), user.ID, UserPatch{Password: &newPassword}); err != nil {
+		t.Fatalf("Failed to update password: %v", err)
+	}
+	retrievedUser, _ = GetUserByUsername(context.Background(), user.Username)
+	if retrievedUser.PasswordResetRequired {
+		t.Fatal("Changing the password should complete the pending reset")
+	}
+
+	// Tokens of unknown users are always rejected
+	if !IsTokenRevoked(context.Background(), -1, time.Now()) {
+		t.Fatal("Tokens of non-existent users should be revoked")
+	}
+}
+
+// TestTokenIssuedAfterRevocation tests that a token issued right after a revocation, in
+// the same second, is accepted, while one issued right before it is rejected.
+func TestTokenIssuedAfterRevocation(t *testing.T) {
+	defer func(c config.Config) { config.C = c }(config.C)
+	config.C.JWTSecret = "test-secret"
+
+	user := User{Username: "ReloginTestUser", Password: "reloginPassword"}
+	if err := CreateUser(context.Background(), &user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	issue := func() time.Time {
+		retrievedUser, _ := GetUserByID(context.Background(), user.ID)
+		token, err := util.GenerateToken(user.ID, user.Username, nil, nil, retrievedUser.TokensRevokedAt)
+		if err != nil {
+			t.Fatalf("Failed to generate token: %v", err)
+		}
+		claims, err := util.ValidateToken(token)
+		if err != nil {
+			t.Fatalf("Failed to validate token: %v", err)
+		}
+		return claims.IssuedAt.Time
+	}
+
+	for i := 0; i < 3; i++ {
+		before := issue()
+		if err := RevokeUserTokens(context.Background(), user.ID); err != nil {
+			t.Fatalf("Failed to revoke tokens: %v", err)
+		}
+		after := issue()
+
+		if !IsTokenRevoked(context.Background(), user.ID, before) {
+			t.Error("Expected the token issued before the revocation to be revoked")
+		}
+		if IsTokenRevoked(context.Background(), user.ID, after) {
+			t.Error("Expected the token issued right after the revocation to be accepted")
+		}
+	}
+}
+
+// TestGetUserByEmail tests case-insensitive email lookups and that the index follows email changes.
+func TestGetUserByEmail(t *testing.T) {
+	user := User{Username: "EmailTestUser", Email: "EmailTest@email.com", Password: "emailPassword"}
+	if err := CreateUser(context.Background(), &user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	retrievedUser, err := GetUserByEmail(context.Background(), "emailtest@EMAIL.com")
+	if err != nil {
+		t.Fatalf("Failed to retrieve user by email: %v", err)
+	}
+	if retrievedUser.ID != user.ID {
+		t.Fatalf("Expected user %d, but got %d", user.ID, retrievedUser.ID)
+	}
+
+	// After an email change only the new address resolves
+	changedEmail := "EmailTestChanged@email.com"
+	if err := UpdateUser(context.Background(), user.ID, UserPatch{Email: &changedEmail}); err != nil {
+		t.Fatalf("Failed to update email: %v", err)
+	}
+	if _, err := GetUserByEmail(context.Background(), "EmailTest@email.com"); err == nil {
+		t.Fatal("Expected error retrieving user by previous email, but got none")
+	}
+	if _, err := GetUserByEmail(context.Background(), "emailtestchanged@email.com"); err != nil {
+		t.Fatalf("Failed to retrieve user by new email: %v", err)
+	}
+
+	// Purged users are removed from the email index
+	if err := DeleteUserByUsername(context.Background(), user.Username); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	deleted, _ := GetUserByID(context.Background(), user.ID)
+	PurgeDeletedUsers(context.Background(), deleted.PurgeAt())
+	if _, err := GetUserByEmail(context.Background(), "EmailTestChanged@email.com"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected not found error retrieving deleted user by email, but got %v", err)
+	}
+}
+
+// TestUniqueEmail tests that emails must be unique, regardless of case, on create and update.
+func TestUniqueEmail(t *testing.T) {
+	first := User{Username: "UniqueEmailUser1", Email: "unique@email.com", Password: "uniquePassword"}
+	if err := CreateUser(context.Background(), &first); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	duplicate := User{Username: "UniqueEmailUser2", Email: "UNIQUE@email.com", Password: "uniquePassword"}
+	err := CreateUser(context.Background(), &duplicate)
+	if !errors.Is(err, ErrEmailTaken) || !errors.Is(err, ErrConflict) {
+		t.Fatalf("Expected email taken conflict creating user with duplicate email, but got %v", err)
+	}
+
+	second := User{Username: "UniqueEmailUser2", Email: "other@email.com", Password: "uniquePassword"}
+	if err := CreateUser(context.Background(), &second); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	takenEmail := "Unique@Email.com"
+	if err := UpdateUser(context.Background(), second.ID, UserPatch{Email: &takenEmail}); err == nil {
+		t.Fatal("Expected error updating to another user's email, but got none")
+	}
+
+	// Changing the case of one's own email is allowed
+	if err := UpdateUser(context.Background(), first.ID, UserPatch{Email: &takenEmail}); err != nil {
+		t.Fatalf("Failed to update own email: %v", err)
+	}
+}
+
+// TestLookalikeUsernames tests that usernames with the same canonical form are treated as the same account.
+func TestLookalikeUsernames(t *testing.T) {
+	user := User{Username: "LookalikeUser", Email: "Lookalike@email.com", Password: "lookalikePassword"}
+	if err := CreateUser(context.Background(), &user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	for _, username := range []string{"lookalikeuser", "LΟΟKALIKEUSER", "Lookalike\u200bUser"} {
+		duplicate := User{Username: username, Email: "other-" + user.Email, Password: "pw"}
+		if err := CreateUser(context.Background(), &duplicate); err == nil {
+			t.Errorf("Expected error creating lookalike username %q, but got none", username)
+		}
+	}
+
+	// Lookups are also case and lookalike insensitive, and return the original spelling
+	retrievedUser, err := GetUserByUsername(context.Background(), "LOOKALIKEUSER")
+	if err != nil {
+		t.Fatalf("Failed to retrieve user by lookalike username: %v", err)
+	}
+	if retrievedUser.Username != user.Username {
+		t.Fatalf("Expected %s, but got %s", user.Username, retrievedUser.Username)
+	}
+
+	// Changing only the case keeps the same canonical name and reserves nothing
+	if err := RenameUser(context.Background(), user.ID, "lookalikeUser"); err != nil {
+		t.Fatalf("Failed to change username case: %v", err)
+	}
+	if _, err := GetUserByUsername(context.Background(), "LookalikeUser"); err != nil {
+		t.Fatalf("Failed to retrieve user after changing case: %v", err)
+	}
+}
+
+// TestUserVersion tests that changes increment the version and that conditional
+// updates and deletes fail once the user has changed.
+func TestUserVersion(t *testing.T) {
+	user := User{Username: "VersionTestUser", Email: "VersionTest@email.com", Password: "versionPassword"}
+	if err := CreateUser(context.Background(), &user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if user.Version != 1 {
+		t.Fatalf("Expected new user at version 1, but got %d", user.Version)
+	}
+
+	email := "VersionTestChanged@email.com"
+	if err := UpdateUser(context.Background(), user.ID, UserPatch{Email: &email, Version: 1}); err != nil {
+		t.Fatalf("Failed to update user at the expected version: %v", err)
+	}
+	if err := SetUserDisabled(context.Background(), user.ID, false); err != nil {
+		t.Fatalf("Failed to enable user: %v", err)
+	}
+	retrievedUser, _ := GetUserByID(context.Background(), user.ID)
+	if retrievedUser.Version != 3 {
+		t.Fatalf("Expected version 3 after two changes, but got %d", retrievedUser.Version)
+	}
+
+	// A stale version is rejected without changing anything
+	staleEmail := "VersionTestStale@email.com"
+	if err := UpdateUser(context.Background(), user.ID, UserPatch{Email: &staleEmail, Version: 1}); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("Expected version mismatch, but got %v", err)
+	}
+	if err := DeleteUserByID(context.Background(), user.ID, 2); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("Expected version mismatch deleting user, but got %v", err)
+	}
+	retrievedUser, _ = GetUserByID(context.Background(), user.ID)
+	if retrievedUser.Email != email || retrievedUser.Version != 3 {
+		t.Fatalf("Expected user unchanged by stale requests, but got %+v", retrievedUser)
+	}
+
+	if err := DeleteUserByID(context.Background(), user.ID, 3); err != nil {
+		t.Fatalf("Failed to delete user at the current version: %v", err)
+	}
+}
+
+// TestProfileFields tests the profile fields and settings of new and updated users.
+func TestProfileFields(t *testing.T) {
+	user := User{Username: "ProfileTestUser", Email: "ProfileTest@email.com", Password: "profilePassword"}
+	if err := CreateUser(context.Background(), &user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if user.Settings != DefaultSettings() || user.CreatedAt.IsZero() || !user.UpdatedAt.Equal(user.CreatedAt) {
+		t.Fatalf("Expected default settings and creation time, but got %+v", user)
+	}
+
+	displayName, locale, theme, newsletter := "Profile Tester", "fr-CA", "dark", true
+	err := UpdateUser(context.Background(), user.ID, UserPatch{
+		DisplayName: &displayName,
+		Locale:      &locale,
+		Settings:    &SettingsPatch{Theme: &theme, NotifyNewsletter: &newsletter},
+	})
+	if err != nil {
+		t.Fatalf("Failed to update profile: %v", err)
+	}
+	retrievedUser, _ := GetUserByID(context.Background(), user.ID)
+	if retrievedUser.DisplayName != displayName || retrievedUser.Locale != locale || retrievedUser.Timezone != "" {
+		t.Fatalf("Unexpected profile fields %+v", retrievedUser)
+	}
+	expected := DefaultSettings()
+	expected.Theme, expected.Notifications.Newsletter = theme, newsletter
+	if retrievedUser.Settings != expected {
+		t.Fatalf("Expected settings %+v, but got %+v", expected, retrievedUser.Settings)
+	}
+	if !retrievedUser.UpdatedAt.After(retrievedUser.CreatedAt) && !retrievedUser.UpdatedAt.Equal(retrievedUser.CreatedAt) {
+		t.Fatal("Expected the update time to move forward")
+	}
+
+	// Invalid settings are rejected; resetting restores the defaults
+	invalidTheme := "neon"
+	if err := UpdateUser(context.Background(), user.ID, UserPatch{Settings: &SettingsPatch{Theme: &invalidTheme}}); !errors.Is(err, ErrValidation) {
+		t.Fatalf("Expected validation error for an unknown theme, but got %v", err)
+	}
+	if err := UpdateUser(context.Background(), user.ID, UserPatch{Settings: &SettingsPatch{Reset: true}}); err != nil {
+		t.Fatalf("Failed to reset settings: %v", err)
+	}
+	retrievedUser, _ = GetUserByID(context.Background(), user.ID)
+	if retrievedUser.Settings != DefaultSettings() {
+		t.Fatalf("Expected default settings after reset, but got %+v", retrievedUser.Settings)
+	}
+
+	// Logins are recorded, without changing the version
+	version := retrievedUser.Version
+	now := time.Now()
+	if err := RecordLogin(context.Background(), user.ID, now); err != nil {
+		t.Fatalf("Failed to record login: %v", err)
+	}
+	retrievedUser, _ = GetUserByID(context.Background(), user.ID)
+	if !retrievedUser.LastLoginAt.Equal(now) {
+		t.Fatalf("Expected last login %v, but got %v", now, retrievedUser.LastLoginAt)
+	}
+	if retrievedUser.Version != version {
+		t.Fatalf("Expected a login to keep version %d, but got %d", version, retrievedUser.Version)
+	}
+}
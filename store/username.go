@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"time"
+	"user-api/config"
+	"user-api/util"
+)
+
+// defaultReservationPeriod is used when no username reservation period is configured.
+const defaultReservationPeriod = 30 * 24 * time.Hour
+
+// UsernameChange records a single rename of a user.
+type UsernameChange struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// usernameReservation keeps a released username from being claimed by anyone but its
+// previous owner until it expires, so it can't be used to impersonate them.
+type usernameReservation struct {
+	userID int
+	until  time.Time
+}
+
+// RenameUser changes the username of an existing user. The user map is re-indexed
+// atomically, the change is appended to the user's username history and the old
+// username is reserved for the user for the configured reservation period.
+// Users may reclaim their own reserved usernames, and may change the case or
+// spelling of their username as long as its canonical form stays the same, in
+// which case nothing is reserved.
+// Returns an error if the user is not found, if the username is unchanged,
+// or if the new username is taken or reserved by someone else.
+func RenameUser(ctx context.Context, id int, newUsername string) error {
+	_, done := observe(ctx, "rename_user")
+	defer done()
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	storeUser, exists := store.userByID[id]
+	if !exists {
+		return ErrUserNotFound
+	}
+	if newUsername == storeUser.Username {
+		return ErrUsernameUnchanged
+	}
+
+	oldKey := util.CanonicalUsername(storeUser.Username)
+	newKey := util.CanonicalUsername(newUsername)
+	if owner, exists := store.userMap[newKey]; exists && owner != storeUser {
+		return ErrUsernameTaken
+	}
+	if isUsernameReserved(newKey, id) {
+		return ErrUsernameReserved
+	}
+
+	now := time.Now()
+	oldUsername := storeUser.Username
+
+	delete(store.userMap, oldKey)
+	delete(store.reservedUsernames, newKey)
+	storeUser.Username = newUsername
+	store.userMap[newKey] = storeUser
+
+	storeUser.UsernameHistory = append(storeUser.UsernameHistory, UsernameChange{
+		From:      oldUsername,
+		To:        newUsername,
+		ChangedAt: now,
+	})
+	touch(storeUser)
+	if oldKey != newKey {
+		store.reservedUsernames[oldKey] = usernameReservation{
+			userID: id,
+			until:  now.Add(reservationPeriod()),
+		}
+	}
+
+	return nil
+}
+
+// isUsernameReserved reports whether the canonical username key is reserved for a user other than userID.
+// Expired reservations are removed. The caller must hold the store's write lock.
+func isUsernameReserved(key string, userID int) bool {
+	reservation, exists := store.reservedUsernames[key]
+	if !exists {
+		return false
+	}
+	if time.Now().After(reservation.until) {
+		delete(store.reservedUsernames, key)
+		return false
+	}
+	return reservation.userID != userID
+}
+
+// reservationPeriod returns the configured username reservation period, or the default if unset.
+func reservationPeriod() time.Duration {
+	if config.C.UsernameReservationPeriod > 0 {
+		return config.C.UsernameReservationPeriod
+	}
+	return defaultReservationPeriod
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+	"user-api/config"
+	"user-api/util"
+)
+
+// TestRenameUser tests that renaming re-indexes the user and records the change in its history.
+func TestRenameUser(t *testing.T) {
+	user := User{Username: "RenameTestUser", Email: "RenameTest@email.com", Password: "renamePassword"}
+	if err := CreateUser(context.Background(), &user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	if err := RenameUser(context.Background(), user.ID, "RenamedTestUser"); err != nil {
+		t.Fatalf("Failed to rename user: %v", err)
+	}
+
+	// The user is only reachable under the new name, and keeps its ID
+	if _, err := GetUserByUsername(context.Background(), "RenameTestUser"); err == nil {
+		t.Fatal("Expected error retrieving user by old username, but got none")
+	}
+	renamed, err := GetUserByUsername(context.Background(), "RenamedTestUser")
+	if err != nil {
+		t.Fatalf("Failed to retrieve user by new username: %v", err)
+	}
+	if renamed.ID != user.ID {
+		t.Fatalf("Expected ID %d to be kept, but got %d", user.ID, renamed.ID)
+	}
+
+	if len(renamed.UsernameHistory) != 1 ||
+		renamed.UsernameHistory[0].From != "RenameTestUser" ||
+		renamed.UsernameHistory[0].To != "RenamedTestUser" {
+		t.Fatalf("Unexpected username history: %+v", renamed.UsernameHistory)
+	}
+
+	// Renaming to the current or an existing username fails
+	if err := RenameUser(context.Background(), user.ID, "RenamedTestUser"); err == nil {
+		t.Error("Expected error renaming to the current username, but got none")
+	}
+	other := User{Username: "RenameOtherUser", Email: "RenameOther@email.com", Password: "renamePassword"}
+	if err := CreateUser(context.Background(), &other); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := RenameUser(context.Background(), user.ID, other.Username); err == nil {
+		t.Error("Expected error renaming to another user's username, but got none")
+	}
+}
+
+// TestUsernameReservation tests that released usernames are reserved for their previous owner until they expire.
+func TestUsernameReservation(t *testing.T) {
+	defer func(c config.Config) { config.C = c }(config.C)
+	config.C.UsernameReservationPeriod = time.Hour
+
+	user := User{Username: "ReservedTestUser", Email: "ReservedTest@email.com", Password: "reservedPassword"}
+	if err := CreateUser(context.Background(), &user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := RenameUser(context.Background(), user.ID, "ReservedTestUserNew"); err != nil {
+		t.Fatalf("Failed to rename user: %v", err)
+	}
+
+	// Nobody else can claim the old username, through registration or rename
+	if err := CreateUser(context.Background(), &User{Username: "ReservedTestUser", Email: "squatter@email.com", Password: "pw"}); err == nil {
+		t.Fatal("Expected error registering a reserved username, but got none")
+	}
+	other := User{Username: "ReservedOtherUser", Email: "ReservedOther@email.com", Password: "pw"}
+	if err := CreateUser(context.Background(), &other); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := RenameUser(context.Background(), other.ID, "ReservedTestUser"); err == nil {
+		t.Fatal("Expected error renaming to a reserved username, but got none")
+	}
+
+	// The previous owner can take it back
+	if err := RenameUser(context.Background(), user.ID, "ReservedTestUser"); err != nil {
+		t.Fatalf("Failed to reclaim own reserved username: %v", err)
+	}
+
+	// Once the reservation expires, the name is free again
+	store.mutex.Lock()
+	store.reservedUsernames[util.CanonicalUsername("ReservedTestUserNew")] = usernameReservation{userID: user.ID, until: time.Now().Add(-time.Second)}
+	store.mutex.Unlock()
+	if err := RenameUser(context.Background(), other.ID, "ReservedTestUserNew"); err != nil {
+		t.Fatalf("Failed to claim username after reservation expired: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+// Package tracing sets up OpenTelemetry tracing. Spans are recorded through the
+// go.opentelemetry.io/otel API, propagated across services with the W3C Trace Context
+// traceparent header, and sent to an OpenTelemetry collector through OTLP/HTTP.
+//
+// Spans are carried by contexts: Start begins a span as a child of the span in its
+// context, or of the remote parent extracted from an incoming request. Until Setup or
+// SetProvider installs a tracer provider, spans are propagated but not recorded.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"user-api/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer spans of this application are recorded with.
+const instrumentationName = "user-api"
+
+var (
+	mutex    sync.Mutex
+	provider *sdktrace.TracerProvider // Installed by SetProvider; nil if spans aren't recorded
+)
+
+func init() {
+	// Propagate trace context even when spans aren't recorded, so traces continue
+	// through this server to the services it calls
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+}
+
+// Start begins a span named name, as a child of the span in ctx, and returns a context
+// carrying it. The span must be ended by calling its End method.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// SetProvider installs tp as the global tracer provider, replacing any provider installed
+// before, which is shut down.
+func SetProvider(tp *sdktrace.TracerProvider) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	previous := provider
+	provider = tp
+	otel.SetTracerProvider(tp)
+	if previous != nil {
+		_ = previous.Shutdown(context.Background())
+	}
+}
+
+// Shutdown exports the spans ended so far and stops recording spans. Spans ended
+// afterwards are dropped.
+func Shutdown(ctx context.Context) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if provider == nil {
+		return nil
+	}
+	err := provider.Shutdown(ctx)
+	provider = nil
+	return err
+}
+
+// Setup installs a tracer provider recording TRACING_SAMPLE_RATIO of the traces started
+// here, and of those continued from a caller that sampled them, and exporting them as
+// selected by TRACING_EXPORTER. Spans are exported in batches in the background, and
+// export failures are logged.
+func Setup() error {
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.C.TracingSampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(config.C.TracingServiceName))),
+	}
+
+	switch config.C.TracingExporter {
+	case "", "none":
+	case "otlp":
+		exporter, err := newOTLPExporter()
+		if err != nil {
+			return err
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	default:
+		return fmt.Errorf("unknown tracing exporter %q", config.C.TracingExporter)
+	}
+
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		slog.Error("failed to export spans", "error", err)
+	}))
+	SetProvider(sdktrace.NewTracerProvider(opts...))
+	return nil
+}
+
+// newOTLPExporter returns an exporter posting spans to the /v1/traces path under
+// OTEL_EXPORTER_OTLP_ENDPOINT, with the OTEL_EXPORTER_OTLP_HEADERS.
+func newOTLPExporter() (sdktrace.SpanExporter, error) {
+	endpoint, err := url.Parse(config.C.OTLPEndpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_ENDPOINT %q", config.C.OTLPEndpoint)
+	}
+	headers, err := parseHeaders(config.C.OTLPHeaders)
+	if err != nil {
+		return nil, err
+	}
+
+	return otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(strings.TrimSuffix(endpoint.String(), "/")+"/v1/traces"),
+		otlptracehttp.WithHeaders(headers),
+	)
+}
+
+// parseHeaders parses comma-separated key=value pairs, as in OTEL_EXPORTER_OTLP_HEADERS.
+func parseHeaders(value string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, errors.New("OTEL_EXPORTER_OTLP_HEADERS must hold key=value pairs")
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+	return headers, nil
+}
@@ -0,0 +1,171 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-api/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// useMemory records every span to an in-memory exporter until the test ends.
+func useMemory(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	memory := tracetest.NewInMemoryExporter()
+	SetProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(memory)))
+	t.Cleanup(func() { _ = Shutdown(context.Background()) })
+	return memory
+}
+
+// TestPropagation tests that spans continue an extracted trace and are injected into outgoing headers.
+func TestPropagation(t *testing.T) {
+	memory := useMemory(t)
+
+	incoming := http.Header{}
+	incoming.Set("traceparent", traceparent)
+	incoming.Set("tracestate", "vendor=value")
+
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(incoming))
+	ctx, span := Start(ctx, "server", trace.WithSpanKind(trace.SpanKindServer))
+	outgoing := http.Header{}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(outgoing))
+	span.End()
+
+	sc := span.SpanContext()
+	if sc.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID().String() == "00f067aa0ba902b7" {
+		t.Errorf("Expected a new span in the remote trace, but got %v", sc)
+	}
+	if got, want := outgoing.Get("traceparent"), "00-"+sc.TraceID().String()+"-"+sc.SpanID().String()+"-01"; got != want {
+		t.Errorf("Expected traceparent %q, but got %q", want, got)
+	}
+	if got := outgoing.Get("tracestate"); got != "vendor=value" {
+		t.Errorf("Expected tracestate to be passed on, but got %q", got)
+	}
+
+	spans := memory.GetSpans()
+	if len(spans) != 1 || spans[0].Parent.SpanID().String() != "00f067aa0ba902b7" || spans[0].SpanKind != trace.SpanKindServer {
+		t.Errorf("Expected the server span to be a child of the remote span, got %+v", spans)
+	}
+}
+
+// TestSampling tests that TRACING_SAMPLE_RATIO applies to new traces, while traces
+// continued from a caller follow the caller's decision.
+func TestSampling(t *testing.T) {
+	defer func(c config.Config) { config.C = c }(config.C)
+	defer Shutdown(context.Background())
+	config.C.TracingExporter, config.C.TracingSampleRatio = "none", 0
+	if err := Setup(); err != nil {
+		t.Fatalf("Failed to set up tracing: %v", err)
+	}
+
+	_, span := Start(context.Background(), "unsampled")
+	span.End()
+	if span.IsRecording() || !span.SpanContext().IsValid() || span.SpanContext().IsSampled() {
+		t.Errorf("Expected a valid, unsampled span context, got %v", span.SpanContext())
+	}
+
+	header := http.Header{}
+	header.Set("traceparent", traceparent)
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(header))
+	_, span = Start(ctx, "sampled")
+	span.End()
+	if !span.SpanContext().IsSampled() {
+		t.Error("Expected the span of a sampled parent to be sampled")
+	}
+}
+
+// TestSetup tests that invalid tracing settings are rejected.
+func TestSetup(t *testing.T) {
+	defer func(c config.Config) { config.C = c }(config.C)
+	defer Shutdown(context.Background())
+
+	tests := []struct {
+		exporter string
+		endpoint string
+		headers  string
+		valid    bool
+	}{
+		{"none", "", "", true},
+		{"otlp", "http://collector:4318", "Authorization=Bearer abc, X-Tenant=a", true},
+		{"jaeger", "http://collector:4318", "", false},
+		{"otlp", "collector:4318", "", false},
+		{"otlp", "http://collector:4318", "Authorization", false},
+	}
+
+	for _, test := range tests {
+		config.C.TracingExporter, config.C.OTLPEndpoint, config.C.OTLPHeaders = test.exporter, test.endpoint, test.headers
+		if err := Setup(); (err == nil) != test.valid {
+			t.Errorf("Expected valid=%v for %+v, but got %v", test.valid, test, err)
+		}
+	}
+}
+
+// TestOTLP tests that spans are posted to the collector with the configured headers and
+// service name.
+func TestOTLP(t *testing.T) {
+	received := make(chan *collectortrace.ExportTraceServiceRequest, 1)
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/prefix/v1/traces" {
+			http.NotFound(w, r)
+			return
+		}
+		header = r.Header
+		body, _ := io.ReadAll(r.Body)
+		request := &collectortrace.ExportTraceServiceRequest{}
+		if err := proto.Unmarshal(body, request); err != nil {
+			t.Errorf("Failed to decode export request: %v", err)
+		}
+		received <- request
+	}))
+	defer server.Close()
+
+	defer func(c config.Config) { config.C = c }(config.C)
+	config.C.TracingExporter, config.C.TracingSampleRatio, config.C.TracingServiceName = "otlp", 1, "test-service"
+	config.C.OTLPEndpoint, config.C.OTLPHeaders = server.URL+"/prefix/", "Authorization=Bearer key"
+	if err := Setup(); err != nil {
+		t.Fatalf("Failed to set up tracing: %v", err)
+	}
+
+	_, span := Start(context.Background(), "op", trace.WithSpanKind(trace.SpanKindServer))
+	span.End()
+	if err := Shutdown(context.Background()); err != nil {
+		t.Fatalf("Failed to export spans: %v", err)
+	}
+
+	var request *collectortrace.ExportTraceServiceRequest
+	select {
+	case request = <-received:
+	default:
+		t.Fatal("Expected the spans to be exported on shutdown")
+	}
+	if header.Get("Authorization") != "Bearer key" {
+		t.Errorf("Unexpected request headers %v", header)
+	}
+	resourceSpans := request.GetResourceSpans()[0]
+	var service string
+	for _, attr := range resourceSpans.GetResource().GetAttributes() {
+		if attr.GetKey() == "service.name" {
+			service = attr.GetValue().GetStringValue()
+		}
+	}
+	if service != "test-service" {
+		t.Errorf("Expected service name test-service, but got %q", service)
+	}
+	exported := resourceSpans.GetScopeSpans()[0].GetSpans()[0]
+	if exported.GetName() != "op" || hex.EncodeToString(exported.GetTraceId()) != span.SpanContext().TraceID().String() {
+		t.Errorf("Unexpected span %v", exported)
+	}
+}
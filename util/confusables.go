@@ -0,0 +1,57 @@
+package util
+
+// confusables maps characters that are commonly mistaken for one another to a
+// single prototype, after NFKC normalization and case folding. It is a subset of
+// the Unicode confusables data (UTS #39) covering the Latin lookalikes most often
+// used to spoof usernames: Cyrillic and Greek letters, digits and a few symbols.
+var confusables = map[rune]rune{
+	// Digits and symbols
+	'0': 'o',
+	'1': 'l',
+	'|': 'l',
+	'ı': 'i', // Latin small dotless i
+	'ſ': 'f', // Latin small long s
+
+	// Cyrillic
+	'а': 'a',
+	'в': 'b',
+	'с': 'c',
+	'ԁ': 'd',
+	'е': 'e',
+	'ё': 'e',
+	'һ': 'h',
+	'і': 'i',
+	'ї': 'i',
+	'ј': 'j',
+	'к': 'k',
+	'ӏ': 'l',
+	'м': 'm',
+	'п': 'n',
+	'о': 'o',
+	'р': 'p',
+	'ԛ': 'q',
+	'ѕ': 's',
+	'т': 't',
+	'ц': 'u',
+	'ѵ': 'v',
+	'ԝ': 'w',
+	'х': 'x',
+	'у': 'y',
+	'з': '3',
+
+	// Greek
+	'α': 'a',
+	'β': 'b',
+	'ε': 'e',
+	'η': 'n',
+	'ι': 'i',
+	'κ': 'k',
+	'ν': 'v',
+	'ο': 'o',
+	'ρ': 'p',
+	'τ': 't',
+	'υ': 'u',
+	'χ': 'x',
+	'γ': 'y',
+	'ω': 'w',
+}
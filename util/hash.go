@@ -1,33 +1,363 @@
 package util
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"user-api/config"
+	"user-api/tracing"
 
-// HashPassword takes a plaintext password and returns its bcrypt hash.
-// bcrypt is used because it is currently considered one of the most secure
-// password hashing schemes, and it automatically handles the creation of salt.
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported password hashing algorithms, as accepted by the PASSWORD_HASH_ALGORITHM setting.
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+// Default hashing parameters, used when the configuration leaves a value unset.
+const (
+	defaultArgon2Time    = 3
+	defaultArgon2Memory  = 64 * 1024
+	defaultArgon2Threads = 2
+	argon2KeyLength      = 32
+	argon2SaltLength     = 16
+
+	// maxArgon2Memory is the most memory, in KiB, an argon2id hash may ask for: 4 GiB.
+	// Stored hashes asking for more are rejected as malformed rather than exhausting memory.
+	maxArgon2Memory = 4 * 1024 * 1024
+)
+
+// ErrUnknownHashFormat is returned when an encoded hash does not match any supported algorithm.
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// ErrMalformedHash is returned when an encoded hash names a supported algorithm but cannot be parsed.
+var ErrMalformedHash = errors.New("malformed password hash")
+
+// Hasher hashes and verifies passwords with a single algorithm and parameter set.
+// Encoded hashes are self-describing, so a Hasher can verify hashes produced with
+// different parameters of its own algorithm and report whether they should be upgraded.
+type Hasher interface {
+	// Hash returns the encoded hash of password using the hasher's current parameters.
+	Hash(password string) (string, error)
+	// Verify reports whether password matches the encoded hash.
+	Verify(password, encoded string) (bool, error)
+	// Identifies reports whether the encoded hash was produced by this hasher's algorithm.
+	Identifies(encoded string) bool
+	// NeedsRehash reports whether the encoded hash uses parameters other than the hasher's current ones.
+	NeedsRehash(encoded string) bool
+}
+
+// Argon2idHasher hashes passwords with argon2id and encodes them in PHC string format:
+//
+//	$argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<hash>
+//
+// Salt and hash are encoded with unpadded standard base64.
+type Argon2idHasher struct {
+	Time    uint32 // Number of passes over the memory
+	Memory  uint32 // Memory cost in KiB
+	Threads uint8  // Degree of parallelism
+}
+
+// argon2Params holds the parameters decoded from an argon2id PHC string.
+type argon2Params struct {
+	version int
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// Hash implements Hasher.
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify implements Hasher. The parameters stored in the encoded hash are used,
+// not the hasher's own, so hashes created under older settings still verify.
+func (h Argon2idHasher) Verify(password, encoded string) (bool, error) {
+	p, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	key := argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+	return subtle.ConstantTimeCompare(key, p.key) == 1, nil
+}
+
+// Identifies implements Hasher.
+func (h Argon2idHasher) Identifies(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+// NeedsRehash implements Hasher.
+func (h Argon2idHasher) NeedsRehash(encoded string) bool {
+	p, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return p.version != argon2.Version ||
+		p.memory != h.Memory ||
+		p.time != h.Time ||
+		p.threads != h.Threads ||
+		len(p.key) != argon2KeyLength
+}
+
+// decodeArgon2id parses an argon2id PHC string into its parameters, salt and key.
+func decodeArgon2id(encoded string) (*argon2Params, error) {
+	// "$argon2id$v=19$m=...,t=...,p=...$salt$hash" splits into 6 parts, the first being empty
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+		return nil, ErrMalformedHash
+	}
+
+	p := &argon2Params{}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &p.version); err != nil {
+		return nil, ErrMalformedHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return nil, ErrMalformedHash
+	}
+	// argon2.IDKey panics on parameters it doesn't support
+	if p.time < 1 || p.threads < 1 || p.memory < 8*uint32(p.threads) || p.memory > maxArgon2Memory {
+		return nil, ErrMalformedHash
+	}
+
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, ErrMalformedHash
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(p.key) == 0 {
+		return nil, ErrMalformedHash
+	}
+
+	return p, nil
+}
+
+// BcryptHasher hashes passwords with bcrypt. bcrypt hashes carry their own salt
+// and cost in the modular crypt format ($2a$<cost>$...).
+type BcryptHasher struct {
+	Cost int
+}
+
+// Hash implements Hasher.
+func (h BcryptHasher) Hash(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(bytes), err
+}
+
+// Verify implements Hasher.
+func (h BcryptHasher) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Identifies implements Hasher.
+func (h BcryptHasher) Identifies(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") ||
+		strings.HasPrefix(encoded, "$2b$") ||
+		strings.HasPrefix(encoded, "$2y$")
+}
+
+// NeedsRehash implements Hasher.
+func (h BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
+
+// CheckPasswordConfig returns an error if the password hashing configuration is invalid:
+// an unknown PASSWORD_HASH_ALGORITHM, out of range argon2id parameters or BCRYPT_COST, or
+// malformed PASSWORD_PEPPERS. It is called at startup, as otherwise the error would only
+// surface when a password is hashed or checked, failing every registration or login.
+func CheckPasswordConfig() error {
+	switch strings.ToLower(config.C.PasswordHashAlgorithm) {
+	case "", AlgorithmArgon2id:
+		if config.C.Argon2Time < 0 || config.C.Argon2Memory < 0 || config.C.Argon2Threads < 0 || config.C.Argon2Threads > 255 {
+			return errors.New("ARGON2_TIME, ARGON2_MEMORY and ARGON2_THREADS must be positive, with at most 255 threads")
+		}
+		if h := argon2idHasher(); config.C.Argon2Memory > maxArgon2Memory || h.Memory < 8*uint32(h.Threads) {
+			return fmt.Errorf("ARGON2_MEMORY must be between 8 KiB per thread and %d KiB", maxArgon2Memory)
+		}
+	case AlgorithmBcrypt:
+		if cost := config.C.BcryptCost; cost != 0 && (cost < bcrypt.MinCost || cost > bcrypt.MaxCost) {
+			return fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return fmt.Errorf("unknown PASSWORD_HASH_ALGORITHM %q: expected %s or %s", config.C.PasswordHashAlgorithm, AlgorithmArgon2id, AlgorithmBcrypt)
+	}
+	if _, err := loadPeppers(); err != nil {
+		return fmt.Errorf("invalid PASSWORD_PEPPERS: %w", err)
+	}
+	return nil
+}
+
+// CurrentHasher returns the hasher used for new password hashes, built from the
+// application's configuration. Unset parameters fall back to sensible defaults; the
+// configuration is checked by CheckPasswordConfig at startup.
+func CurrentHasher() Hasher {
+	if strings.EqualFold(config.C.PasswordHashAlgorithm, AlgorithmBcrypt) {
+		return bcryptHasher()
+	}
+	return argon2idHasher()
+}
+
+// argon2idHasher returns an Argon2idHasher configured from the application's configuration.
+func argon2idHasher() Argon2idHasher {
+	h := Argon2idHasher{
+		Time:    uint32(config.C.Argon2Time),
+		Memory:  uint32(config.C.Argon2Memory),
+		Threads: uint8(config.C.Argon2Threads),
+	}
+	if h.Time == 0 {
+		h.Time = defaultArgon2Time
+	}
+	if h.Memory == 0 {
+		h.Memory = defaultArgon2Memory
+	}
+	if h.Threads == 0 {
+		h.Threads = defaultArgon2Threads
+	}
+	return h
+}
+
+// bcryptHasher returns a BcryptHasher configured from the application's configuration.
+func bcryptHasher() BcryptHasher {
+	cost := config.C.BcryptCost
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	return BcryptHasher{Cost: cost}
+}
+
+// hasherFor returns the hasher able to verify the given encoded hash.
+func hasherFor(encoded string) (Hasher, error) {
+	for _, h := range []Hasher{argon2idHasher(), bcryptHasher()} {
+		if h.Identifies(encoded) {
+			return h, nil
+		}
+	}
+	return nil, ErrUnknownHashFormat
+}
+
+// HashPassword takes a plaintext password and returns its encoded hash.
+// The algorithm and cost are taken from configuration (argon2id by default); the
+// encoded hash records them, together with a random salt, so it can be verified
+// even after the configuration changes. When peppers are configured, the password
+// is first combined with the current pepper and the pepper version is recorded
+// in the encoded hash. Hashing is deliberately slow, so it runs in a span of its own.
 //
 // Parameters:
+// - ctx: the context carrying the span of the caller.
 // - password: the plaintext password to be hashed.
 //
 // Returns:
-// - the bcrypt hash of the password as a string.
+// - the encoded hash of the password as a string.
 // - error, if any occurred during hashing.
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(bytes), err
+func HashPassword(ctx context.Context, password string) (string, error) {
+	_, span := tracing.Start(ctx, "password.hash")
+	defer span.End()
+
+	ring, err := loadPeppers()
+	if err != nil {
+		return "", err
+	}
+	if ring.current == 0 {
+		return CurrentHasher().Hash(password)
+	}
+
+	encoded, err := CurrentHasher().Hash(pepper(password, ring.keys[ring.current]))
+	if err != nil {
+		return "", err
+	}
+	return pepperPrefix + strconv.Itoa(ring.current) + encoded, nil
 }
 
-// CheckHashedPassword compares a plaintext password with its bcrypt hash to
+// CheckHashedPassword compares a plaintext password with its encoded hash to
 // check if they match. This is used during user login to validate the
-// user-provided password against the stored hash.
+// user-provided password against the stored hash. Both argon2id and bcrypt
+// hashes are accepted regardless of the currently configured algorithm, and
+// peppered hashes are checked with the pepper version they were created with.
+// Like hashing, checking runs in a span of its own.
 //
 // Parameters:
+// - ctx: the context carrying the span of the caller.
 // - password: the plaintext password to check.
-// - hash: the bcrypt hash against which the password needs to be checked.
+// - hash: the encoded hash against which the password needs to be checked.
 //
 // Returns:
 // - true if the password matches the hash, false otherwise.
-func CheckHashedPassword(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+func CheckHashedPassword(ctx context.Context, password, hash string) bool {
+	_, span := tracing.Start(ctx, "password.verify")
+	defer span.End()
+
+	version, inner, err := splitPepper(hash)
+	if err != nil {
+		return false
+	}
+	if version != 0 {
+		ring, err := loadPeppers()
+		if err != nil {
+			return false
+		}
+		key, ok := ring.keys[version]
+		if !ok {
+			return false
+		}
+		password = pepper(password, key)
+	}
+
+	h, err := hasherFor(inner)
+	if err != nil {
+		return false
+	}
+	ok, err := h.Verify(password, inner)
+	return err == nil && ok
+}
+
+// NeedsRehash reports whether a stored hash was produced with an algorithm,
+// parameters or pepper version other than the currently configured ones.
+// Callers should rehash the password after a successful check so stored hashes
+// are upgraded over time.
+//
+// Parameters:
+// - hash: the encoded hash to inspect.
+//
+// Returns:
+// - true if the hash should be replaced, false otherwise.
+func NeedsRehash(hash string) bool {
+	version, inner, err := splitPepper(hash)
+	if err != nil {
+		return true
+	}
+	if ring, err := loadPeppers(); err != nil || version != ring.current {
+		return true
+	}
+
+	current := CurrentHasher()
+	if !current.Identifies(inner) {
+		return true
+	}
+	return current.NeedsRehash(inner)
 }
@@ -1,7 +1,11 @@
 package util
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"testing"
+	"user-api/config"
 )
 
 // TestHashAndCheckPassword tests the utility functions for hashing and checking hashed passwords.
@@ -10,7 +14,7 @@ func TestHashAndCheckPassword(t *testing.T) {
 	password := "testPassword123"
 
 	// Hash the sample password
-	hashedPassword, err := HashPassword(password)
+	hashedPassword, err := HashPassword(context.Background(), password)
 	if err != nil {
 		t.Fatalf("Failed to hash password: %v", err)
 	}
@@ -20,7 +24,7 @@ func TestHashAndCheckPassword(t *testing.T) {
 	}
 
 	// Check the hashed password with the original password
-	isValid := CheckHashedPassword(password, hashedPassword)
+	isValid := CheckHashedPassword(context.Background(), password, hashedPassword)
 	if !isValid {
 		t.Fatal("Failed to validate the hashed password")
 	}
@@ -33,14 +37,136 @@ func TestCheckWrongPassword(t *testing.T) {
 	wrongPassword := "wrongPassword123"
 
 	// Hash the sample password
-	hashedPassword, err := HashPassword(password)
+	hashedPassword, err := HashPassword(context.Background(), password)
 	if err != nil {
 		t.Fatalf("Failed to hash password: %v", err)
 	}
 
 	// Attempt to check the hashed password with a wrong password
-	isValid := CheckHashedPassword(wrongPassword, hashedPassword)
+	isValid := CheckHashedPassword(context.Background(), wrongPassword, hashedPassword)
 	if isValid {
 		t.Fatal("Expected password validation to fail, but it passed")
 	}
 }
+
+// TestHashersRoundTrip tests that each supported hasher verifies its own hashes
+// and rejects wrong passwords.
+func TestHashersRoundTrip(t *testing.T) {
+	hashers := map[string]Hasher{
+		AlgorithmArgon2id: Argon2idHasher{Time: 1, Memory: 8 * 1024, Threads: 1},
+		AlgorithmBcrypt:   BcryptHasher{Cost: 4},
+	}
+
+	for name, h := range hashers {
+		encoded, err := h.Hash("testPassword123")
+		if err != nil {
+			t.Fatalf("%s: failed to hash password: %v", name, err)
+		}
+		if !h.Identifies(encoded) {
+			t.Errorf("%s: hasher does not identify its own hash %q", name, encoded)
+		}
+
+		ok, err := h.Verify("testPassword123", encoded)
+		if err != nil || !ok {
+			t.Errorf("%s: expected password to verify, got %v (err: %v)", name, ok, err)
+		}
+
+		ok, err = h.Verify("wrongPassword123", encoded)
+		if err != nil || ok {
+			t.Errorf("%s: expected wrong password to be rejected, got %v (err: %v)", name, ok, err)
+		}
+	}
+}
+
+// TestArgon2idEncoding tests that argon2id hashes are encoded in PHC format with their parameters.
+func TestArgon2idEncoding(t *testing.T) {
+	h := Argon2idHasher{Time: 2, Memory: 8 * 1024, Threads: 1}
+
+	encoded, err := h.Hash("testPassword123")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=8192,t=2,p=1$") {
+		t.Fatalf("Unexpected encoding: %s", encoded)
+	}
+
+	// Malformed hashes, including parameters argon2 can't run with or that would
+	// allocate without limit, must not verify
+	salt, key := strings.Split(encoded, "$")[4], strings.Split(encoded, "$")[5]
+	malformed := []string{
+		"$argon2id$v=19$garbage",
+		"$argon2id$v=19$m=8192,t=0,p=1$" + salt + "$" + key,
+		"$argon2id$v=19$m=8192,t=2,p=0$" + salt + "$" + key,
+		"$argon2id$v=19$m=7,t=2,p=1$" + salt + "$" + key,
+		"$argon2id$v=19$m=8191,t=2,p=1024$" + salt + "$" + key,
+		"$argon2id$v=19$m=4194305,t=2,p=1$" + salt + "$" + key,
+		"$argon2id$v=19$m=8192,t=2,p=1$" + salt + "$",
+	}
+	for _, encoded := range malformed {
+		if _, err := h.Verify("testPassword123", encoded); !errors.Is(err, ErrMalformedHash) {
+			t.Errorf("Expected ErrMalformedHash for %s, but got %v", encoded, err)
+		}
+	}
+}
+
+// TestNeedsRehash tests detection of hashes using an outdated algorithm or parameters.
+func TestNeedsRehash(t *testing.T) {
+	defer func(c config.Config) { config.C = c }(config.C)
+	config.C.PasswordHashAlgorithm = AlgorithmArgon2id
+	config.C.Argon2Time, config.C.Argon2Memory, config.C.Argon2Threads = 1, 8*1024, 1
+
+	current, err := HashPassword(context.Background(), "testPassword123")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	if NeedsRehash(current) {
+		t.Error("Hash with current parameters should not need a rehash")
+	}
+
+	weaker, _ := Argon2idHasher{Time: 1, Memory: 4 * 1024, Threads: 1}.Hash("testPassword123")
+	if !NeedsRehash(weaker) {
+		t.Error("Hash with outdated argon2id parameters should need a rehash")
+	}
+
+	legacy, _ := BcryptHasher{Cost: 4}.Hash("testPassword123")
+	if !NeedsRehash(legacy) {
+		t.Error("bcrypt hash should need a rehash when argon2id is configured")
+	}
+	if !CheckHashedPassword(context.Background(), "testPassword123", legacy) {
+		t.Error("bcrypt hash should still verify when argon2id is configured")
+	}
+
+	config.C.PasswordHashAlgorithm = AlgorithmBcrypt
+	config.C.BcryptCost = 4
+	if NeedsRehash(legacy) {
+		t.Error("bcrypt hash with current cost should not need a rehash")
+	}
+}
+
+// TestCheckPasswordConfig tests that invalid hashing configuration is reported up front.
+func TestCheckPasswordConfig(t *testing.T) {
+	defer func(c config.Config) { config.C = c }(config.C)
+
+	tests := []struct {
+		algorithm string
+		cost      int
+		memory    int
+		peppers   string
+		valid     bool
+	}{
+		{AlgorithmArgon2id, 0, 0, "", true},
+		{"", 0, 64 * 1024, "1:secret,2:other", true},
+		{"BCRYPT", 12, 0, "", true},
+		{"scrypt", 0, 0, "", false},
+		{AlgorithmBcrypt, 40, 0, "", false},
+		{AlgorithmArgon2id, 0, 8 * 1024 * 1024, "", false},
+		{AlgorithmArgon2id, 0, 0, "secret", false},
+	}
+	for _, tt := range tests {
+		config.C.PasswordHashAlgorithm, config.C.BcryptCost, config.C.Argon2Memory, config.C.PasswordPeppers = tt.algorithm, tt.cost, tt.memory, tt.peppers
+		if err := CheckPasswordConfig(); (err == nil) != tt.valid {
+			t.Errorf("CheckPasswordConfig() with algorithm %q, cost %d, memory %d and peppers %q returned %v", tt.algorithm, tt.cost, tt.memory, tt.peppers, err)
+		}
+	}
+}
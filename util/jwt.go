@@ -1,43 +1,80 @@
 package util
 
 import (
+	"errors"
 	"github.com/golang-jwt/jwt/v5"
+	"strconv"
 	"time"
 	"user-api/config"
 )
 
-// JWTKey is the secret key used to sign and validate JWTs.
-// It's sourced from configuration.
-var JWTKey = []byte(config.C.JWTSecret)
+// ErrSigningKeyMissing is returned when tokens are issued or validated without a signing key.
+var ErrSigningKeyMissing = errors.New("JWT_KEY is not set")
+
+// JWTKey returns the secret key used to sign and validate JWTs, sourced from configuration.
+// It is read on every use, as the package is initialized before the configuration is loaded.
+func JWTKey() ([]byte, error) {
+	if config.C.JWTSecret == "" {
+		return nil, ErrSigningKeyMissing
+	}
+	return []byte(config.C.JWTSecret), nil
+}
 
 // Claims defines the structure for JWT claims for the API.
-// It embeds jwt.RegisteredClaims to include standard claims.
+// It embeds jwt.RegisteredClaims to include standard claims. The subject ("sub")
+// is the user's immutable ID; Username is informational only, as users can rename themselves.
+// Roles and permissions are captured when the token is issued; changes to a
+// user's access take effect with their next token.
 type Claims struct {
-	Username string
+	Username    string
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken creates a new JWT token for a given username.
+// GenerateToken creates a new JWT token for a given user.
 // The token will expire 24 hours from the time of generation.
 //
 // Parameters:
-// - username: the name of the user for whom the token is being generated.
+// - userID: the ID of the user for whom the token is being generated, used as the subject.
+// - username: the current name of the user.
+// - roles: the roles assigned to the user.
+// - permissions: the effective permissions of the user (see EffectivePermissions).
+// - revokedAt: when the user's tokens were last revoked, or the zero time.
+//
+// Issue times have a precision of one second, and tokens issued in the same second as a
+// revocation are treated as revoked, since they can't be told apart from those issued just
+// before it. A token issued in that second is therefore dated to the next one, so that a
+// login right after a revocation gets a token that is accepted.
 //
 // Returns:
 // - a JWT as a string.
 // - error, if any occurred during token generation.
-func GenerateToken(username string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+func GenerateToken(userID int, username string, roles, permissions []string, revokedAt time.Time) (string, error) {
+	now := time.Now()
+	expirationTime := now.Add(24 * time.Hour)
+	issuedAt := now.Truncate(time.Second)
+	if revoked := revokedAt.Truncate(time.Second); !revokedAt.IsZero() && !issuedAt.After(revoked) {
+		issuedAt = revoked.Add(time.Second)
+	}
 
 	claims := &Claims{
-		Username: username,
+		Username:    username,
+		Roles:       roles,
+		Permissions: permissions,
 		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(userID),
 			ExpiresAt: &jwt.NumericDate{Time: expirationTime},
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
 		},
 	}
 
+	key, err := JWTKey()
+	if err != nil {
+		return "", err
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(JWTKey)
+	return token.SignedString(key)
 }
 
 // ValidateToken verifies the JWT's signature and claims (like expiration).
@@ -53,7 +90,7 @@ func ValidateToken(tokenStr string) (*Claims, error) {
 	claims := &Claims{}
 
 	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return JWTKey, nil
+		return JWTKey()
 	})
 
 	if err != nil {
@@ -66,3 +103,13 @@ func ValidateToken(tokenStr string) (*Claims, error) {
 
 	return claims, nil
 }
+
+// UserID returns the ID of the user the token was issued to, taken from the subject claim.
+// It returns 0 if the subject is missing or not a valid ID.
+func (c *Claims) UserID() int {
+	id, err := strconv.Atoi(c.Subject)
+	if err != nil {
+		return 0
+	}
+	return id
+}
@@ -1,19 +1,30 @@
 package util
 
 import (
+	"errors"
 	"github.com/golang-jwt/jwt/v5"
 	"testing"
 	"time"
+	"user-api/config"
 )
 
+// withSigningKey configures a JWT signing key until the test ends.
+func withSigningKey(t *testing.T) {
+	t.Helper()
+	previous := config.C.JWTSecret
+	config.C.JWTSecret = "test-signing-key"
+	t.Cleanup(func() { config.C.JWTSecret = previous })
+}
+
 // TestGenerateAndValidateToken tests the token generation and validation process.
 // It first generates a token for a sample username, then validates it to ensure the content is correct.
 // Finally, it tests an invalid token to make sure validation catches the problem.
 func TestGenerateAndValidateToken(t *testing.T) {
+	withSigningKey(t)
 	username := "TestUser"
 
 	// Generate a token for the test username
-	tokenStr, err := GenerateToken(username)
+	tokenStr, err := GenerateToken(42, username, []string{RoleUser}, []string{PermProfileRead}, time.Time{})
 	if err != nil {
 		t.Fatalf("Failed to generate token: %v", err)
 	}
@@ -27,6 +38,12 @@ func TestGenerateAndValidateToken(t *testing.T) {
 	if claims.Username != username {
 		t.Fatalf("Expected username %s, but got %s", username, claims.Username)
 	}
+	if claims.UserID() != 42 {
+		t.Fatalf("Expected user ID 42, but got %d", claims.UserID())
+	}
+	if !claims.HasRole(RoleUser) || !claims.HasPermission(PermProfileRead) {
+		t.Fatalf("Expected role and permission in claims, but got %v and %v", claims.Roles, claims.Permissions)
+	}
 
 	// Test token validation with an invalid token string
 	_, err = ValidateToken(tokenStr + "invalid")
@@ -39,6 +56,7 @@ func TestGenerateAndValidateToken(t *testing.T) {
 // It creates a token set to expire immediately, then validates it.
 // The validation is expected to fail since the token is expired.
 func TestTokenExpiry(t *testing.T) {
+	withSigningKey(t)
 	username := "TestUser"
 
 	// Generate an expired token for the test username
@@ -49,7 +67,8 @@ func TestTokenExpiry(t *testing.T) {
 		},
 	})
 
-	tokenStr, err := expiredToken.SignedString(JWTKey)
+	key, _ := JWTKey()
+	tokenStr, err := expiredToken.SignedString(key)
 	if err != nil {
 		t.Fatalf("Failed to generate token: %v", err)
 	}
@@ -60,3 +79,20 @@ func TestTokenExpiry(t *testing.T) {
 		t.Fatalf("Expected error for expired token, but got none")
 	}
 }
+
+// TestMissingSigningKey tests that tokens are neither issued nor accepted without a signing key.
+func TestMissingSigningKey(t *testing.T) {
+	withSigningKey(t)
+	tokenStr, err := GenerateToken(42, "TestUser", nil, nil, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	config.C.JWTSecret = ""
+	if _, err := GenerateToken(42, "TestUser", nil, nil, time.Time{}); !errors.Is(err, ErrSigningKeyMissing) {
+		t.Errorf("Expected ErrSigningKeyMissing when generating, but got %v", err)
+	}
+	if _, err := ValidateToken(tokenStr); !errors.Is(err, ErrSigningKeyMissing) {
+		t.Errorf("Expected ErrSigningKeyMissing when validating, but got %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"user-api/config"
+)
+
+// pepperPrefix marks an encoded hash whose password was peppered before hashing.
+// The full format is "$pepper$v=<version>" followed by the inner encoded hash, e.g.
+//
+//	$pepper$v=2$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+const pepperPrefix = "$pepper$v="
+
+// ErrUnknownPepperVersion is returned when a hash references a pepper version that is not configured.
+var ErrUnknownPepperVersion = errors.New("unknown pepper version")
+
+// pepperKeyring holds the configured pepper secrets by version, and the version used for new hashes.
+// A zero current version means peppering is disabled.
+type pepperKeyring struct {
+	current int
+	keys    map[int][]byte
+}
+
+// peppers caches the keyring parsed from the configuration, so it is only parsed again
+// when the configured values change.
+var peppers struct {
+	sync.Mutex
+	source  string // PASSWORD_PEPPERS the keyring was parsed from
+	version int    // PASSWORD_PEPPER_VERSION the keyring was parsed with
+	parsed  bool
+	ring    pepperKeyring
+	err     error
+}
+
+// loadPeppers returns the pepper keyring of the application's configuration, parsing it
+// the first time and whenever the configuration changed since.
+func loadPeppers() (pepperKeyring, error) {
+	peppers.Lock()
+	defer peppers.Unlock()
+
+	if !peppers.parsed || peppers.source != config.C.PasswordPeppers || peppers.version != config.C.PasswordPepperVersion {
+		peppers.ring, peppers.err = parsePeppers(config.C.PasswordPeppers, config.C.PasswordPepperVersion)
+		peppers.source, peppers.version, peppers.parsed = config.C.PasswordPeppers, config.C.PasswordPepperVersion, true
+	}
+	return peppers.ring, peppers.err
+}
+
+// parsePeppers parses a pepper keyring. value holds comma-separated "<version>:<secret>"
+// pairs, as in PASSWORD_PEPPERS; versions must be positive. A non-zero current version
+// selects the version used for new hashes, which defaults to the highest one.
+// Older versions should stay configured after a rotation so existing hashes still verify.
+func parsePeppers(value string, current int) (pepperKeyring, error) {
+	ring := pepperKeyring{keys: make(map[int][]byte)}
+	if strings.TrimSpace(value) == "" {
+		return ring, nil
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		versionStr, secret, found := strings.Cut(strings.TrimSpace(pair), ":")
+		version, err := strconv.Atoi(versionStr)
+		if !found || err != nil || version <= 0 || secret == "" {
+			return ring, fmt.Errorf("invalid pepper entry %q", pair)
+		}
+		ring.keys[version] = []byte(secret)
+		if version > ring.current {
+			ring.current = version
+		}
+	}
+
+	if current != 0 {
+		if _, ok := ring.keys[current]; !ok {
+			return ring, fmt.Errorf("%w: %d", ErrUnknownPepperVersion, current)
+		}
+		ring.current = current
+	}
+
+	return ring, nil
+}
+
+// pepper mixes the secret pepper into a password with HMAC-SHA256. The MAC is
+// base64 encoded so the result is safe for hashers that stop at NUL bytes or
+// truncate long inputs (bcrypt uses at most 72 bytes).
+func pepper(password string, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(password))
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// splitPepper separates the pepper version from an encoded hash.
+// Hashes without a pepper prefix are returned unchanged with version 0.
+func splitPepper(encoded string) (int, string, error) {
+	if !strings.HasPrefix(encoded, pepperPrefix) {
+		return 0, encoded, nil
+	}
+
+	rest := strings.TrimPrefix(encoded, pepperPrefix)
+	i := strings.Index(rest, "$")
+	if i < 0 {
+		return 0, "", ErrMalformedHash
+	}
+	version, err := strconv.Atoi(rest[:i])
+	if err != nil || version <= 0 {
+		return 0, "", ErrMalformedHash
+	}
+
+	return version, rest[i:], nil
+}
@@ -0,0 +1,114 @@
+package util
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"user-api/config"
+)
+
+// usePepperConfig sets fast hashing parameters and the given pepper keyring for the duration of a test.
+func usePepperConfig(t *testing.T, peppers string, version int) {
+	previous := config.C
+	t.Cleanup(func() { config.C = previous })
+
+	config.C.PasswordHashAlgorithm = AlgorithmArgon2id
+	config.C.Argon2Time, config.C.Argon2Memory, config.C.Argon2Threads = 1, 8*1024, 1
+	config.C.PasswordPeppers = peppers
+	config.C.PasswordPepperVersion = version
+}
+
+// TestPepperedHash tests that peppered hashes record their pepper version and only verify with the pepper.
+func TestPepperedHash(t *testing.T) {
+	usePepperConfig(t, "1:first-secret", 0)
+
+	hash, err := HashPassword(context.Background(), "testPassword123")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$pepper$v=1$argon2id$") {
+		t.Fatalf("Expected pepper version in encoded hash, got %s", hash)
+	}
+	if !CheckHashedPassword(context.Background(), "testPassword123", hash) {
+		t.Fatal("Failed to validate the peppered password")
+	}
+	if CheckHashedPassword(context.Background(), "wrongPassword123", hash) {
+		t.Fatal("Expected wrong password to be rejected")
+	}
+
+	// Without the pepper secret the hash can no longer be verified
+	config.C.PasswordPeppers = ""
+	if CheckHashedPassword(context.Background(), "testPassword123", hash) {
+		t.Fatal("Expected peppered hash to fail verification without the pepper")
+	}
+}
+
+// TestPepperRotation tests that hashes made with an older pepper still verify and are flagged for rehash.
+func TestPepperRotation(t *testing.T) {
+	usePepperConfig(t, "1:first-secret", 0)
+
+	oldHash, err := HashPassword(context.Background(), "testPassword123")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	if NeedsRehash(oldHash) {
+		t.Fatal("Hash with current pepper should not need a rehash")
+	}
+
+	// Rotate to a new pepper while keeping the old one for verification
+	config.C.PasswordPeppers = "1:first-secret,2:second-secret"
+
+	if !CheckHashedPassword(context.Background(), "testPassword123", oldHash) {
+		t.Fatal("Hash with previous pepper should still verify after rotation")
+	}
+	if !NeedsRehash(oldHash) {
+		t.Fatal("Hash with previous pepper should need a rehash after rotation")
+	}
+
+	newHash, err := HashPassword(context.Background(), "testPassword123")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	if !strings.HasPrefix(newHash, "$pepper$v=2$") || NeedsRehash(newHash) {
+		t.Fatalf("Expected hash with current pepper version 2, got %s", newHash)
+	}
+
+	// Pinning the version selects it for new hashes
+	config.C.PasswordPepperVersion = 1
+	if !NeedsRehash(newHash) {
+		t.Fatal("Hash with version 2 should need a rehash when version 1 is pinned")
+	}
+}
+
+// TestUnpepperedHashMigration tests that hashes created before peppering was enabled still verify.
+func TestUnpepperedHashMigration(t *testing.T) {
+	usePepperConfig(t, "", 0)
+
+	plainHash, err := HashPassword(context.Background(), "testPassword123")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+
+	config.C.PasswordPeppers = "1:first-secret"
+	if !CheckHashedPassword(context.Background(), "testPassword123", plainHash) {
+		t.Fatal("Unpeppered hash should still verify once peppering is enabled")
+	}
+	if !NeedsRehash(plainHash) {
+		t.Fatal("Unpeppered hash should need a rehash once peppering is enabled")
+	}
+}
+
+// TestInvalidPepperConfig tests that malformed pepper configuration is rejected.
+func TestInvalidPepperConfig(t *testing.T) {
+	for _, peppers := range []string{"secret", "0:secret", "x:secret", "1:"} {
+		usePepperConfig(t, peppers, 0)
+		if _, err := HashPassword(context.Background(), "testPassword123"); err == nil {
+			t.Errorf("Expected error for pepper configuration %q, but got none", peppers)
+		}
+	}
+
+	usePepperConfig(t, "1:first-secret", 3)
+	if _, err := HashPassword(context.Background(), "testPassword123"); err == nil {
+		t.Error("Expected error for unknown pinned pepper version, but got none")
+	}
+}
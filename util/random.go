@@ -0,0 +1,23 @@
+package util
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+)
+
+// RandomString returns a URL-safe random string generated from n bytes of
+// cryptographically secure randomness, e.g. for temporary passwords or identifiers.
+//
+// Parameters:
+// - n: the number of random bytes to generate.
+//
+// Returns:
+// - the random bytes encoded as unpadded URL-safe base64.
+// - error, if the system's random source failed.
+func RandomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,104 @@
+package util
+
+import "sort"
+
+// Roles that can be assigned to users. Every user has at least RoleUser.
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+// Permissions granted through roles or directly to users, and embedded in tokens.
+const (
+	PermProfileRead   = "profile:read"
+	PermProfileWrite  = "profile:write"
+	PermProfileDelete = "profile:delete"
+	PermUsersRead     = "users:read"
+	PermUsersWrite    = "users:write"
+	PermUsersDelete   = "users:delete"
+	PermTokensRevoke  = "tokens:revoke"
+	PermAuditRead     = "audit:read"
+)
+
+// RolePermissions maps each role to the permissions it grants.
+var RolePermissions = map[string][]string{
+	RoleUser: {
+		PermProfileRead, PermProfileWrite, PermProfileDelete,
+	},
+	RoleSupport: {
+		PermProfileRead, PermProfileWrite, PermProfileDelete,
+		PermUsersRead,
+	},
+	RoleAdmin: {
+		PermProfileRead, PermProfileWrite, PermProfileDelete,
+		PermUsersRead, PermUsersWrite, PermUsersDelete, PermTokensRevoke,
+		PermAuditRead,
+	},
+}
+
+// IsValidRole reports whether role is one of the known roles.
+func IsValidRole(role string) bool {
+	_, ok := RolePermissions[role]
+	return ok
+}
+
+// IsValidPermission reports whether permission is granted by at least one known role.
+func IsValidPermission(permission string) bool {
+	for _, perms := range RolePermissions {
+		for _, p := range perms {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// EffectivePermissions returns the sorted, de-duplicated union of the permissions
+// granted by roles and the permissions granted directly. Unknown roles grant nothing.
+//
+// Parameters:
+// - roles: the roles assigned to the user.
+// - extra: permissions granted to the user in addition to their roles.
+//
+// Returns:
+// - the permissions the user effectively holds.
+func EffectivePermissions(roles, extra []string) []string {
+	set := make(map[string]bool)
+	for _, role := range roles {
+		for _, p := range RolePermissions[role] {
+			set[p] = true
+		}
+	}
+	for _, p := range extra {
+		set[p] = true
+	}
+
+	perms := make([]string, 0, len(set))
+	for p := range set {
+		perms = append(perms, p)
+	}
+	sort.Strings(perms)
+	return perms
+}
+
+// HasPermission reports whether the claims grant the given permission.
+func (c *Claims) HasPermission(permission string) bool {
+	for _, p := range c.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRole reports whether the claims include the given role.
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestEffectivePermissions tests that role permissions and extra permissions are merged without duplicates.
+func TestEffectivePermissions(t *testing.T) {
+	tests := []struct {
+		roles    []string
+		extra    []string
+		expected []string
+	}{
+		{nil, nil, []string{}},
+		{[]string{RoleUser}, nil, []string{PermProfileDelete, PermProfileRead, PermProfileWrite}},
+		{[]string{RoleUser}, []string{PermUsersRead, PermProfileRead}, []string{PermProfileDelete, PermProfileRead, PermProfileWrite, PermUsersRead}},
+		{[]string{"unknown"}, nil, []string{}},
+	}
+
+	for _, tt := range tests {
+		perms := EffectivePermissions(tt.roles, tt.extra)
+		if !reflect.DeepEqual(perms, tt.expected) {
+			t.Errorf("EffectivePermissions(%v, %v) = %v, expected %v", tt.roles, tt.extra, perms, tt.expected)
+		}
+	}
+}
+
+// TestRoleValidation tests the role and permission validity checks.
+func TestRoleValidation(t *testing.T) {
+	if !IsValidRole(RoleAdmin) || IsValidRole("superuser") {
+		t.Error("Unexpected role validation result")
+	}
+	if !IsValidPermission(PermUsersDelete) || IsValidPermission("users:everything") {
+		t.Error("Unexpected permission validation result")
+	}
+}
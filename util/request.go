@@ -0,0 +1,111 @@
+package util
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"user-api/config"
+)
+
+// proxies caches the trusted proxy ranges parsed from the configuration, so they are only
+// parsed again when TRUSTED_PROXIES changes.
+var proxies struct {
+	sync.Mutex
+	source   string // TRUSTED_PROXIES the ranges were parsed from
+	parsed   bool
+	prefixes []netip.Prefix
+	err      error
+}
+
+// loadTrustedProxies returns the trusted proxy ranges of the application's configuration,
+// parsing them the first time and whenever the configuration changed since.
+func loadTrustedProxies() ([]netip.Prefix, error) {
+	proxies.Lock()
+	defer proxies.Unlock()
+
+	if !proxies.parsed || proxies.source != config.C.TrustedProxies {
+		proxies.prefixes, proxies.err = parseTrustedProxies(config.C.TrustedProxies)
+		proxies.source, proxies.parsed = config.C.TrustedProxies, true
+	}
+	return proxies.prefixes, proxies.err
+}
+
+// parseTrustedProxies parses comma-separated addresses and CIDR ranges, as in TRUSTED_PROXIES.
+// A single address is a range of one address.
+func parseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// CheckProxyConfig validates the trusted proxies of the application's configuration.
+// It should be called at startup, so a malformed TRUSTED_PROXIES stops the server instead
+// of silently attributing requests to the proxies.
+func CheckProxyConfig() error {
+	_, err := loadTrustedProxies()
+	return err
+}
+
+// trusted tells whether addr is within one of the prefixes.
+func trusted(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP address of the client that sent the request.
+// The X-Forwarded-For header is only honored when the request comes from a proxy listed in
+// TRUSTED_PROXIES, as anyone else can set it. The header is read from right to left, skipping
+// trusted proxies, so a client can't pose as another by prepending addresses to it.
+//
+// Parameters:
+// - r: the request.
+//
+// Returns:
+// - the client's IP address, or the raw remote address if it has no port.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	prefixes, err := loadTrustedProxies()
+	remote, parseErr := netip.ParseAddr(host)
+	if err != nil || len(prefixes) == 0 || parseErr != nil || !trusted(prefixes, remote) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			// Whatever is left of a malformed entry can't be trusted
+			break
+		}
+		host = addr.Unmap().String()
+		if !trusted(prefixes, addr) {
+			break
+		}
+	}
+	return host
+}
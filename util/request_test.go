@@ -0,0 +1,77 @@
+package util
+
+import (
+	"net/http/httptest"
+	"testing"
+	"user-api/config"
+)
+
+// TestClientIP tests that X-Forwarded-For is only honored for requests from trusted proxies,
+// and that clients can't pose as another address through it.
+func TestClientIP(t *testing.T) {
+	defer func(c config.Config) { config.C = c }(config.C)
+	config.C.TrustedProxies = "10.0.0.0/8, 192.168.1.1"
+
+	tests := []struct {
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"203.0.113.7:5000", nil, "203.0.113.7"},
+		// Untrusted clients can't set their own address
+		{"203.0.113.7:5000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"10.1.2.3:5000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"192.168.1.1:5000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"192.168.1.2:5000", []string{"198.51.100.1"}, "192.168.1.2"},
+		// Chained trusted proxies are skipped, spoofed entries left of the client ignored
+		{"10.1.2.3:5000", []string{"1.1.1.1, 198.51.100.1, 10.9.9.9"}, "198.51.100.1"},
+		{"10.1.2.3:5000", []string{"1.1.1.1", "198.51.100.1"}, "198.51.100.1"},
+		{"[::ffff:10.1.2.3]:5000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"10.1.2.3:5000", []string{"garbage, 198.51.100.1"}, "198.51.100.1"},
+		{"10.1.2.3:5000", []string{"198.51.100.1, garbage"}, "10.1.2.3"},
+		{"10.1.2.3:5000", nil, "10.1.2.3"},
+		{"pipe", nil, "pipe"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		for _, value := range test.forwarded {
+			req.Header.Add("X-Forwarded-For", value)
+		}
+		if got := ClientIP(req); got != test.want {
+			t.Errorf("Expected %s for %s forwarding %q, but got %s", test.want, test.remoteAddr, test.forwarded, got)
+		}
+	}
+
+	// Without trusted proxies, the header is ignored
+	config.C.TrustedProxies = ""
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.1.2.3:5000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	if got := ClientIP(req); got != "10.1.2.3" {
+		t.Errorf("Expected the header to be ignored, but got %s", got)
+	}
+}
+
+// TestCheckProxyConfig tests that malformed trusted proxies are rejected.
+func TestCheckProxyConfig(t *testing.T) {
+	defer func(c config.Config) { config.C = c }(config.C)
+
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"", true},
+		{"10.0.0.0/8,2001:db8::/32, 192.168.1.1", true},
+		{"10.0.0.0/33", false},
+		{"proxy.internal", false},
+	}
+
+	for _, test := range tests {
+		config.C.TrustedProxies = test.value
+		if err := CheckProxyConfig(); (err == nil) != test.valid {
+			t.Errorf("Expected valid=%v for %q, but got %v", test.valid, test.value, err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+// UserAgent describes the client software and device parsed from a User-Agent header.
+// Unrecognized values are reported as "Other".
+type UserAgent struct {
+	Browser        string `json:"browser"`         // e.g. "Chrome", "Firefox", "Safari"
+	BrowserVersion string `json:"browser_version"` // Major version, e.g. "126"; empty if unknown
+	OS             string `json:"os"`              // e.g. "Windows", "macOS", "Android"
+	Device         string `json:"device"`          // "Desktop", "Mobile", "Tablet" or "Bot"
+}
+
+// browserPatterns are matched in order, so browsers that include the tokens of the
+// browsers they are based on (e.g. Edge and Opera mention Chrome and Safari) come first.
+var browserPatterns = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"Edge", regexp.MustCompile(`Edg(?:e|A|iOS)?/(\d+)`)},
+	{"Opera", regexp.MustCompile(`(?:OPR|Opera)/(\d+)`)},
+	{"Samsung Internet", regexp.MustCompile(`SamsungBrowser/(\d+)`)},
+	{"Firefox", regexp.MustCompile(`(?:Firefox|FxiOS)/(\d+)`)},
+	{"Chrome", regexp.MustCompile(`(?:Chrome|CriOS)/(\d+)`)},
+	{"Safari", regexp.MustCompile(`Version/(\d+)[.\d]* (?:Mobile/\S+ )?Safari/`)},
+	{"curl", regexp.MustCompile(`^curl/(\d+)`)},
+}
+
+// osPatterns are matched in order; iOS and Android devices also mention Mac OS X and Linux.
+var osPatterns = []struct {
+	name    string
+	pattern string
+}{
+	{"iOS", "iPhone"},
+	{"iOS", "iPad"},
+	{"Android", "Android"},
+	{"Windows", "Windows"},
+	{"macOS", "Macintosh"},
+	{"ChromeOS", "CrOS"},
+	{"Linux", "Linux"},
+}
+
+// ParseUserAgent extracts the browser, operating system and device type from a User-Agent header.
+// It recognizes the common browsers rather than implementing a full parser.
+//
+// Parameters:
+// - header: the value of the User-Agent header.
+//
+// Returns:
+// - the parsed user agent.
+func ParseUserAgent(header string) UserAgent {
+	ua := UserAgent{Browser: "Other", OS: "Other", Device: "Desktop"}
+
+	for _, browser := range browserPatterns {
+		if match := browser.pattern.FindStringSubmatch(header); match != nil {
+			ua.Browser, ua.BrowserVersion = browser.name, match[1]
+			break
+		}
+	}
+	for _, os := range osPatterns {
+		if strings.Contains(header, os.pattern) {
+			ua.OS = os.name
+			break
+		}
+	}
+
+	lower := strings.ToLower(header)
+	switch {
+	case strings.Contains(lower, "bot") || strings.Contains(lower, "spider") || strings.Contains(lower, "crawl"):
+		ua.Device = "Bot"
+	case strings.Contains(header, "iPad") || strings.Contains(header, "Tablet") ||
+		(ua.OS == "Android" && !strings.Contains(header, "Mobile")):
+		ua.Device = "Tablet"
+	case strings.Contains(header, "Mobi") || strings.Contains(header, "iPhone"):
+		ua.Device = "Mobile"
+	}
+	return ua
+}
+
+// Fingerprint identifies a device by the kind of device the user agent runs on and the
+// network it connects from, the /24 of IPv4 addresses or the /48 of IPv6 addresses.
+// Browser versions and the rest of the address are left out, so updating the browser or
+// getting a new address from the same provider doesn't make a known device look new.
+func (ua UserAgent) Fingerprint(ip string) string {
+	sum := sha256.Sum256([]byte(ua.Browser + "\n" + ua.OS + "\n" + ua.Device + "\n" + network(ip)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// network returns the /24 network of an IPv4 address or the /48 network of an IPv6 address,
+// or ip itself if it isn't an address.
+func network(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	bits := 48
+	if addr.Unmap().Is4() {
+		addr, bits = addr.Unmap(), 24
+	}
+	prefix, _ := addr.Prefix(bits)
+	return prefix.String()
+}
+
+// String returns a human-readable description, e.g. "Firefox 126 on Windows".
+func (ua UserAgent) String() string {
+	browser := ua.Browser
+	if ua.BrowserVersion != "" {
+		browser += " " + ua.BrowserVersion
+	}
+	return browser + " on " + ua.OS
+}
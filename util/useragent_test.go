@@ -0,0 +1,72 @@
+package util
+
+import "testing"
+
+// TestParseUserAgent tests that common user agents are recognized.
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		header string
+		want   UserAgent
+	}{
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36",
+			UserAgent{"Chrome", "126", "Windows", "Desktop"},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.2592.87",
+			UserAgent{"Edge", "126", "Windows", "Desktop"},
+		},
+		{
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:127.0) Gecko/20100101 Firefox/127.0",
+			UserAgent{"Firefox", "127", "macOS", "Desktop"},
+		},
+		{
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1",
+			UserAgent{"Safari", "17", "iOS", "Mobile"},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 14; SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/25.0 Chrome/121.0.0.0 Mobile Safari/537.36",
+			UserAgent{"Samsung Internet", "25", "Android", "Mobile"},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36",
+			UserAgent{"Chrome", "126", "Android", "Tablet"},
+		},
+		{"curl/8.5.0", UserAgent{"curl", "8", "Other", "Desktop"}},
+		{"Googlebot/2.1 (+http://www.google.com/bot.html)", UserAgent{"Other", "", "Other", "Bot"}},
+		{"", UserAgent{"Other", "", "Other", "Desktop"}},
+	}
+
+	for _, test := range tests {
+		if got := ParseUserAgent(test.header); got != test.want {
+			t.Errorf("ParseUserAgent(%q) = %+v, want %+v", test.header, got, test.want)
+		}
+	}
+}
+
+// TestFingerprint tests that fingerprints ignore browser versions and addresses within
+// a network, but distinguish devices and networks.
+func TestFingerprint(t *testing.T) {
+	old := UserAgent{"Chrome", "125", "Windows", "Desktop"}
+	updated := UserAgent{"Chrome", "126", "Windows", "Desktop"}
+	phone := UserAgent{"Chrome", "126", "Android", "Mobile"}
+
+	if old.Fingerprint("203.0.113.7") != updated.Fingerprint("203.0.113.80") {
+		t.Error("Expected browser updates and addresses in the same /24 to keep the fingerprint")
+	}
+	if updated.Fingerprint("203.0.113.7") == phone.Fingerprint("203.0.113.7") {
+		t.Error("Expected different devices to have different fingerprints")
+	}
+	if updated.Fingerprint("203.0.113.7") == updated.Fingerprint("198.51.100.7") {
+		t.Error("Expected different networks to have different fingerprints")
+	}
+	if updated.Fingerprint("2001:db8:1:2::1") != updated.Fingerprint("2001:db8:1:ffff::2") {
+		t.Error("Expected addresses in the same /48 to keep the fingerprint")
+	}
+	if updated.Fingerprint("2001:db8:1::1") == updated.Fingerprint("2001:db8:2::1") {
+		t.Error("Expected different IPv6 networks to have different fingerprints")
+	}
+	if updated.Fingerprint("::ffff:203.0.113.7") != updated.Fingerprint("203.0.113.9") {
+		t.Error("Expected IPv4-mapped addresses to match their IPv4 network")
+	}
+}
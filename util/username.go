@@ -0,0 +1,66 @@
+package util
+
+import (
+	"strings"
+	"unicode"
+	"user-api/config"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// foldCaser performs full Unicode case folding, e.g. "Straße" becomes "strasse".
+var foldCaser = cases.Fold()
+
+// CanonicalUsername returns the canonical form of a username, used to detect
+// usernames that look alike but differ in their exact characters. Two usernames
+// with the same canonical form are treated as the same account name.
+//
+// The canonical form is computed by:
+// - applying Unicode NFKC normalization (so "ｕｓｅｒ" becomes "user"),
+// - case folding (so "Admin" becomes "admin"),
+// - removing invisible format characters such as zero-width joiners,
+// - mapping confusable characters to a common prototype (so Cyrillic "а" becomes "a").
+//
+// Parameters:
+// - username: the username as entered by the user.
+//
+// Returns:
+// - the canonical form of the username.
+func CanonicalUsername(username string) string {
+	s := norm.NFKC.String(username)
+	s = foldCaser.String(s)
+
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.Is(unicode.Cf, r) {
+			continue
+		}
+		if prototype, ok := confusables[r]; ok {
+			r = prototype
+		}
+		b.WriteRune(r)
+	}
+
+	return norm.NFKC.String(b.String())
+}
+
+// IsReservedUsername reports whether a username matches, after canonicalization,
+// one of the reserved names configured through RESERVED_USERNAMES. Reserved names
+// can't be chosen by users, to prevent impersonation of staff or system accounts.
+//
+// Parameters:
+// - username: the username to check.
+//
+// Returns:
+// - true if the username is reserved, false otherwise.
+func IsReservedUsername(username string) bool {
+	canonical := CanonicalUsername(username)
+	for _, reserved := range strings.Split(config.C.ReservedUsernames, ",") {
+		reserved = strings.TrimSpace(reserved)
+		if reserved != "" && CanonicalUsername(reserved) == canonical {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package util
+
+import (
+	"testing"
+	"user-api/config"
+)
+
+// TestCanonicalUsername tests that usernames differing only by case, width, invisible
+// characters or confusable characters share a canonical form.
+func TestCanonicalUsername(t *testing.T) {
+	tests := []struct {
+		username string
+		expected string
+	}{
+		{"admin", "admin"},
+		{"Admin", "admin"},
+		{"ＡＤＭＩＮ", "admin"},         // Fullwidth letters
+		{"аdmin", "admin"},         // Cyrillic small a
+		{"admіn", "admin"},         // Cyrillic small byelorussian-ukrainian i
+		{"ad\u200dmin", "admin"},   // Zero-width joiner
+		{"Straße", "strasse"},      // Full case folding
+		{"g00gle", "google"},       // Digit zero
+		{"paypa1", "paypal"},       // Digit one
+		{"TestUser1", "testuserl"}, // Digits are mapped too
+		{"another_user", "another_user"},
+	}
+
+	for _, tt := range tests {
+		if got := CanonicalUsername(tt.username); got != tt.expected {
+			t.Errorf("CanonicalUsername(%q) = %q, expected %q", tt.username, got, tt.expected)
+		}
+	}
+
+	// Distinct names must stay distinct
+	if CanonicalUsername("alice") == CanonicalUsername("alicia") {
+		t.Error("Expected distinct usernames to have distinct canonical forms")
+	}
+}
+
+// TestIsReservedUsername tests matching usernames against the configured reserved list.
+func TestIsReservedUsername(t *testing.T) {
+	defer func(c config.Config) { config.C = c }(config.C)
+	config.C.ReservedUsernames = "admin, root,support"
+
+	tests := []struct {
+		username string
+		reserved bool
+	}{
+		{"admin", true},
+		{"ADMIN", true},
+		{"аdmin", true}, // Cyrillic small a
+		{"r00t", true},
+		{"Support", true},
+		{"administrator", false},
+		{"alice", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsReservedUsername(tt.username); got != tt.reserved {
+			t.Errorf("IsReservedUsername(%q) = %v, expected %v", tt.username, got, tt.reserved)
+		}
+	}
+
+	config.C.ReservedUsernames = ""
+	if IsReservedUsername("admin") {
+		t.Error("Expected no reserved usernames when the list is empty")
+	}
+}